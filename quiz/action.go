@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// dragHold is how long a drag holds the button still at each end.
+const dragHold = 100 * time.Millisecond
+
+// action is one thing the session does between captures: click, press
+// keys, type text, scroll, drag or wait. --script steps also use capture and
+// wait-for-change.
+type action struct {
+	kind   string
+	keys   []keyPress
+	scroll int          // wheel steps, negative scrolls down
+	at     *image.Point // click or scroll position; nil uses --click-at or the mouse
+	to     *image.Point // where a drag ends
+	wait   time.Duration
+	text   string // for type; empty types the question's --answers line
+
+	// Script block steps: if-image runs then or els, while-image and repeat
+	// run then as their body. A block's image file name is in text and its
+	// timeout in wait.
+	image     *image.Gray
+	then, els []action
+	count     int
+}
+
+// parseAction parses a step: click[:x,y], key:NAME, keys:NAME,NAME...,
+// type[:TEXT], click-text:TEXT, scroll:N, drag:x1,y1->x2,y2, wait:DURATION, wait-for-change
+// or capture, and with --browser click-selector:CSS and navigate:URL.
+func parseAction(s string) (action, error) {
+	kind, arg, hasArg := strings.Cut(strings.TrimSpace(s), ":")
+	a := action{kind: kind}
+	var err error
+	switch kind {
+	case "click":
+		if hasArg {
+			var v []int
+			if v, err = parseInts(arg, 2); err == nil {
+				a.at = &image.Point{X: v[0], Y: v[1]}
+			}
+		}
+	case "key":
+		var k keyPress
+		k, err = parseKey(arg)
+		a.keys = []keyPress{k}
+	case "keys":
+		a.keys, err = parseKeys(arg)
+	case "type", "click-text", "click-selector", "navigate":
+		a.text = arg
+		if strings.HasPrefix(arg, `"`) {
+			a.text, err = strconv.Unquote(arg)
+		}
+		if err == nil && kind != "type" && strings.TrimSpace(a.text) == "" {
+			err = fmt.Errorf("%s needs an argument", kind)
+		}
+	case "scroll":
+		a.scroll, err = strconv.Atoi(arg)
+		if err == nil && a.scroll == 0 {
+			err = fmt.Errorf("scroll amount must not be zero")
+		}
+	case "drag":
+		from, to, ok := strings.Cut(arg, "->")
+		var v, w []int
+		if !ok {
+			err = fmt.Errorf("want drag:x1,y1->x2,y2")
+		} else if v, err = parseInts(from, 2); err == nil {
+			if w, err = parseInts(to, 2); err == nil {
+				a.at, a.to = &image.Point{X: v[0], Y: v[1]}, &image.Point{X: w[0], Y: w[1]}
+			}
+		}
+	case "wait":
+		a.wait, err = time.ParseDuration(arg)
+		if err == nil && a.wait < 0 {
+			err = fmt.Errorf("wait must not be negative")
+		}
+	case "capture", "wait-for-change":
+		if hasArg {
+			err = fmt.Errorf("%s takes no argument", kind)
+		}
+	default:
+		return a, fmt.Errorf("unsupported action %q (want click, key:NAME, keys:NAME,..., type:TEXT, click-text:TEXT, scroll:N, drag:x1,y1->x2,y2, wait:DURATION, wait-for-change, capture, click-selector:CSS or navigate:URL)", s)
+	}
+	if err != nil {
+		return a, fmt.Errorf("%q: %w", s, err)
+	}
+	return a, nil
+}
+
+// usesAction reports whether any of steps, including script block bodies,
+// is of the given kind.
+func usesAction(kind string, steps []action) bool {
+	for _, a := range steps {
+		if a.kind == kind || usesAction(kind, a.then) || usesAction(kind, a.els) {
+			return true
+		}
+	}
+	return false
+}
+
+// advance moves the quiz on to the next question after capture i, with
+// the --do actions in order or else the --action.
+func (s *session) advance(i int) error {
+	if len(s.opts.do.actions) == 0 {
+		return s.perform(i, s.opts.action)
+	}
+	for _, a := range s.opts.do.actions {
+		if err := s.perform(i, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// perform carries out a click, key, type, scroll, drag or wait action for
+// iteration i.
+func (s *session) perform(i int, a action) (err error) {
+	if a.kind != "wait" {
+		if s.limitReached() {
+			return errSessionLimit
+		}
+		s.actions++
+		if err := s.focus(i); err != nil {
+			return err
+		}
+	}
+	// --restore-mouse puts the cursor back once the action is done.
+	switch a.kind {
+	case "click", "click-text", "click-selector", "scroll", "drag":
+		if s.opts.restoreMouse {
+			x, y, err := s.opts.input.location()
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if merr := s.opts.input.move(x, y); err == nil {
+					err = merr
+				}
+			}()
+		}
+	}
+	switch a.kind {
+	case "key", "keys":
+		for n, k := range a.keys {
+			if n > 0 {
+				s.sleep(s.opts.keyDelay)
+			}
+			s.log.add(logEvent{Type: "key", Capture: i, Key: k.String()})
+			if s.opts.dryRun {
+				slog.Info("Would press", "key", k.String())
+				continue
+			}
+			if err := s.opts.input.keyTap(k); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "type":
+		return s.typeText(i, a.text)
+
+	case "wait":
+		s.sleep(a.wait)
+		return nil
+
+	case "scroll":
+		x, y, err := s.opts.input.location()
+		if err != nil {
+			return err
+		}
+		at := a.at
+		if at == nil {
+			at = s.opts.clickAt
+		}
+		if at != nil {
+			p := jitterPoint(*at, s.opts)
+			x, y = p.X, p.Y
+			if err := moveMouse(x, y, s.opts); err != nil {
+				return err
+			}
+		}
+		s.log.add(logEvent{Type: "scroll", Capture: i, X: &x, Y: &y, Amount: a.scroll})
+		if s.opts.dryRun {
+			slog.Info("Would scroll", "steps", a.scroll, "x", x, "y", y)
+			return nil
+		}
+		return s.opts.input.scroll(a.scroll)
+
+	case "drag":
+		return s.drag(i, jitterPoint(*a.at, s.opts), jitterPoint(*a.to, s.opts))
+
+	case "navigate":
+		s.log.add(logEvent{Type: "navigate", Capture: i, File: a.text})
+		if s.opts.dryRun {
+			slog.Info("Would open", "url", a.text)
+			return nil
+		}
+		return s.opts.browser.navigate(a.text)
+
+	case "click-selector":
+		p, err := s.opts.browser.locateSelector(a.text)
+		if err != nil {
+			return err
+		}
+		a.at = &p
+
+	case "click-text":
+		p, err := locateText(a.text, s.opts)
+		if err != nil {
+			return err
+		}
+		a.at = &p
+	}
+
+	x, y, err := s.opts.input.location()
+	if err != nil {
+		return err
+	}
+	at := a.at
+	if at == nil && s.opts.clickImage != nil {
+		p, err := locateImage(s.opts.clickImage, s.opts.clickThreshold, s.opts)
+		if err != nil {
+			return err
+		}
+		at = &p
+	}
+	if at == nil && s.opts.clickElement.name != "" {
+		p, err := locateElement(s.opts.clickElement, s.opts.targetPid)
+		switch {
+		case err == nil:
+			at = &p
+		case s.opts.clickAt == nil && len(s.opts.clickCycle) == 0:
+			return err
+		default:
+			slog.Warn("clicking the fallback position", "err", err)
+		}
+	}
+	if at == nil && len(s.opts.clickCycle) > 0 {
+		at = &s.opts.clickCycle[(i-1)%len(s.opts.clickCycle)]
+	}
+	if at == nil {
+		at = s.opts.clickAt
+	}
+	if at != nil {
+		p := jitterPoint(*at, s.opts)
+		x, y = p.X, p.Y
+		if err := moveMouse(x, y, s.opts); err != nil {
+			return err
+		}
+	}
+	s.log.click(i, x, y, s.opts.clickType)
+	if s.opts.dryRun {
+		slog.Info("Would click", "button", s.opts.clickType, "x", x, "y", y)
+		return nil
+	}
+	if s.opts.clickType == "double" {
+		return s.opts.input.click("left", true)
+	}
+	return s.opts.input.click(s.opts.clickType, false)
+}
+
+// focus brings the target window back to the front for --focus, in case
+// something like a notification took focus since the last action.
+func (s *session) focus(i int) error {
+	if !s.opts.focus || s.opts.targetPid == 0 || s.opts.dryRun {
+		return nil
+	}
+	switched, err := focusWindow(s.opts.targetPid)
+	if switched {
+		s.log.add(logEvent{Type: "focus", Capture: i})
+		slog.Info("Target window lost focus, reactivated it")
+	}
+	return err
+}
+
+// drag presses the left button at from, moves to to and releases it. The
+// move always glides: drag-and-drop widgets ignore a pointer that jumps.
+func (s *session) drag(i int, from, to image.Point) error {
+	if err := moveMouse(from.X, from.Y, s.opts); err != nil {
+		return err
+	}
+	s.log.add(logEvent{Type: "drag", Capture: i, X: &from.X, Y: &from.Y, ToX: &to.X, ToY: &to.Y})
+	if s.opts.dryRun {
+		slog.Info("Would drag", "from", fmt.Sprintf("%d,%d", from.X, from.Y), "to", fmt.Sprintf("%d,%d", to.X, to.Y))
+		return nil
+	}
+	if err := s.opts.input.toggle("left", true); err != nil {
+		return err
+	}
+	s.sleep(dragHold)
+	glide := s.opts
+	glide.humanMouse = true
+	err := moveMouse(to.X, to.Y, glide)
+	s.sleep(dragHold)
+	if uerr := s.opts.input.toggle("left", false); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// typeText types text one character at a time, --type-delay apart. Empty
+// text types line i of the --answers file.
+func (s *session) typeText(i int, text string) error {
+	if text == "" {
+		if i > len(s.opts.answers) {
+			return fmt.Errorf("no answer for question %d (--answers has %d lines)", i, len(s.opts.answers))
+		}
+		text = s.opts.answers[i-1]
+	}
+	// The text itself stays out of the log; answers may be private.
+	s.log.add(logEvent{Type: "type", Capture: i, Amount: utf8.RuneCountInString(text)})
+	if s.opts.dryRun {
+		slog.Info("Would type", "chars", utf8.RuneCountInString(text))
+		return nil
+	}
+	for n, r := range []rune(text) {
+		if n > 0 {
+			s.sleep(s.opts.typeDelay)
+		}
+		if err := s.opts.input.typeText(string(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
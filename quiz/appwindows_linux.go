@@ -0,0 +1,59 @@
+package main
+
+import (
+	"image"
+	"sort"
+
+	"github.com/robotn/xgb/xproto"
+	"github.com/robotn/xgbutil"
+	"github.com/robotn/xgbutil/ewmh"
+)
+
+// processWindows returns the client area of every visible top-level window
+// owned by pid, ordered by window id so pages stay in a stable order.
+func processWindows(pid int) ([]image.Rectangle, error) {
+	xu, err := xgbutil.NewConn()
+	if err != nil {
+		return nil, err
+	}
+	defer xu.Conn().Close()
+
+	clients, err := ewmh.ClientListGet(xu)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i] < clients[j] })
+
+	var rects []image.Rectangle
+	for _, win := range clients {
+		wmPid, err := ewmh.WmPidGet(xu, win)
+		if err != nil || int(wmPid) != pid || windowHidden(xu, win) {
+			continue
+		}
+
+		geom, err := xproto.GetGeometry(xu.Conn(), xproto.Drawable(win)).Reply()
+		if err != nil {
+			continue
+		}
+		pos, err := xproto.TranslateCoordinates(xu.Conn(), win, xu.RootWin(), 0, 0).Reply()
+		if err != nil {
+			continue
+		}
+		x, y := int(pos.DstX), int(pos.DstY)
+		rects = append(rects, image.Rect(x, y, x+int(geom.Width), y+int(geom.Height)))
+	}
+	return rects, nil
+}
+
+func windowHidden(xu *xgbutil.XUtil, win xproto.Window) bool {
+	states, err := ewmh.WmStateGet(xu, win)
+	if err != nil {
+		return false
+	}
+	for _, s := range states {
+		if s == "_NET_WM_STATE_HIDDEN" {
+			return true
+		}
+	}
+	return false
+}
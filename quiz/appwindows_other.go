@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// processWindows falls back to the single window robotgo can locate for pid.
+func processWindows(pid int) ([]image.Rectangle, error) {
+	x, y, w, h := robotgo.GetClient(pid)
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("could not get bounds of window (pid %d)", pid)
+	}
+	return []image.Rectangle{image.Rect(x, y, x+w, y+h)}, nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// browserLoadTimeout bounds waiting for a page to finish loading.
+	browserLoadTimeout = 30 * time.Second
+	browserWindowSize  = "1280,1024"
+)
+
+// browserBinaries are tried in order when --browser-bin is not given.
+var browserBinaries = []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "chrome", "microsoft-edge"}
+
+// browserKeys maps key names to DOM key values and Windows key codes, which
+// Chrome needs to act on a synthetic key press.
+var browserKeys = map[string]struct {
+	key  string
+	code int
+}{
+	"enter":     {"Enter", 13},
+	"tab":       {"Tab", 9},
+	"escape":    {"Escape", 27},
+	"backspace": {"Backspace", 8},
+	"delete":    {"Delete", 46},
+	"insert":    {"Insert", 45},
+	"space":     {" ", 32},
+	"pageup":    {"PageUp", 33},
+	"pagedown":  {"PageDown", 34},
+	"end":       {"End", 35},
+	"home":      {"Home", 36},
+	"left":      {"ArrowLeft", 37},
+	"up":        {"ArrowUp", 38},
+	"right":     {"ArrowRight", 39},
+	"down":      {"ArrowDown", 40},
+}
+
+// CDP modifier and mouse button bits.
+var (
+	browserModifiers = map[string]int{"alt": 1, "ctrl": 2, "cmd": 4, "shift": 8}
+	browserButtons   = map[string]int{"left": 1, "right": 2, "middle": 4}
+)
+
+// browser is a Chrome instance driven over the DevTools protocol for
+// --browser. It captures the page and, as an inputDriver, sends synthetic
+// input to it, so the real mouse and keyboard stay free.
+type browser struct {
+	cdp     *cdpConn
+	profile string // temporary profile directory, removed on close
+	pos     image.Point
+	buttons int // CDP bit mask of the buttons held down
+}
+
+func browserBinary(bin string) (string, error) {
+	if bin != "" {
+		return exec.LookPath(bin)
+	}
+	for _, name := range browserBinaries {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("--browser requires Chrome or Chromium (or pass --browser-bin)")
+}
+
+// startBrowser launches Chrome and opens url in a new tab.
+func startBrowser(url string, opts options) (*browser, error) {
+	bin, err := browserBinary(opts.browserBin)
+	if err != nil {
+		return nil, err
+	}
+	b := &browser{}
+	profile := opts.browserProfile
+	if profile == "" {
+		if profile, err = os.MkdirTemp("", "quiz-chrome-*"); err != nil {
+			return nil, err
+		}
+		b.profile = profile
+	}
+	args := []string{"--user-data-dir=" + profile, "--no-first-run", "--no-default-browser-check", "--window-size=" + browserWindowSize}
+	if opts.browserHeadless {
+		args = append(args, "--headless=new")
+	}
+	if b.cdp, err = startCDP(bin, append(args, "about:blank")); err != nil {
+		b.close()
+		return nil, err
+	}
+
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	err = b.cdp.call("Target.createTarget", map[string]any{"url": "about:blank"}, &target)
+	if err == nil {
+		err = b.cdp.call("Target.attachToTarget", map[string]any{"targetId": target.TargetID, "flatten": true}, &attached)
+	}
+	if err == nil {
+		b.cdp.session = attached.SessionID
+		// One screenshot pixel per CSS pixel, so image matches and clicks
+		// share coordinates.
+		err = b.cdp.call("Emulation.setDeviceMetricsOverride", map[string]any{"width": 0, "height": 0, "deviceScaleFactor": 1, "mobile": false}, nil)
+	}
+	if err == nil {
+		err = b.navigate(url)
+	}
+	if err != nil {
+		b.close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *browser) close() {
+	if b == nil {
+		return
+	}
+	if b.cdp != nil {
+		b.cdp.close()
+	}
+	if b.profile != "" {
+		os.RemoveAll(b.profile)
+	}
+}
+
+// navigate loads url and waits for the page to finish loading.
+func (b *browser) navigate(url string) error {
+	var nav struct {
+		ErrorText string `json:"errorText"`
+	}
+	if err := b.cdp.call("Page.navigate", map[string]any{"url": url}, &nav); err != nil {
+		return err
+	}
+	if nav.ErrorText != "" {
+		return fmt.Errorf("loading %s failed: %s", url, nav.ErrorText)
+	}
+	deadline := time.Now().Add(browserLoadTimeout)
+	for {
+		var state string
+		if err := b.eval(`document.readyState`, &state); err != nil {
+			return err
+		}
+		if state == "complete" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not finish loading within %s", url, browserLoadTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// eval runs a JavaScript expression in the page and decodes its value.
+func (b *browser) eval(expr string, result any) error {
+	var reply struct {
+		Result struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"result"`
+		Exception *struct {
+			Text string `json:"text"`
+		} `json:"exceptionDetails"`
+	}
+	if err := b.cdp.call("Runtime.evaluate", map[string]any{"expression": expr, "returnByValue": true}, &reply); err != nil {
+		return err
+	}
+	if reply.Exception != nil {
+		return fmt.Errorf("script error: %s", reply.Exception.Text)
+	}
+	if result == nil || len(reply.Result.Value) == 0 {
+		return nil
+	}
+	return json.Unmarshal(reply.Result.Value, result)
+}
+
+// screenshot captures the viewport, or with full the whole page.
+func (b *browser) screenshot(full bool) (image.Image, image.Rectangle, error) {
+	params := map[string]any{"format": "png"}
+	if full {
+		var metrics struct {
+			Content struct {
+				Width  float64 `json:"width"`
+				Height float64 `json:"height"`
+			} `json:"cssContentSize"`
+		}
+		if err := b.cdp.call("Page.getLayoutMetrics", nil, &metrics); err != nil {
+			return nil, image.Rectangle{}, err
+		}
+		params["captureBeyondViewport"] = true
+		params["clip"] = map[string]any{"x": 0, "y": 0, "width": metrics.Content.Width, "height": metrics.Content.Height, "scale": 1}
+	}
+	var shot struct {
+		Data string `json:"data"`
+	}
+	if err := b.cdp.call("Page.captureScreenshot", params, &shot); err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	data, err := base64.StdEncoding.DecodeString(shot.Data)
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	return img, img.Bounds(), nil
+}
+
+// locateSelector scrolls the first element matching the CSS selector into
+// view and returns its centre in the viewport.
+func (b *browser) locateSelector(selector string) (image.Point, error) {
+	sel, _ := json.Marshal(selector)
+	var box *struct{ X, Y float64 }
+	err := b.eval(fmt.Sprintf(`(() => {
+		const el = document.querySelector(%s);
+		if (!el) return null;
+		el.scrollIntoView({block: "center", inline: "center"});
+		const r = el.getBoundingClientRect();
+		return {X: r.left + r.width / 2, Y: r.top + r.height / 2};
+	})()`, sel), &box)
+	if err != nil {
+		return image.Point{}, err
+	}
+	if box == nil {
+		return image.Point{}, fmt.Errorf("no element matches %q", selector)
+	}
+	return image.Pt(int(box.X), int(box.Y)), nil
+}
+
+func (b *browser) mouse(typ, button string, clicks int, extra map[string]any) error {
+	params := map[string]any{"type": typ, "x": b.pos.X, "y": b.pos.Y, "button": button, "buttons": b.buttons, "clickCount": clicks}
+	for k, v := range extra {
+		params[k] = v
+	}
+	return b.cdp.call("Input.dispatchMouseEvent", params, nil)
+}
+
+func (b *browser) move(x, y int) error {
+	b.pos = image.Pt(x, y)
+	return b.mouse("mouseMoved", "none", 0, nil)
+}
+
+func (b *browser) location() (int, int, error) {
+	return b.pos.X, b.pos.Y, nil
+}
+
+func (b *browser) click(button string, double bool) error {
+	clicks := 1
+	if double {
+		clicks = 2
+	}
+	for n := 1; n <= clicks; n++ {
+		b.buttons |= browserButtons[button]
+		if err := b.mouse("mousePressed", button, n, nil); err != nil {
+			return err
+		}
+		b.buttons &^= browserButtons[button]
+		if err := b.mouse("mouseReleased", button, n, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *browser) toggle(button string, down bool) error {
+	if down {
+		b.buttons |= browserButtons[button]
+		return b.mouse("mousePressed", button, 1, nil)
+	}
+	b.buttons &^= browserButtons[button]
+	return b.mouse("mouseReleased", button, 1, nil)
+}
+
+func (b *browser) keyTap(k keyPress) error {
+	mods := 0
+	for _, m := range k.mods {
+		mods |= browserModifiers[m]
+	}
+	key, code := k.key, 0
+	if bk, ok := browserKeys[k.key]; ok {
+		key, code = bk.key, bk.code
+	} else if len(k.key) == 1 {
+		code = int(strings.ToUpper(k.key)[0])
+	} else if n, ok := strings.CutPrefix(k.key, "f"); ok && n != "" && strings.Trim(n, "0123456789") == "" {
+		key = strings.ToUpper(k.key)
+		var f int
+		fmt.Sscanf(n, "%d", &f)
+		code = 111 + f // F1 is 112
+	} else {
+		return fmt.Errorf("key %s is not supported with --browser", k)
+	}
+
+	down := map[string]any{"type": "keyDown", "key": key, "windowsVirtualKeyCode": code, "modifiers": mods}
+	if len(key) == 1 && mods&^browserModifiers["shift"] == 0 {
+		down["text"] = key
+	}
+	if err := b.cdp.call("Input.dispatchKeyEvent", down, nil); err != nil {
+		return err
+	}
+	return b.cdp.call("Input.dispatchKeyEvent", map[string]any{"type": "keyUp", "key": key, "windowsVirtualKeyCode": code, "modifiers": mods}, nil)
+}
+
+func (b *browser) typeText(text string) error {
+	return b.cdp.call("Input.insertText", map[string]any{"text": text}, nil)
+}
+
+func (b *browser) scroll(n int) error {
+	return b.mouse("mouseWheel", "none", 0, map[string]any{"deltaX": 0, "deltaY": -100 * n})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/go-vgo/robotgo"
+	"github.com/kbinani/screenshot"
+)
+
+// captureRect captures a screen rectangle with the configured backend. In
+// auto mode a failing Wayland capture falls back to the native (X11) path.
+func captureRect(r image.Rectangle, opts options) (image.Image, error) {
+	if opts.useGrim() {
+		img, err := captureGrim(r)
+		if err == nil || opts.backend == "grim" {
+			return img, err
+		}
+	}
+	return screenshot.CaptureRect(r)
+}
+
+// activeDisplays lists the displays captures index into: the Wayland
+// outputs when capturing through grim, otherwise the X11 screens. In auto
+// mode a compositor without an output listing falls back to X11.
+func (o options) activeDisplays() ([]waylandOutput, error) {
+	if o.useGrim() {
+		outputs, err := waylandOutputs()
+		if err == nil || o.backend == "grim" {
+			return outputs, err
+		}
+	}
+	displays := make([]waylandOutput, screenshot.NumActiveDisplays())
+	for i := range displays {
+		displays[i].bounds = screenshot.GetDisplayBounds(i)
+	}
+	return displays, nil
+}
+
+func captureDisplays(displays []int, opts options) (image.Image, image.Rectangle, error) {
+	if opts.useGrim() {
+		img, bounds, err := captureGrimDisplays(displays)
+		if err == nil || opts.backend == "grim" {
+			return img, bounds, err
+		}
+	}
+	if len(displays) == 1 {
+		bounds := screenshot.GetDisplayBounds(displays[0])
+		img, err := screenshot.CaptureRect(bounds)
+		return img, bounds, err
+	}
+
+	var union image.Rectangle
+	for _, d := range displays {
+		union = union.Union(screenshot.GetDisplayBounds(d))
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, union.Dx(), union.Dy()))
+	for _, d := range displays {
+		bounds := screenshot.GetDisplayBounds(d)
+		img, err := screenshot.CaptureRect(bounds)
+		if err != nil {
+			return nil, union, fmt.Errorf("display %d: %w", d, err)
+		}
+		draw.Draw(canvas, bounds.Sub(union.Min), img, img.Bounds().Min, draw.Src)
+	}
+	return canvas, union, nil
+}
+
+func activeWindowBounds() (image.Rectangle, error) {
+	pid := robotgo.GetPid()
+	x, y, w, h := robotgo.GetBounds(pid)
+	if w <= 0 || h <= 0 {
+		return image.Rectangle{}, fmt.Errorf("could not get bounds of active window (pid %d)", pid)
+	}
+	return image.Rect(x, y, x+w, y+h), nil
+}
+
+// captureImage returns the captured image and the screen area it covers.
+func captureImage(opts options) (image.Image, image.Rectangle, error) {
+	var bounds image.Rectangle
+	var err error
+	switch {
+	case opts.browser != nil:
+		return opts.browser.screenshot(true)
+	case !opts.region.Empty():
+		bounds = opts.region
+	case opts.targetPid > 0:
+		bounds, err = windowClientBounds(opts.targetPid)
+	case opts.activeWindow:
+		bounds, err = activeWindowBounds()
+	default:
+		return captureDisplays(opts.displays(), opts)
+	}
+	if err != nil {
+		return nil, bounds, err
+	}
+
+	img, err := captureRect(bounds, opts)
+	return img, bounds, err
+}
+
+func withStderrSilenced(fn func()) {
+	oldStderr := os.Stderr
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err == nil {
+		os.Stderr = devNull
+	}
+
+	fn()
+
+	if devNull != nil {
+		os.Stderr = oldStderr
+		devNull.Close()
+	}
+}
+
+// captureFrame captures and processes frame index, returning the raw capture
+// alongside the processed image; dup reports a repeat of dedupe's last
+// frame (see finishFrame).
+func captureFrame(index int, opts options, dedupe *deduper) (raw, img image.Image, dup bool, err error) {
+	var bounds image.Rectangle
+	withStderrSilenced(func() {
+		if opts.scrollCapture {
+			raw, bounds, err = captureScrolling(opts)
+		} else {
+			raw, bounds, err = captureImage(opts)
+		}
+	})
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("screenshot capture failed: %w", err)
+	}
+
+	img, dup, err = finishFrame(raw, bounds, index, opts, dedupe)
+	if err != nil {
+		return raw, nil, false, fmt.Errorf("processing capture failed: %w", err)
+	}
+	return raw, img, dup, nil
+}
+
+func saveImage(filePath string, img image.Image, opts options) error {
+	if _, ok := externalEncoders[opts.format]; ok {
+		return encodeExternal(filePath, img, opts)
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	return encodeImage(file, img, opts)
+}
+
+func encodeImage(w io.Writer, img image.Image, opts options) error {
+	var buf bytes.Buffer
+	switch opts.format {
+	case "jpeg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.quality}); err != nil {
+			return fmt.Errorf("failed to encode JPEG: %w", err)
+		}
+	default:
+		enc := png.Encoder{CompressionLevel: opts.pngLevel}
+		if err := enc.Encode(&buf, img); err != nil {
+			return fmt.Errorf("failed to encode PNG: %w", err)
+		}
+	}
+
+	data := buf.Bytes()
+	if opts.iccProfile != nil {
+		if opts.format == "jpeg" {
+			data = tagJPEG(data, colorTag(opts))
+		} else {
+			data = tagPNG(data, colorTag(opts))
+		}
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// pickRegion asks for the corners of the capture area, reading Enter
+// presses from reader.
+func pickRegion(reader *bufio.Reader) (image.Rectangle, error) {
+	corner := func(name string) (image.Point, error) {
+		fmt.Printf("Move the mouse to the %s corner of the capture area and press Enter...", name)
+		if _, err := reader.ReadString('\n'); err != nil {
+			return image.Point{}, err
+		}
+		x, y := robotgo.Location()
+		fmt.Printf(" (%d,%d)\n", x, y)
+		return image.Pt(x, y), nil
+	}
+
+	p1, err := corner("top-left")
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	p2, err := corner("bottom-right")
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	r := image.Rectangle{Min: p1, Max: p2}.Canon()
+	if r.Empty() {
+		return image.Rectangle{}, fmt.Errorf("selected area is empty")
+	}
+	return r, nil
+}
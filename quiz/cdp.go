@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// cdpConn speaks the Chrome DevTools Protocol over the pipes Chrome opens
+// with --remote-debugging-pipe: it reads commands on fd 3 and writes
+// replies and events on fd 4, each a JSON message ended by a NUL byte.
+type cdpConn struct {
+	cmd     *exec.Cmd
+	w       io.WriteCloser
+	r       *bufio.Reader
+	id      int
+	session string // page session commands are sent to
+}
+
+type cdpMessage struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// startCDP starts Chrome with args and connects to it.
+func startCDP(bin string, args []string) (*cdpConn, error) {
+	cmdR, cmdW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(bin, append([]string{"--remote-debugging-pipe"}, args...)...)
+	cmd.ExtraFiles = []*os.File{cmdR, outW}
+	err = cmd.Start()
+	cmdR.Close()
+	outW.Close()
+	if err != nil {
+		cmdW.Close()
+		outR.Close()
+		return nil, fmt.Errorf("starting %s failed: %w", bin, err)
+	}
+	return &cdpConn{cmd: cmd, w: cmdW, r: bufio.NewReader(outR)}, nil
+}
+
+// call sends a command to the page session (or the browser while there is
+// none) and decodes its result into result, skipping events.
+func (c *cdpConn) call(method string, params, result any) error {
+	c.id++
+	msg := map[string]any{"id": c.id, "method": method, "params": params}
+	if params == nil {
+		msg["params"] = struct{}{}
+	}
+	if c.session != "" {
+		msg["sessionId"] = c.session
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := c.w.Write(append(data, 0)); err != nil {
+		return fmt.Errorf("%s: browser closed: %w", method, err)
+	}
+
+	for {
+		data, err := c.r.ReadBytes(0)
+		if err != nil {
+			return fmt.Errorf("%s: browser closed: %w", method, err)
+		}
+		var reply cdpMessage
+		if err := json.Unmarshal(data[:len(data)-1], &reply); err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+		if reply.ID != c.id {
+			continue
+		}
+		if reply.Error != nil {
+			return fmt.Errorf("%s: %s", method, reply.Error.Message)
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(reply.Result, result)
+	}
+}
+
+// close asks Chrome to quit and waits for it.
+func (c *cdpConn) close() {
+	c.session = ""
+	c.call("Browser.close", nil, nil)
+	c.w.Close()
+	c.cmd.Wait()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	changePollInterval = 100 * time.Millisecond
+	changeSampleStep   = 4  // compare every 4th pixel in each direction
+	changePixelDelta   = 24 // per-channel difference that counts as changed
+)
+
+// diffFraction returns the fraction of sampled pixels that differ between a and b.
+func diffFraction(a, b image.Image) float64 {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Size() != bb.Size() {
+		return 1
+	}
+
+	var changed, total int
+	for y := 0; y < ab.Dy(); y += changeSampleStep {
+		for x := 0; x < ab.Dx(); x += changeSampleStep {
+			r1, g1, b1, _ := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, _ := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			if absDiff(r1, r2) > changePixelDelta<<8 || absDiff(g1, g2) > changePixelDelta<<8 || absDiff(b1, b2) > changePixelDelta<<8 {
+				changed++
+			}
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(changed) / float64(total)
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// waitForChange polls the capture area until it differs from previous by more
+// than the configured threshold, or the timeout expires.
+func waitForChange(previous image.Image, opts options) error {
+	deadline := time.Now().Add(opts.changeTimeout)
+	for {
+		var current image.Image
+		var err error
+		withStderrSilenced(func() {
+			current, _, err = captureImage(opts)
+		})
+		if err == nil && diffFraction(previous, current) > opts.changeThreshold {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("screen did not change within %s", opts.changeTimeout)
+		}
+		time.Sleep(changePollInterval)
+	}
+}
+
+// awaitChange runs waitForChange after an action. A dry run clicks nothing,
+// so the screen would never change; it only reports the wait.
+func (s *session) awaitChange(previous image.Image) error {
+	if s.opts.dryRun {
+		slog.Info("Would wait for the screen to change")
+		return nil
+	}
+	return waitForChange(previous, s.opts)
+}
+
+// screenSettled reports whether the last --stop-unchanged iterations all
+// captured the same screen as the one before, i.e. the quiz has ended. The
+// repeated captures saved since files[before] are dropped and deleted.
+// frame is the capture as taken, without the stamp, masks or cursor.
+func (s *session) screenSettled(frame image.Image, before int) bool {
+	if s.settled == nil || frame == nil {
+		return false
+	}
+	if !s.settled.duplicate(frame) {
+		s.unchanged, s.repeats = 0, nil
+		return false
+	}
+	s.unchanged++
+	s.repeats = append(s.repeats, s.files[before:]...)
+	if s.unchanged < s.opts.stopUnchanged {
+		return false
+	}
+
+	slog.Info(fmt.Sprintf("Screen unchanged for %d capture(s), stopping", s.unchanged))
+	// Streamed pages are already in the PDF.
+	if s.stream == nil && len(s.repeats) > 0 {
+		s.files = s.files[:len(s.files)-len(s.repeats)]
+		if !s.opts.dryRun {
+			for _, f := range s.repeats {
+				os.Remove(f)
+			}
+		}
+		slog.Info(fmt.Sprintf("Discarded %d repeated capture(s)", len(s.repeats)))
+	}
+	return true
+}
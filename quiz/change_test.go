@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestStopUnchangedStamped checks that --stop-unchanged still sees a
+// settled screen when every saved capture carries a different stamp.
+func TestStopUnchangedStamped(t *testing.T) {
+	dir := t.TempDir()
+	opts := options{stopUnchanged: 2, stamp: "{index}", stampPos: "top-left", stampSize: 12, dedupe: "off"}
+	s := &session{opts: opts, settled: &deduper{mode: "exact"}}
+	raw := noiseImage(64, 48)
+	for i, want := range []bool{false, false, true} {
+		before := len(s.files)
+		img, _, err := finishFrame(raw, raw.Bounds(), i+1, opts, newDeduper(opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("Q_%d.png", i+1))
+		if err := saveImage(path, img, opts); err != nil {
+			t.Fatal(err)
+		}
+		s.files = append(s.files, path)
+		if got := s.screenSettled(raw, before); got != want {
+			t.Errorf("capture %d: settled = %v, want %v", i+1, got, want)
+		}
+	}
+	if len(s.files) != 1 {
+		t.Errorf("kept %v, want the first capture only", s.files)
+	}
+	for _, f := range []string{"Q_2.png", "Q_3.png"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); !os.IsNotExist(err) {
+			t.Errorf("repeated capture %s not deleted", f)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cleanupImages applies the --cleanup policy to the session's screenshots
+// once the PDF is written: delete them, keep them in place, or move them
+// into a folder named after the PDF.
+func cleanupImages(files []string, pdfPath string, opts options) {
+	switch opts.cleanup {
+	case "keep":
+		return
+	case "move":
+		dir := strings.TrimSuffix(pdfPath, filepath.Ext(pdfPath))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			slog.Error("creating image folder", "err", err, "dir", dir)
+			return
+		}
+		for _, file := range files {
+			if err := os.Rename(file, filepath.Join(dir, filepath.Base(file))); err != nil {
+				slog.Error("moving file", "err", err, "file", file)
+			}
+		}
+		slog.Info("Screenshots moved", "dir", dir)
+	default:
+		for _, file := range files {
+			if err := os.Remove(file); err != nil {
+				slog.Error("deleting file", "err", err, "file", file)
+			}
+		}
+	}
+}
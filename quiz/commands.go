@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// command is one subcommand: `automate NAME ARGS...`.
+type command struct {
+	name    string
+	args    string // usage after the name
+	summary string
+	run     func(args []string)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "[flags] [number_of_repetitions]", "capture a quiz session and build the PDF (the default)", runCommand},
+		{"assemble", "[flags] IMAGE...", "build the PDF and other outputs from existing images", assembleCommand},
+		{"init", "[CONFIG_FILE]", "set up the config file by answering a few questions", initCommand},
+		{"profile", "add NAME [flags] | list | delete NAME", "save, list or delete named sets of run flags", profileCommand},
+		{"doctor", "", "check the display, hotkeys and optional tools", doctorCommand},
+		{"displays", "", "list display indexes and bounds", func([]string) { printDisplays(options{backend: "auto"}) }},
+		{"save-macro", "[NAME SCRIPT_FILE]", "save a script as a named macro, or list the saved macros", func(args []string) {
+			if err := saveMacro(args); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}},
+		{"completion", "bash|zsh|fish|powershell", "print a shell completion script", completionCommand},
+		{"man", "[DIR]", "print the manual page, or write it into DIR", manCommand},
+		{"help", "[COMMAND]", "show help for a command", helpCommand},
+	}
+}
+
+func lookupCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func main() {
+	args := os.Args[1:]
+	// Without a command name, flags and a count mean run, as before
+	// subcommands existed.
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if _, err := strconv.Atoi(args[0]); err != nil {
+			name, args = args[0], args[1:]
+		}
+	}
+	cmd := lookupCommand(name)
+	if cmd == nil {
+		fmt.Printf("Error: unknown command %q\n", name)
+		usage()
+		os.Exit(1)
+	}
+	cmd.run(args)
+}
+
+func (c *command) usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s\n\n%s.\n", strings.TrimSpace(progName()+" "+c.name+" "+c.args), strings.ToUpper(c.summary[:1])+c.summary[1:])
+}
+
+func progName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// newFlagSet returns the flag set of a command, whose usage names it.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		cmd := lookupCommand(name)
+		cmd.usage(fs.Output())
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func usage() {
+	fmt.Printf("Usage: %s COMMAND [flags] [args]\n\nCommands:\n", progName())
+	for _, cmd := range commands {
+		fmt.Printf("  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Printf("\nWithout a command, %s runs `run`. See `%s help COMMAND` for a command's flags.\n", progName(), progName())
+}
+
+func helpCommand(args []string) {
+	if len(args) == 0 {
+		usage()
+		return
+	}
+	cmd := lookupCommand(args[0])
+	switch {
+	case cmd == nil:
+		fmt.Printf("Error: unknown command %q\n", args[0])
+		usage()
+		os.Exit(1)
+	case cmd.name == "run" || cmd.name == "assemble":
+		fs := newFlagSet(cmd.name)
+		fs.SetOutput(os.Stdout)
+		defineFlags(fs, &options{})
+		fs.Usage()
+	default:
+		cmd.usage(os.Stdout)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// commandFlags returns the flags of a command, sorted by name.
+func commandFlags(name string) []*flag.Flag {
+	if name != "run" && name != "assemble" {
+		return nil
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	defineFlags(fs, &options{})
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+	return flags
+}
+
+func isBoolFlag(v flag.Value) bool {
+	b, ok := v.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func flagNames(f []*flag.Flag) string {
+	names := make([]string, len(f))
+	for i, fl := range f {
+		names[i] = "--" + fl.Name
+	}
+	return strings.Join(names, " ")
+}
+
+func commandNames() string {
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.name
+	}
+	return strings.Join(names, " ")
+}
+
+// completionCommand implements `completion SHELL`.
+func completionCommand(args []string) {
+	fs := newFlagSet("completion")
+	fs.Parse(args)
+	shells := map[string]func(io.Writer, string){
+		"bash":       bashCompletion,
+		"zsh":        zshCompletion,
+		"fish":       fishCompletion,
+		"powershell": powershellCompletion,
+	}
+	gen, ok := shells[fs.Arg(0)]
+	if fs.NArg() != 1 || !ok {
+		fmt.Printf("Error: usage: %s completion bash|zsh|fish|powershell\n", progName())
+		os.Exit(1)
+	}
+	gen(os.Stdout, progName())
+}
+
+var nonIdent = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func bashCompletion(w io.Writer, prog string) {
+	fn := "_" + nonIdent.ReplaceAllString(prog, "_")
+	fmt.Fprintf(w, `# bash completion for %[1]s; load with: source <(%[1]s completion bash)
+%[2]s() {
+    local cur=${COMP_WORDS[COMP_CWORD]} cmd="" w
+    for w in "${COMP_WORDS[@]:1:COMP_CWORD-1}"; do
+        case $w in
+            -*|[0-9]*) ;;
+            *) cmd=$w; break ;;
+        esac
+    done
+    local flags=""
+    case $cmd in
+        ""|run) flags=%[3]q ;;
+        assemble) flags=%[4]q ;;
+        help) COMPREPLY=($(compgen -W %[5]q -- "$cur")); return ;;
+        completion) COMPREPLY=($(compgen -W "bash zsh fish powershell" -- "$cur")); return ;;
+        profile) COMPREPLY=($(compgen -W "add list delete" -- "$cur")); return ;;
+    esac
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    elif [[ -z $cmd && $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W %[5]q -- "$cur"))
+    else
+        COMPREPLY=($(compgen -f -- "$cur"))
+    fi
+}
+complete -o filenames -F %[2]s %[1]s
+`, prog, fn, flagNames(commandFlags("run")), flagNames(commandFlags("assemble")), commandNames())
+}
+
+func zshCompletion(w io.Writer, prog string) {
+	fn := "_" + nonIdent.ReplaceAllString(prog, "_")
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'" }
+	escape := strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace
+	fmt.Fprintf(w, "#compdef %s\n# zsh completion for %s; load with: source <(%s completion zsh)\n\n", prog, prog, prog)
+	for _, name := range []string{"run", "assemble"} {
+		fmt.Fprintf(w, "%s_%s_flags=(\n", fn, name)
+		for _, f := range commandFlags(name) {
+			arg, usage := flag.UnquoteUsage(f)
+			spec := "--" + f.Name + "[" + escape(usage) + "]"
+			if !isBoolFlag(f.Value) {
+				if arg == "" {
+					arg = "value"
+				}
+				spec = "--" + f.Name + "=[" + escape(usage) + "]:" + escape(arg) + ":_files"
+			}
+			fmt.Fprintf(w, "  %s\n", quote(spec))
+		}
+		fmt.Fprintln(w, ")")
+	}
+	fmt.Fprintf(w, "\n%s() {\n  local -a cmds\n  cmds=(\n", fn)
+	for _, c := range commands {
+		fmt.Fprintf(w, "    %s\n", quote(c.name+":"+escape(c.summary)))
+	}
+	fmt.Fprintf(w, `  )
+  if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then
+    _describe command cmds
+    return
+  fi
+  local cmd=run
+  [[ $words[2] != -* && $words[2] != [0-9]* ]] && cmd=$words[2]
+  case $cmd in
+    run|assemble)
+      local -a cmdflags
+      cmdflags=("${(@P)${:-%[1]s_${cmd}_flags}}")
+      _arguments -s $cmdflags '*:file:_files' ;;
+    help) _describe command cmds ;;
+    completion) compadd bash zsh fish powershell ;;
+    profile) (( CURRENT == 3 )) && compadd add list delete ;;
+    *) _files ;;
+  esac
+}
+compdef %[1]s %[2]s
+`, fn, prog)
+}
+
+func fishCompletion(w io.Writer, prog string) {
+	quote := func(s string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+	}
+	names := commandNames()
+	fmt.Fprintf(w, "# fish completion for %s; load with: %s completion fish | source\n", prog, prog)
+	for _, c := range commands {
+		fmt.Fprintf(w, "complete -c %s -f -n __fish_use_subcommand -a %s -d %s\n", prog, c.name, quote(c.summary))
+	}
+	fmt.Fprintf(w, "complete -c %s -f -n '__fish_seen_subcommand_from help' -a %q\n", prog, names)
+	fmt.Fprintf(w, "complete -c %s -f -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish powershell'\n", prog)
+	fmt.Fprintf(w, "complete -c %s -f -n '__fish_seen_subcommand_from profile; and not __fish_seen_subcommand_from add list delete' -a 'add list delete'\n", prog)
+	conditions := map[string]string{
+		"run":      "'not __fish_seen_subcommand_from " + strings.TrimPrefix(names, "run ") + "'",
+		"assemble": "'__fish_seen_subcommand_from assemble'",
+	}
+	for _, name := range []string{"run", "assemble"} {
+		for _, f := range commandFlags(name) {
+			_, usage := flag.UnquoteUsage(f)
+			line := fmt.Sprintf("complete -c %s -n %s -l %s -d %s", prog, conditions[name], f.Name, quote(usage))
+			if !isBoolFlag(f.Value) {
+				line += " -r"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+func powershellCompletion(w io.Writer, prog string) {
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	list := func(flags []*flag.Flag) string {
+		q := make([]string, len(flags))
+		for i, f := range flags {
+			q[i] = quote("--" + f.Name)
+		}
+		return "@(" + strings.Join(q, ", ") + ")"
+	}
+	fmt.Fprintf(w, "# PowerShell completion for %s; load with: %s completion powershell | Out-String | Invoke-Expression\n", prog, prog)
+	fmt.Fprintf(w, "Register-ArgumentCompleter -Native -CommandName %s -ScriptBlock {\n", quote(prog))
+	fmt.Fprintln(w, "    param($wordToComplete, $commandAst, $cursorPosition)")
+	fmt.Fprintln(w, "    $commands = [ordered]@{")
+	for _, c := range commands {
+		fmt.Fprintf(w, "        %s = %s\n", quote(c.name), quote(c.summary))
+	}
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintf(w, "    $flags = @{ 'run' = %s; 'assemble' = %s }\n", list(commandFlags("run")), list(commandFlags("assemble")))
+	fmt.Fprint(w, `    $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    $cmd = 'run'
+    if ($words.Count -gt 1 -and $commands.Contains($words[1]) -and $words[1] -ne $wordToComplete) { $cmd = $words[1] }
+    if ($wordToComplete -like '-*') {
+        $flags[$cmd] | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterName', $_)
+        }
+    } elseif ($words.Count -eq 1 -or ($words.Count -eq 2 -and $wordToComplete)) {
+        $commands.Keys | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $commands[$_])
+        }
+    }
+}
+`)
+}
+
+// manCommand implements `man [DIR]`: it prints the manual page, or writes
+// it into DIR as PROG.1.
+func manCommand(args []string) {
+	fs := newFlagSet("man")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fmt.Printf("Error: usage: %s man [DIR]\n", progName())
+		os.Exit(1)
+	}
+	if fs.NArg() == 0 {
+		writeMan(os.Stdout, progName(), time.Now())
+		return
+	}
+	path := filepath.Join(fs.Arg(0), progName()+".1")
+	f, err := os.Create(path)
+	if err == nil {
+		writeMan(f, progName(), time.Now())
+		err = f.Close()
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s\n", path)
+}
+
+var roffEscape = strings.NewReplacer(`\`, `\e`, "-", `\-`)
+
+// roff escapes s for a roff text line.
+func roff(s string) string {
+	s = roffEscape.Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// writeMan writes the manual page from the command table and flag
+// definitions.
+func writeMan(w io.Writer, prog string, now time.Time) {
+	up := strings.ToUpper(prog)
+	fmt.Fprintf(w, ".TH %s 1 %q %q %q\n", up, now.Format("2006-01-02"), prog, "User Commands")
+	fmt.Fprintf(w, ".SH NAME\n%s \\- capture a quiz session as screenshots and build a PDF\n", roff(prog))
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	for _, c := range commands {
+		fmt.Fprintf(w, ".B %s %s\n", roff(prog), roff(c.name))
+		if c.args != "" {
+			fmt.Fprintln(w, roff(c.args))
+		}
+		fmt.Fprintln(w, ".br")
+	}
+	fmt.Fprintf(w, ".SH DESCRIPTION\n%s takes a screenshot, advances the quiz (a click, key press or script) and repeats, then builds a PDF and other outputs from the captures. Without a command name it runs\n.BR run .\n", roff(prog))
+	fmt.Fprintln(w, ".SH COMMANDS")
+	for _, c := range commands {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s.\n", roff(c.name), roff(strings.ToUpper(c.summary[:1])+c.summary[1:]))
+	}
+	fmt.Fprintln(w, ".SH OPTIONS\nThese flags apply to\n.B run\nand\n.BR assemble .")
+	for _, f := range commandFlags("run") {
+		arg, usage := flag.UnquoteUsage(f)
+		fmt.Fprintf(w, ".TP\n.B \\-\\-%s", roff(f.Name))
+		if arg != "" && !isBoolFlag(f.Value) {
+			fmt.Fprintf(w, " \\fI%s\\fR", roff(arg))
+		}
+		fmt.Fprintf(w, "\n%s", roff(usage))
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+			fmt.Fprintf(w, " (default: %s)", roff(f.DefValue))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, `.SH ENVIRONMENT
+Every flag can be set with an environment variable named after it: QUIZ_ and the flag name in capitals with underscores, such as
+.BR QUIZ_OUT_DIR .
+The repeatable \-\-mask and \-\-do take values separated by semicolons. Flags override the environment, which overrides the profile, then the config file.
+.SH FILES
+.TP
+.I ~/.config/clitoolbox/quiz.yaml
+Default flag values for run and assemble, as written by
+.BR "%[1]s init" .
+.TP
+.I ~/.config/clitoolbox/profiles
+Profiles saved with
+.BR "%[1]s profile add" ,
+one YAML file each, used with \-\-profile.
+.TP
+.I ~/.config/clitoolbox/macros
+Scripts saved with
+.BR "%[1]s save\-macro" .
+`, roff(prog))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// envPrefix starts the environment variables that stand in for flags:
+// QUIZ_OUT_DIR for --out-dir and so on.
+const envPrefix = "QUIZ_"
+
+// repeatableFlags take several values from one environment variable,
+// separated by semicolons.
+var repeatableFlags = map[string]bool{"mask": true, "do": true}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadEnv sets the flags in fs that were not given on the command line
+// from QUIZ_* environment variables.
+func loadEnv(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		values := []string{v}
+		if repeatableFlags[f.Name] {
+			values = strings.Split(v, ";")
+		}
+		for _, v := range values {
+			if serr := fs.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("invalid %s: %w", envName(f.Name), serr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// defaultConfigFile is where defaults for run and assemble are read from
+// when --config is not given: clitoolbox/quiz.yaml in the user's config
+// directory.
+func defaultConfigFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "clitoolbox", "quiz.yaml"), nil
+}
+
+// loadConfig sets the flags in fs that were not given on the command line
+// from a config file: a YAML mapping of flag names to values, with lists
+// for repeatable flags such as mask and do. A missing default file is not
+// an error.
+func loadConfig(fs *flag.FlagSet, path string) error {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = defaultConfigFile(); err != nil {
+			return nil
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("invalid --config: %w", err)
+	}
+	return applyConfig(fs, path, data)
+}
+
+// loadProfile sets the flags in fs that were not given on the command
+// line or in the environment from the saved profile name.
+func loadProfile(fs *flag.FlagSet, name string) error {
+	path, err := profileFile(name)
+	if err != nil {
+		return fmt.Errorf("invalid --profile: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("invalid --profile: %w", missingProfile(name))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid --profile: %w", err)
+	}
+	return applyConfig(fs, path, data)
+}
+
+// applyConfig sets the flags in fs that are not set yet from the config
+// file data read from path.
+func applyConfig(fs *flag.FlagSet, path string, data []byte) error {
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	if doc == nil {
+		return nil
+	}
+	m, ok := doc.(map[string]any)
+	if !ok {
+		return fmt.Errorf("config %s: want a mapping of flag names to values", path)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fs.Lookup(name) == nil || name == "config" || name == "profile" {
+			return fmt.Errorf("config %s: unknown option %q", path, name)
+		}
+		if set[name] {
+			continue // the command line wins
+		}
+		var values []any
+		switch v := m[name].(type) {
+		case nil:
+			values = []any{""}
+		case string:
+			values = []any{v}
+		case []any:
+			values = v
+		default:
+			return fmt.Errorf("config %s: %s: want a value or a list", path, name)
+		}
+		for _, v := range values {
+			s, ok := v.(string)
+			if !ok && v != nil {
+				return fmt.Errorf("config %s: %s: list items must be values", path, name)
+			}
+			if err := fs.Set(name, s); err != nil {
+				return fmt.Errorf("config %s: %s: %w", path, name, err)
+			}
+		}
+	}
+	return nil
+}
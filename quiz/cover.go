@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// coverHidden lists flags whose values never appear on the cover page.
+var coverHidden = map[string]bool{"pdf-password": true, "pdf-owner-password": true}
+
+// addCover writes a title page describing the session: title, time, machine,
+// capture count and the flags it was run with.
+func addCover(pdf *gofpdf.Fpdf, captures int, now time.Time, opts options) {
+	tr := textEncoder(pdf, opts)
+	size := tocPageSize(opts)
+	width := size.Wd - 2*tocMargin
+	font := fontFamily(opts)
+
+	pdf.AddPageFormat("P", size)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetXY(tocMargin, size.Ht/4)
+	title := opts.title
+	if title == "" {
+		title = "Capture session"
+	}
+	pdf.SetFont(font, "B", 28)
+	pdf.MultiCell(width, 34, tr(title), "", "C", false)
+	pdf.Ln(tocLineHeight)
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	rows := [][2]string{
+		{"Date", now.Format("2006-01-02 15:04:05")},
+		{"Machine", fmt.Sprintf("%s (%s/%s)", host, runtime.GOOS, runtime.GOARCH)},
+		{"Captures", fmt.Sprint(captures)},
+	}
+	settings := "defaults"
+	if len(opts.settings) > 0 {
+		settings = strings.Join(opts.settings, " ")
+	}
+	rows = append(rows, [2]string{"Settings", settings})
+
+	labelWidth := 90.0
+	for _, r := range rows {
+		pdf.SetX(tocMargin)
+		pdf.SetFont(font, "B", tocFontSize)
+		pdf.CellFormat(labelWidth, tocLineHeight, r[0], "", 0, "L", false, 0, "")
+		pdf.SetFont(font, "", tocFontSize)
+		pdf.MultiCell(width-labelWidth, tocLineHeight, tr(r[1]), "", "L", false)
+	}
+}
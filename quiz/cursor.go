@@ -0,0 +1,65 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// cursorImage is the pointer sprite, its hotspot and its screen position.
+type cursorImage struct {
+	img      image.Image
+	hot      image.Point
+	position image.Point
+}
+
+// arrowCursor is a plain arrow used when the platform cursor image is unavailable.
+var arrowCursor = []string{
+	"X           ",
+	"XX          ",
+	"X.X         ",
+	"X..X        ",
+	"X...X       ",
+	"X....X      ",
+	"X.....X     ",
+	"X......X    ",
+	"X.......X   ",
+	"X........X  ",
+	"X.....XXXXX ",
+	"X..X..X     ",
+	"X.X X..X    ",
+	"XX  X..X    ",
+	"X    X..X   ",
+	"     X..X   ",
+	"      XX    ",
+}
+
+func fallbackCursor() cursorImage {
+	img := image.NewRGBA(image.Rect(0, 0, len(arrowCursor[0]), len(arrowCursor)))
+	for y, row := range arrowCursor {
+		for x, c := range row {
+			switch c {
+			case 'X':
+				img.Set(x, y, color.Black)
+			case '.':
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	x, y := robotgo.Location()
+	return cursorImage{img: img, position: image.Pt(x, y)}
+}
+
+func drawCursor(dst *image.RGBA, bounds image.Rectangle) *image.RGBA {
+	cur, err := platformCursor()
+	if err != nil {
+		cur = fallbackCursor()
+	}
+
+	topLeft := cur.position.Sub(cur.hot).Sub(bounds.Min)
+	r := cur.img.Bounds().Sub(cur.img.Bounds().Min).Add(topLeft)
+	draw.Draw(dst, r, cur.img, cur.img.Bounds().Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xfixes"
+)
+
+func platformCursor() (cursorImage, error) {
+	c, err := xgb.NewConn()
+	if err != nil {
+		return cursorImage{}, err
+	}
+	defer c.Close()
+
+	if err := xfixes.Init(c); err != nil {
+		return cursorImage{}, err
+	}
+	if _, err := xfixes.QueryVersion(c, 4, 0).Reply(); err != nil {
+		return cursorImage{}, err
+	}
+	reply, err := xfixes.GetCursorImage(c).Reply()
+	if err != nil {
+		return cursorImage{}, err
+	}
+	w, h := int(reply.Width), int(reply.Height)
+	if w == 0 || h == 0 || len(reply.CursorImage) < w*h {
+		return cursorImage{}, fmt.Errorf("empty cursor image")
+	}
+
+	// XFixes returns premultiplied ARGB, one uint32 per pixel.
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i, p := range reply.CursorImage[:w*h] {
+		img.SetRGBA(i%w, i/w, color.RGBA{
+			R: uint8(p >> 16),
+			G: uint8(p >> 8),
+			B: uint8(p),
+			A: uint8(p >> 24),
+		})
+	}
+
+	return cursorImage{
+		img:      img,
+		hot:      image.Pt(int(reply.Xhot), int(reply.Yhot)),
+		position: image.Pt(int(reply.X), int(reply.Y)),
+	}, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func platformCursor() (cursorImage, error) {
+	return cursorImage{}, errors.New("cursor image not available on this platform")
+}
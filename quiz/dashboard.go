@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	dashboardThumbWidth  = 48 // thumbnail columns; each cell shows two pixel rows
+	dashboardThumbRows   = 14
+	dashboardErrorLines  = 4
+	dashboardLogLines    = 6
+	dashboardDefaultCols = 100
+	dashboardDefaultRows = 40
+)
+
+// dashboard is the --progress tui screen: progress, the last capture as a
+// thumbnail, recent errors and log lines, redrawn in place on the
+// terminal's alternate screen. p pauses and resumes, q (or Ctrl-C, which
+// raw mode delivers as a key) stops the session.
+type dashboard struct {
+	mu         sync.Mutex
+	out        io.Writer
+	bar        *progressBar // progress figures, rendered into the dashboard
+	cols, rows int
+	active     bool
+	state      *term.State // terminal settings to restore
+	done       chan struct{}
+	resize     chan os.Signal
+
+	pause chan struct{}
+	stop  chan struct{}
+
+	status string
+	last   string // last capture file and size
+	thumb  []string
+	errors []string
+	lines  []string
+}
+
+func newDashboard(total int) (*dashboard, error) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return nil, fmt.Errorf("--progress tui needs a terminal")
+	}
+	return &dashboard{
+		out:    os.Stdout,
+		bar:    newProgressBar(io.Discard, total),
+		cols:   dashboardDefaultCols,
+		rows:   dashboardDefaultRows,
+		resize: make(chan os.Signal, 1),
+		pause:  make(chan struct{}, 1),
+		stop:   make(chan struct{}, 1),
+		status: "Starting",
+	}, nil
+}
+
+// start switches the terminal to the dashboard and reads key presses.
+func (d *dashboard) start() error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return fmt.Errorf("setting up the terminal: %w", err)
+	}
+	if len(resizeSignals) > 0 {
+		signal.Notify(d.resize, resizeSignals...)
+	}
+
+	d.mu.Lock()
+	d.state, d.active, d.done = state, true, make(chan struct{})
+	d.measure()
+	io.WriteString(d.out, "\033[?1049h\033[?25l")
+	d.draw()
+	d.mu.Unlock()
+	go d.readKeys()
+	go d.tick(d.done)
+	return nil
+}
+
+// measure reads the terminal size, keeping the last known one if that
+// fails.
+func (d *dashboard) measure() {
+	if cols, rows, err := term.GetSize(int(os.Stdout.Fd())); err == nil && cols > 0 && rows > 0 {
+		d.cols, d.rows = cols, rows
+	}
+}
+
+// close restores the terminal; later log lines print normally.
+func (d *dashboard) close() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.active {
+		return
+	}
+	d.active = false
+	close(d.done)
+	signal.Stop(d.resize)
+	io.WriteString(d.out, "\033[?25h\033[?1049l")
+	term.Restore(int(os.Stdin.Fd()), d.state)
+	// What the dashboard showed would otherwise vanish with the alternate
+	// screen.
+	fmt.Fprintln(d.out, d.progress())
+	for _, e := range d.errors {
+		fmt.Fprintln(d.out, "Error: "+e)
+	}
+}
+
+func (d *dashboard) readKeys() {
+	buf := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(buf); err != nil {
+			return
+		}
+		var ch chan struct{}
+		switch buf[0] {
+		case 'p', 'P', ' ':
+			ch = d.pause
+		case 'q', 'Q', 3: // Ctrl-C
+			ch = d.stop
+		default:
+			continue
+		}
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (d *dashboard) tick(done <-chan struct{}) {
+	t := time.NewTicker(progressBarRefresh)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			d.mu.Lock()
+			d.draw()
+			d.mu.Unlock()
+		case <-d.resize:
+			d.mu.Lock()
+			d.measure()
+			io.WriteString(d.out, "\033[2J")
+			d.draw()
+			d.mu.Unlock()
+		}
+	}
+}
+
+// Write keeps log lines for the log pane, or prints them while the
+// dashboard is not shown.
+func (d *dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.active {
+		return d.out.Write(p)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		d.lines = appendRecent(d.lines, line, dashboardLogLines)
+	}
+	d.draw()
+	return len(p), nil
+}
+
+func (d *dashboard) event(e logEvent) {
+	d.bar.event(e)
+	var thumb []string
+	var size image.Point
+	if e.Type == "capture" {
+		if img, err := decodeImageFile(e.File); err == nil {
+			thumb, size = renderThumb(img), img.Bounds().Size()
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch e.Type {
+	case "iteration":
+		d.status = fmt.Sprintf("Running iteration %d", e.Capture)
+	case "capture":
+		d.last = fmt.Sprintf("%s (%dx%d)", e.File, size.X, size.Y)
+		d.thumb = thumb
+	case "error", "failed":
+		d.errors = appendRecent(d.errors, fmt.Sprintf("[%d] %s", e.Capture, e.Error), dashboardErrorLines)
+	case "pause":
+		d.status = "Paused, press p to resume"
+	case "resume":
+		d.status = "Resumed"
+	case "end":
+		d.status = "Finished, building the outputs"
+	}
+	if d.active {
+		d.draw()
+	}
+}
+
+func appendRecent(lines []string, line string, n int) []string {
+	lines = append(lines, line)
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+func (d *dashboard) progress() string {
+	d.bar.mu.Lock()
+	defer d.bar.mu.Unlock()
+	if d.bar.started.IsZero() {
+		return "Waiting to start"
+	}
+	return d.bar.render(time.Now(), d.bar.ended)
+}
+
+func (d *dashboard) draw() {
+	if !d.active {
+		return
+	}
+	progress := d.progress()
+
+	// Raw mode does not turn \n into \r\n. Lines past the bottom of the
+	// terminal are dropped, as they would scroll the screen.
+	var b strings.Builder
+	b.WriteString("\033[H")
+	shown := 0
+	row := func(s string) {
+		if shown < d.rows-1 {
+			b.WriteString(s + "\033[K\r\n")
+			shown++
+		}
+	}
+	line := func(s string) {
+		if r := []rune(s); len(r) > d.cols {
+			s = string(r[:d.cols])
+		}
+		row(s)
+	}
+	line("\033[1mquiz run\033[0m  " + d.status)
+	line(progress)
+	line("")
+	if d.last == "" {
+		line("No capture yet")
+	} else {
+		line("Last capture: " + d.last)
+	}
+	for _, r := range d.thumb {
+		row(r + "\033[0m")
+	}
+	line("")
+	line("Recent errors:")
+	if len(d.errors) == 0 {
+		line("  none")
+	}
+	for _, e := range d.errors {
+		line("  " + e)
+	}
+	line("")
+	line("Log:")
+	for _, l := range d.lines {
+		line("  " + l)
+	}
+	line("")
+	line("\033[7m p \033[0m pause/resume   \033[7m q \033[0m stop and build the PDF")
+	b.WriteString("\033[J")
+	io.WriteString(d.out, b.String())
+}
+
+// renderThumb draws img in 24-bit colour with half-block characters: each
+// cell's foreground is the upper pixel and its background the lower one.
+func renderThumb(img image.Image) []string {
+	r := img.Bounds()
+	if r.Empty() {
+		return nil
+	}
+	cols := dashboardThumbWidth
+	rows := cols * r.Dy() / r.Dx() / 2
+	if rows > dashboardThumbRows {
+		rows = dashboardThumbRows
+		cols = max(1, rows*2*r.Dx()/r.Dy())
+	}
+	rows = max(rows, 1)
+	pixel := func(x, y int) (uint32, uint32, uint32) {
+		cr, cg, cb, _ := img.At(r.Min.X+x*r.Dx()/cols, r.Min.Y+y*r.Dy()/(rows*2)).RGBA()
+		return cr >> 8, cg >> 8, cb >> 8
+	}
+	lines := make([]string, rows)
+	for y := 0; y < rows; y++ {
+		var b strings.Builder
+		for x := 0; x < cols; x++ {
+			ur, ug, ub := pixel(x, 2*y)
+			lr, lg, lb := pixel(x, 2*y+1)
+			fmt.Fprintf(&b, "\033[38;2;%d;%d;%dm\033[48;2;%d;%d;%dm▀", ur, ug, ub, lr, lg, lb)
+		}
+		lines[y] = b.String()
+	}
+	return lines
+}
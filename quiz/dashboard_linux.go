@@ -0,0 +1,9 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// resizeSignals tell the dashboard the terminal changed size.
+var resizeSignals = []os.Signal{syscall.SIGWINCH}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// resizeSignals is empty: the dashboard keeps its starting size.
+var resizeSignals []os.Signal
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestDashboardSize checks that a redraw fits the terminal: lines are cut
+// at its width and the screen stops above its last row.
+func TestDashboardSize(t *testing.T) {
+	for _, tt := range []struct {
+		cols, rows int
+	}{
+		{20, 6},
+		{100, 40},
+	} {
+		var out bytes.Buffer
+		d := &dashboard{out: &out, bar: newProgressBar(&out, 10), cols: tt.cols, rows: tt.rows, active: true, status: "Running"}
+		d.lines = []string{strings.Repeat("x", 200)}
+		d.draw()
+		screen := strings.TrimSuffix(strings.TrimPrefix(out.String(), "\033[H"), "\033[J")
+		lines := strings.Split(strings.TrimSuffix(screen, "\r\n"), "\r\n")
+		if len(lines) > tt.rows-1 || strings.Contains(screen, "x\n") {
+			t.Errorf("%dx%d: drew %d lines, want at most %d", tt.cols, tt.rows, len(lines), tt.rows-1)
+		}
+		for _, l := range lines {
+			if n := strings.Count(l, "x"); n > tt.cols {
+				t.Errorf("%dx%d: line of %d characters", tt.cols, tt.rows, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"log/slog"
+	"math/bits"
+	"os"
+	"path/filepath"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// deduper remembers the last kept frame and reports whether a new frame
+// repeats it.
+type deduper struct {
+	mode     string
+	distance int
+	last     []byte
+	lastHash uint64
+	hasLast  bool
+}
+
+func newDeduper(opts options) *deduper {
+	return &deduper{mode: opts.dedupe, distance: opts.dedupeDistance}
+}
+
+func (d *deduper) duplicate(img image.Image) bool {
+	switch d.mode {
+	case "exact":
+		sum := pixelDigest(img)
+		dup := d.hasLast && string(sum) == string(d.last)
+		d.last, d.hasLast = sum, true
+		return dup
+	case "perceptual":
+		h := dHash(img)
+		dup := d.hasLast && bits.OnesCount64(h^d.lastHash) <= d.distance
+		d.lastHash, d.hasLast = h, true
+		return dup
+	}
+	return false
+}
+
+func pixelDigest(img image.Image) []byte {
+	rgba := toRGBA(img)
+	sum := sha256.Sum256(rgba.Pix)
+	return sum[:]
+}
+
+// dHash is a 64-bit difference hash: each bit records whether a pixel of a
+// 9x8 grayscale thumbnail is brighter than its right neighbour.
+func dHash(img image.Image) uint64 {
+	thumb := image.NewGray(image.Rect(0, 0, 9, 8))
+	xdraw.ApproxBiLinear.Scale(thumb, thumb.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if thumb.GrayAt(x, y).Y > thumb.GrayAt(x+1, y).Y {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// dedupePages drops pages that repeat the page before them, comparing file
+// bytes (exact) or perceptual hashes, and prints what was dropped. Files
+// that cannot be read are kept for writePDF to report.
+func dedupePages(files []string, opts options) []string {
+	if opts.dedupePages == "off" || len(files) < 2 {
+		return files
+	}
+
+	key := func(file string) (uint64, []byte, error) {
+		if opts.dedupePages == "exact" {
+			data, err := os.ReadFile(file)
+			sum := sha256.Sum256(data)
+			return 0, sum[:], err
+		}
+		img, err := decodeImageFile(file)
+		if err != nil {
+			return 0, nil, err
+		}
+		return dHash(img), nil, nil
+	}
+
+	kept := []string{files[0]}
+	lastHash, lastSum, lastErr := key(files[0])
+	var dropped []string
+	for _, file := range files[1:] {
+		h, sum, err := key(file)
+		dup := err == nil && lastErr == nil
+		if opts.dedupePages == "exact" {
+			dup = dup && string(sum) == string(lastSum)
+		} else {
+			dup = dup && bits.OnesCount64(h^lastHash) <= opts.dedupeDistance
+		}
+		if dup {
+			dropped = append(dropped, fmt.Sprintf("%s (same as %s)", filepath.Base(file), filepath.Base(kept[len(kept)-1])))
+			continue
+		}
+		kept = append(kept, file)
+		lastHash, lastSum, lastErr = h, sum, err
+	}
+
+	if len(dropped) > 0 {
+		slog.Info(fmt.Sprintf("Dropped %d duplicate page(s)", len(dropped)))
+		for _, d := range dropped {
+			slog.Info("  " + d)
+		}
+	}
+	return kept
+}
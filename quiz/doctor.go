@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// doctorTools are the optional external programs and what needs them.
+var doctorTools = []struct{ name, use string }{
+	{"wlr-randr", "listing Wayland outputs for grim, when swaymsg and hyprctl are missing"},
+	{"grim", "captures on Wayland (--backend grim)"},
+	{"cwebp", "--format webp"},
+	{"avifenc", "--format avif"},
+	{"avifdec", "reading AVIF images"},
+	{"qpdf", "--linearize and --append"},
+	{"pdfunite", "--append, when qpdf is missing"},
+	{"tesseract", "--ocr and click-text"},
+	{"xdotool", "--input xdotool"},
+	{"xinput", "--record"},
+}
+
+// doctorCommand implements `doctor`: it reports what the environment
+// supports and exits with status 1 if there is nothing to capture.
+func doctorCommand(args []string) {
+	fs := newFlagSet("doctor")
+	fs.Parse(args)
+
+	ok := func(format string, a ...any) { fmt.Printf("  ok    "+format+"\n", a...) }
+	bad := func(format string, a ...any) { fmt.Printf("  --    "+format+"\n", a...) }
+
+	fmt.Println("Display:")
+	for _, env := range []string{"DISPLAY", "WAYLAND_DISPLAY"} {
+		if v := os.Getenv(env); v != "" {
+			ok("%s=%s", env, v)
+		} else {
+			bad("%s is not set", env)
+		}
+	}
+	active, err := options{backend: "auto"}.activeDisplays()
+	n := len(active)
+	if err != nil {
+		bad("%v", err)
+	} else if n > 0 {
+		ok("%d active display(s)", n)
+	} else {
+		bad("no active displays found")
+	}
+	if _, err := bindHotkeys("F10"); err != nil {
+		bad("hotkeys: %v", err)
+	} else {
+		ok("global hotkeys")
+	}
+
+	fmt.Println("Tools:")
+	for _, t := range doctorTools {
+		if path, err := exec.LookPath(t.name); err == nil {
+			ok("%s (%s)", path, t.use)
+		} else {
+			bad("%s not found, needed for %s", t.name, t.use)
+		}
+	}
+	if path, err := browserBinary(""); err == nil {
+		ok("%s (--browser)", path)
+	} else {
+		bad("no Chrome or Chromium, needed for --browser")
+	}
+
+	if n == 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// elementQuery selects an accessibility element for --click-element: its
+// name, and optionally part of its role name, matched case-insensitively.
+type elementQuery struct {
+	name string
+	role string
+}
+
+func (q elementQuery) String() string {
+	if q.role == "" {
+		return fmt.Sprintf("%q", q.name)
+	}
+	return fmt.Sprintf("%s %q", q.role, q.name)
+}
+
+// match reports whether an element with this name and role fits q: exact
+// is a full name match, otherwise the name only contains q.name.
+func (q elementQuery) match(name, role string) (ok, exact bool) {
+	if q.role != "" && !strings.Contains(strings.ToLower(role), strings.ToLower(q.role)) {
+		return false, false
+	}
+	name, want := strings.ToLower(strings.TrimSpace(name)), strings.ToLower(q.name)
+	if name == want {
+		return true, true
+	}
+	return want != "" && strings.Contains(name, want), false
+}
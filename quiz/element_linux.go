@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// elementTimeout bounds one --click-element search, in case an
+	// application stops answering accessibility calls.
+	elementTimeout = 5 * time.Second
+	// elementMaxNodes caps how many accessibility nodes are visited.
+	elementMaxNodes = 20000
+
+	atspiAccessible = "org.a11y.atspi.Accessible"
+	atspiStateShow  = 25 // ATSPI_STATE_SHOWING
+)
+
+type atspiRef struct {
+	Bus  string
+	Path dbus.ObjectPath
+}
+
+// locateElement finds the element matching q through AT-SPI, the Linux
+// accessibility bus, and returns the centre of it on screen. With pid set,
+// only that process's windows are searched.
+func locateElement(q elementQuery, pid int) (image.Point, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), elementTimeout)
+	defer cancel()
+
+	session, err := dbus.SessionBus()
+	if err != nil {
+		return image.Point{}, fmt.Errorf("accessibility bus unavailable: %w", err)
+	}
+	var addr string
+	if err := session.Object("org.a11y.Bus", "/org/a11y/bus").CallWithContext(ctx, "org.a11y.Bus.GetAddress", 0).Store(&addr); err != nil {
+		return image.Point{}, fmt.Errorf("accessibility bus unavailable (is AT-SPI enabled?): %w", err)
+	}
+	conn, err := dbus.Connect(addr, dbus.WithContext(ctx))
+	if err != nil {
+		return image.Point{}, fmt.Errorf("accessibility bus unavailable: %w", err)
+	}
+	defer conn.Close()
+
+	call := func(ref atspiRef, method string, out any, args ...any) error {
+		return conn.Object(ref.Bus, ref.Path).CallWithContext(ctx, method, 0, args...).Store(out)
+	}
+	children := func(ref atspiRef) []atspiRef {
+		var refs []atspiRef
+		call(ref, atspiAccessible+".GetChildren", &refs)
+		return refs
+	}
+
+	// The registry's children are the applications; breadth-first search
+	// below them finds the outermost match first.
+	var queue []atspiRef
+	for _, app := range children(atspiRef{"org.a11y.atspi.Registry", "/org/a11y/atspi/accessible/root"}) {
+		if pid > 0 {
+			var appPid uint32
+			if err := conn.BusObject().CallWithContext(ctx, "org.freedesktop.DBus.GetConnectionUnixProcessID", 0, app.Bus).Store(&appPid); err != nil || int(appPid) != pid {
+				continue
+			}
+		}
+		queue = append(queue, children(app)...)
+	}
+
+	var partial *atspiRef
+	for n := 0; len(queue) > 0 && n < elementMaxNodes; n++ {
+		if ctx.Err() != nil {
+			break
+		}
+		ref := queue[0]
+		queue = queue[1:]
+
+		var state []uint32
+		if call(ref, atspiAccessible+".GetState", &state) != nil || len(state) == 0 || state[0]&(1<<atspiStateShow) == 0 {
+			continue // hidden subtrees are skipped whole
+		}
+		var name dbus.Variant
+		var role string
+		if conn.Object(ref.Bus, ref.Path).CallWithContext(ctx, "org.freedesktop.DBus.Properties.Get", 0, atspiAccessible, "Name").Store(&name) == nil &&
+			call(ref, atspiAccessible+".GetRoleName", &role) == nil {
+			if s, _ := name.Value().(string); s != "" {
+				if ok, exact := q.match(s, role); exact {
+					return elementCentre(call, ref)
+				} else if ok && partial == nil {
+					partial = &ref
+				}
+			}
+		}
+		queue = append(queue, children(ref)...)
+	}
+	if partial != nil {
+		return elementCentre(call, *partial)
+	}
+	if ctx.Err() != nil {
+		return image.Point{}, fmt.Errorf("no accessible element %s found within %s", q, elementTimeout)
+	}
+	return image.Point{}, fmt.Errorf("no accessible element %s on screen", q)
+}
+
+func elementCentre(call func(atspiRef, string, any, ...any) error, ref atspiRef) (image.Point, error) {
+	var box struct{ X, Y, W, H int32 }
+	if err := call(ref, "org.a11y.atspi.Component.GetExtents", &box, uint32(0)); err != nil {
+		return image.Point{}, fmt.Errorf("element position unavailable: %w", err)
+	}
+	if box.W <= 0 || box.H <= 0 {
+		return image.Point{}, fmt.Errorf("element has no size on screen")
+	}
+	return image.Pt(int(box.X+box.W/2), int(box.Y+box.H/2)), nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"image"
+)
+
+func locateElement(q elementQuery, pid int) (image.Point, error) {
+	return image.Point{}, errors.New("accessibility targeting is only supported on Linux (AT-SPI)")
+}
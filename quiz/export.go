@@ -0,0 +1,341 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// exporter writes the captures, in page order, to a single output file.
+type exporter interface {
+	export(path string, files []string, opts options) error
+}
+
+// exporterFunc adapts a write function to the exporter interface.
+type exporterFunc func(path string, files []string, opts options) error
+
+func (f exporterFunc) export(path string, files []string, opts options) error {
+	return f(path, files, opts)
+}
+
+// pdfBackends are the PDF writers selectable with --pdf-backend. gofpdf
+// supports every PDF feature; pdfcpu, which is maintained, writes image
+// pages with bookmarks, encryption, attachments and PDF/A but no page text.
+var pdfBackends = map[string]exporter{
+	"gofpdf": exporterFunc(writePDF),
+	"pdfcpu": exporterFunc(writePDFCPU),
+}
+
+// exporters are the other --export formats, written next to the PDF.
+var exporters = map[string]exporter{
+	"cbz": exporterFunc(func(path string, files []string, _ options) error {
+		return writeCBZ(path, files)
+	}),
+	"epub": exporterFunc(writeEPUB),
+	"tiff": exporterFunc(writeTIFF),
+}
+
+// exportPDF writes files to path with the selected PDF backend.
+func exportPDF(path string, files []string, opts options) error {
+	return pdfBackends[opts.pdfBackend].export(path, files, opts)
+}
+
+// exportPath returns the path for format next to the PDF path.
+func exportPath(pdfPath, format string) string {
+	return strings.TrimSuffix(pdfPath, filepath.Ext(pdfPath)) + "." + format
+}
+
+// bookImage returns the data and extension to store for file in an archive.
+// Formats e-readers cannot display (WebP, AVIF) are converted to PNG.
+func bookImage(file string) ([]byte, string, error) {
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext == ".png" || ext == ".jpg" || ext == ".jpeg" {
+		data, err := os.ReadFile(file)
+		return data, ext, err
+	}
+	img, err := decodeImageFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ".png", nil
+}
+
+// writeCBZ stores the captures in order as a comic book archive.
+func writeCBZ(path string, files []string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for i, file := range files {
+		data, ext, err := bookImage(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		// Zero-padded names keep readers that sort by name in capture order.
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("%04d%s", i+1, ext), Method: zip.Store, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const epubPage = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+<title>%s</title>
+<meta name="viewport" content="width=%d, height=%d"/>
+<style>body { margin: 0; } img { display: block; width: 100%%; height: 100%%; }</style>
+</head>
+<body><img src="%s" alt="%s"/></body>
+</html>
+`
+
+// writeEPUB writes a fixed-layout EPUB 3 book with one capture per page.
+func writeEPUB(path string, files []string, opts options) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	put := func(name string, method uint16, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	// The mimetype entry must come first and be stored uncompressed.
+	if err := put("mimetype", zip.Store, []byte("application/epub+zip")); err != nil {
+		return err
+	}
+	if err := put("META-INF/container.xml", zip.Deflate, []byte(epubContainer)); err != nil {
+		return err
+	}
+
+	var manifest, spine, nav strings.Builder
+	for i, file := range files {
+		n := i + 1
+		data, ext, err := bookImage(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		w, h, err := getImageDimensions(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		image := fmt.Sprintf("images/%04d%s", n, ext)
+		page := fmt.Sprintf("page%04d.xhtml", n)
+		label := html.EscapeString(pageLabel(n, opts))
+		if err := put("OEBPS/"+image, zip.Store, data); err != nil {
+			return err
+		}
+		xhtml := fmt.Sprintf(epubPage, label, w, h, image, label)
+		if err := put("OEBPS/"+page, zip.Deflate, []byte(xhtml)); err != nil {
+			return err
+		}
+
+		mediaType := "image/png"
+		if ext != ".png" {
+			mediaType = "image/jpeg"
+		}
+		fmt.Fprintf(&manifest, "    <item id=\"img%d\" href=\"%s\" media-type=\"%s\"/>\n", n, image, mediaType)
+		fmt.Fprintf(&manifest, "    <item id=\"p%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", n, page)
+		fmt.Fprintf(&spine, "    <itemref idref=\"p%d\"/>\n", n)
+		fmt.Fprintf(&nav, "      <li><a href=\"%s\">%s</a></li>\n", page, label)
+	}
+
+	title := opts.pdfTitle
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	title = html.EscapeString(title)
+
+	navDoc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>%s</title></head>
+<body>
+  <nav epub:type="toc">
+    <ol>
+%s    </ol>
+  </nav>
+</body>
+</html>
+`, title, nav.String())
+	if err := put("OEBPS/nav.xhtml", zip.Deflate, []byte(navDoc)); err != nil {
+		return err
+	}
+
+	var creator string
+	if opts.pdfAuthor != "" {
+		creator = fmt.Sprintf("    <dc:creator>%s</dc:creator>\n", html.EscapeString(opts.pdfAuthor))
+	}
+	opf := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="id">urn:uuid:%s</dc:identifier>
+    <dc:title>%s</dc:title>
+%s    <dc:language>en</dc:language>
+    <meta property="dcterms:modified">%s</meta>
+    <meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:spread">none</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+%s  </manifest>
+  <spine>
+%s  </spine>
+</package>
+`, newUUID(), title, creator, time.Now().UTC().Format("2006-01-02T15:04:05Z"), manifest.String(), spine.String())
+	if err := put("OEBPS/content.opf", zip.Deflate, []byte(opf)); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// newUUID returns a random (version 4) UUID string.
+func newUUID() string {
+	var b [16]byte
+	io.ReadFull(rand.Reader, b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// writeExports writes the non-PDF --export formats next to pdfPath.
+func writeExports(pdfPath string, files []string, opts options) ([]string, error) {
+	var paths []string
+	for _, format := range []string{"cbz", "epub", "tiff"} {
+		if !opts.export[format] {
+			continue
+		}
+		path := exportPath(pdfPath, format)
+		if err := exporters[format].export(path, files, opts); err != nil {
+			return paths, fmt.Errorf("%s: %w", format, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// manifestEntry describes one capture in the --archive manifest. Page and
+// Label are empty for captures left out of the PDF.
+type manifestEntry struct {
+	Page     int       `json:"page,omitempty"`
+	File     string    `json:"file"`
+	Label    string    `json:"label,omitempty"`
+	Width    int       `json:"width"`
+	Height   int       `json:"height"`
+	Bytes    int64     `json:"bytes"`
+	SHA256   string    `json:"sha256"`
+	Captured time.Time `json:"captured"`
+}
+
+// writeArchive bundles the original captures, unconverted and in capture
+// order, with a manifest.json. pages are the files in the PDF in page
+// order; the manifest gives each capture's page among them.
+func writeArchive(path string, files, pages []string, opts options) error {
+	pageOf := make(map[string]int, len(pages))
+	for i, file := range pages {
+		if _, ok := pageOf[file]; !ok {
+			pageOf[file] = i + 1
+		}
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	var manifest []manifestEntry
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		entry := manifestEntry{
+			File:     filepath.Base(file),
+			Bytes:    info.Size(),
+			SHA256:   fmt.Sprintf("%x", sha256.Sum256(data)),
+			Captured: info.ModTime(),
+		}
+		if page := pageOf[file]; page > 0 {
+			entry.Page, entry.Label = page, pageLabel(page, opts)
+		}
+		if w, h, err := getImageDimensions(file); err == nil {
+			entry.Width, entry.Height = w, h
+		}
+		manifest = append(manifest, entry)
+
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: entry.File, Method: zip.Store, Modified: info.ModTime()})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
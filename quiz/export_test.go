@@ -0,0 +1,60 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestWriteArchive checks that the archive holds every capture in capture
+// order, with the PDF page of those that made it into the PDF.
+func TestWriteArchive(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"Q_1.png", "Q_2.png", "Q_3.png"} {
+		files = append(files, filepath.Join(dir, name))
+		writePNG(t, files[len(files)-1])
+	}
+	// --order-file put the third capture first; the second was a duplicate.
+	pages := []string{files[2], files[0]}
+
+	path := filepath.Join(dir, "out.zip")
+	if err := writeArchive(path, files, pages, pdfOptions()); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	var manifest []manifestEntry
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Name == "manifest.json" {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = json.NewDecoder(r).Decode(&manifest)
+			r.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if got := strings.Join(names, " "); got != "Q_1.png Q_2.png Q_3.png manifest.json" {
+		t.Errorf("archive holds %s", got)
+	}
+	var got [][2]any
+	for _, e := range manifest {
+		got = append(got, [2]any{e.File, e.Page})
+	}
+	want := [][2]any{{"Q_1.png", 2}, {"Q_2.png", 0}, {"Q_3.png", 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("manifest pages = %v, want %v", got, want)
+	}
+}
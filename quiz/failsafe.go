@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"time"
+
+	"github.com/kbinani/screenshot"
+)
+
+const (
+	// failsafePoll is how often the pointer is checked for --failsafe.
+	failsafePoll = 100 * time.Millisecond
+	// failsafeMargin is how near a corner, in pixels, counts as in it.
+	failsafeMargin = 1
+
+	failsafeReason = "Mouse pushed into a screen corner (--failsafe)"
+)
+
+func screenCorners() []image.Point {
+	var displays []image.Rectangle
+	for i := 0; i < screenshot.NumActiveDisplays(); i++ {
+		displays = append(displays, screenshot.GetDisplayBounds(i))
+	}
+	return outerCorners(displays)
+}
+
+// outerCorners returns the desktop corners the pointer gets pinned in when
+// pushed there: display corners with no neighbouring display beyond them.
+func outerCorners(displays []image.Rectangle) []image.Point {
+	onScreen := func(p image.Point) bool {
+		for _, d := range displays {
+			if p.In(d) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var corners []image.Point
+	for _, d := range displays {
+		for _, c := range [][4]int{
+			{d.Min.X, d.Min.Y, -1, -1},
+			{d.Max.X - 1, d.Min.Y, 1, -1},
+			{d.Min.X, d.Max.Y - 1, -1, 1},
+			{d.Max.X - 1, d.Max.Y - 1, 1, 1},
+		} {
+			p, dx, dy := image.Pt(c[0], c[1]), c[2], c[3]
+			if !onScreen(p.Add(image.Pt(dx, 0))) && !onScreen(p.Add(image.Pt(0, dy))) && !onScreen(p.Add(image.Pt(dx, dy))) {
+				corners = append(corners, p)
+			}
+		}
+	}
+	return corners
+}
+
+func inCorner(p image.Point, corners []image.Point) bool {
+	for _, c := range corners {
+		d := p.Sub(c)
+		if d.X >= -failsafeMargin && d.X <= failsafeMargin && d.Y >= -failsafeMargin && d.Y <= failsafeMargin {
+			return true
+		}
+	}
+	return false
+}
+
+// failsafeWatch returns the pointer poller and the corners --failsafe
+// watches, or why it can't watch them.
+func failsafeWatch() (func() (image.Point, error), []image.Point, error) {
+	pointer, err := pointerPoller()
+	if err != nil {
+		return nil, nil, err
+	}
+	corners := screenCorners()
+	if len(corners) == 0 {
+		return nil, nil, fmt.Errorf("no display corners found")
+	}
+	return pointer, corners, nil
+}
+
+// watchCorner polls the pointer for --failsafe until the session ends. The
+// returned channel is closed, and s.cornered set, once the pointer is
+// pushed into a corner.
+func (s *session) watchCorner() <-chan struct{} {
+	if !s.opts.failsafe {
+		return nil
+	}
+	pointer, corners, err := failsafeWatch()
+	if err != nil {
+		// parseOptions refuses an explicit --failsafe it can't honour; the
+		// default one is only missed.
+		slog.Warn("--failsafe unavailable", "err", err)
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(failsafePoll)
+		defer t.Stop()
+		for {
+			select {
+			case <-s.finished:
+				return
+			case <-t.C:
+			}
+			if p, err := pointer(); err == nil && inCorner(p, corners) {
+				s.cornered.Store(true)
+				close(done)
+				return
+			}
+		}
+	}()
+	return done
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"image"
+	"sync"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// pointerPoller returns a function reading the pointer position over its
+// own X connection, so it can run alongside robotgo's calls. The connection
+// is opened once, when options are checked or the session starts.
+var pointerPoller = sync.OnceValues(newPointerPoller)
+
+func newPointerPoller() (func() (image.Point, error), error) {
+	c, err := xgb.NewConn()
+	if err != nil {
+		return nil, err
+	}
+	root := xproto.Setup(c).DefaultScreen(c).Root
+	return func() (image.Point, error) {
+		r, err := xproto.QueryPointer(c, root).Reply()
+		if err != nil {
+			return image.Point{}, err
+		}
+		return image.Pt(int(r.RootX), int(r.RootY)), nil
+	}, nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"image"
+
+	"github.com/go-vgo/robotgo"
+)
+
+func pointerPoller() (func() (image.Point, error), error) {
+	return func() (image.Point, error) {
+		x, y := robotgo.Location()
+		return image.Pt(x, y), nil
+	}, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestOuterCorners(t *testing.T) {
+	tests := []struct {
+		name     string
+		displays []image.Rectangle
+		want     []image.Point
+	}{
+		{"none", nil, nil},
+		{
+			"single",
+			[]image.Rectangle{image.Rect(0, 0, 1920, 1080)},
+			[]image.Point{{0, 0}, {1919, 0}, {0, 1079}, {1919, 1079}},
+		},
+		{
+			"side by side",
+			[]image.Rectangle{image.Rect(0, 0, 1920, 1080), image.Rect(1920, 0, 3840, 1080)},
+			[]image.Point{{0, 0}, {0, 1079}, {3839, 0}, {3839, 1079}},
+		},
+		{
+			"stacked",
+			[]image.Rectangle{image.Rect(0, 0, 1920, 1080), image.Rect(0, 1080, 1920, 2160)},
+			[]image.Point{{0, 0}, {1919, 0}, {0, 2159}, {1919, 2159}},
+		},
+		{
+			// The taller display's bottom-right corner is open: nothing lies
+			// right of it or below it.
+			"different heights",
+			[]image.Rectangle{image.Rect(0, 0, 1920, 1080), image.Rect(1920, 0, 3200, 1024)},
+			[]image.Point{{0, 0}, {0, 1079}, {1919, 1079}, {3199, 0}, {3199, 1023}},
+		},
+		{
+			"left of the primary",
+			[]image.Rectangle{image.Rect(-1280, 0, 0, 1024), image.Rect(0, 0, 1920, 1080)},
+			[]image.Point{{-1280, 0}, {-1280, 1023}, {1919, 0}, {0, 1079}, {1919, 1079}},
+		},
+		{
+			"offset vertically",
+			[]image.Rectangle{image.Rect(0, 0, 1920, 1080), image.Rect(1920, 200, 3840, 1280)},
+			[]image.Point{{0, 0}, {1919, 0}, {0, 1079}, {3839, 200}, {1920, 1279}, {3839, 1279}},
+		},
+	}
+	for _, tt := range tests {
+		if got := outerCorners(tt.displays); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: outerCorners = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInCorner(t *testing.T) {
+	corners := []image.Point{{0, 0}, {1919, 1079}}
+	for _, tt := range []struct {
+		p    image.Point
+		want bool
+	}{
+		{image.Pt(0, 0), true},
+		{image.Pt(1, 1), true},
+		{image.Pt(2, 0), false},
+		{image.Pt(1918, 1079), true},
+		{image.Pt(960, 540), false},
+	} {
+		if got := inCorner(tt.p, corners); got != tt.want {
+			t.Errorf("inCorner(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
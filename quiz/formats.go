@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// External encoders are used for formats the standard library cannot write.
+var externalEncoders = map[string]string{
+	"webp": "cwebp",
+	"avif": "avifenc",
+}
+
+func encodeExternal(filePath string, img image.Image, opts options) error {
+	tool := externalEncoders[opts.format]
+	if _, err := exec.LookPath(tool); err != nil {
+		return fmt.Errorf("%s output requires %s to be installed", opts.format, tool)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".capture-*.png")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// The encoders copy the colour profile over from the intermediate PNG.
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	data := buf.Bytes()
+	if opts.iccProfile != nil {
+		data = tagPNG(data, colorTag(opts))
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	q := strconv.Itoa(opts.quality)
+	var cmd *exec.Cmd
+	switch opts.format {
+	case "webp":
+		cmd = exec.Command(tool, "-quiet", "-q", q, "-metadata", "icc", tmp.Name(), "-o", filePath)
+	case "avif":
+		cmd = exec.Command(tool, "-q", q, tmp.Name(), filePath)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v: %s", tool, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func decodeAVIF(filePath string) (image.Image, error) {
+	if _, err := exec.LookPath("avifdec"); err != nil {
+		return nil, fmt.Errorf("reading AVIF requires avifdec to be installed")
+	}
+
+	tmp, err := os.CreateTemp("", "avif-*.png")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if out, err := exec.Command("avifdec", filePath, tmp.Name()).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("avifdec failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+// decodeImageFile decodes any capture format, including ones gofpdf cannot embed directly.
+func decodeImageFile(filePath string) (image.Image, error) {
+	if strings.EqualFold(filepath.Ext(filePath), ".avif") {
+		return decodeAVIF(filePath)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	return img, err
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/robotn/xgbutil"
+	"github.com/robotn/xgbutil/keybind"
+	"github.com/robotn/xgbutil/xevent"
+)
+
+// bindHotkeys grabs each key globally on the X11 root window and returns a
+// channel per key that receives a value on every press.
+func bindHotkeys(keys ...string) ([]<-chan struct{}, error) {
+	xu, err := xgbutil.NewConn()
+	if err != nil {
+		return nil, fmt.Errorf("global hotkeys need an X11 display: %w", err)
+	}
+	keybind.Initialize(xu)
+
+	chans := make([]<-chan struct{}, len(keys))
+	for i, key := range keys {
+		ch := make(chan struct{}, 1)
+		cb := keybind.KeyPressFun(func(*xgbutil.XUtil, xevent.KeyPressEvent) {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		})
+		if err := cb.Connect(xu, xu.RootWin(), key, true); err != nil {
+			xu.Conn().Close()
+			return nil, fmt.Errorf("could not grab hotkey %q: %w", key, err)
+		}
+		chans[i] = ch
+	}
+
+	go xevent.Main(xu)
+	return chans, nil
+}
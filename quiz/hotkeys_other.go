@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func bindHotkeys(keys ...string) ([]<-chan struct{}, error) {
+	return nil, errors.New("global hotkeys are only supported on X11")
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"math"
+	"os"
+	"sync"
+)
+
+// iccProfile holds a matrix/TRC display profile, enough to convert
+// captures to sRGB and to re-embed the profile in saved images.
+type iccProfile struct {
+	raw    []byte
+	matrix [3][3]float64 // linear display RGB -> linear sRGB
+	curves [3][256]float64
+}
+
+// xyzD50ToLinearSRGB is the Bradford-adapted D50 XYZ to linear sRGB matrix.
+var xyzD50ToLinearSRGB = [3][3]float64{
+	{3.1338561, -1.6168667, -0.4906146},
+	{-0.9787684, 1.9161415, 0.0334540},
+	{0.0719453, -0.2289914, 1.4052427},
+}
+
+func loadICCProfile(spec string) (*iccProfile, error) {
+	var data []byte
+	var err error
+	if spec == "auto" {
+		data, err = displayICCProfile()
+	} else {
+		data, err = os.ReadFile(spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseICC(data)
+}
+
+func parseICC(data []byte) (*iccProfile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, fmt.Errorf("not an ICC profile")
+	}
+
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(data) {
+			return nil, fmt.Errorf("truncated ICC tag table")
+		}
+		offset := int(binary.BigEndian.Uint32(data[entry+4:]))
+		size := int(binary.BigEndian.Uint32(data[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return nil, fmt.Errorf("ICC tag %q out of range", data[entry:entry+4])
+		}
+		tags[string(data[entry:entry+4])] = data[offset : offset+size]
+	}
+
+	p := &iccProfile{raw: data}
+	var toXYZ [3][3]float64
+	for c, name := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, err := parseXYZTag(tags[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w (only matrix/TRC RGB profiles are supported)", name, err)
+		}
+		for row := 0; row < 3; row++ {
+			toXYZ[row][c] = xyz[row]
+		}
+	}
+	for c, name := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, err := parseCurveTag(tags[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		p.curves[c] = curve
+	}
+
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				p.matrix[i][j] += xyzD50ToLinearSRGB[i][k] * toXYZ[k][j]
+			}
+		}
+	}
+	return p, nil
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func parseXYZTag(b []byte) ([3]float64, error) {
+	if len(b) < 20 || string(b[:4]) != "XYZ " {
+		return [3]float64{}, fmt.Errorf("missing XYZ tag")
+	}
+	return [3]float64{s15Fixed16(b[8:]), s15Fixed16(b[12:]), s15Fixed16(b[16:])}, nil
+}
+
+// parseCurveTag returns a lookup table from 8-bit encoded value to linear light.
+func parseCurveTag(b []byte) ([256]float64, error) {
+	var lut [256]float64
+	if len(b) < 12 {
+		return lut, fmt.Errorf("missing tone curve")
+	}
+
+	var eval func(x float64) float64
+	switch string(b[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(b[8:]))
+		switch {
+		case n == 0:
+			eval = func(x float64) float64 { return x }
+		case n == 1:
+			gamma := float64(binary.BigEndian.Uint16(b[12:])) / 256
+			eval = func(x float64) float64 { return math.Pow(x, gamma) }
+		default:
+			if len(b) < 12+2*n {
+				return lut, fmt.Errorf("truncated curve table")
+			}
+			eval = func(x float64) float64 {
+				pos := x * float64(n-1)
+				i := int(pos)
+				if i >= n-1 {
+					return float64(binary.BigEndian.Uint16(b[12+2*(n-1):])) / 65535
+				}
+				lo := float64(binary.BigEndian.Uint16(b[12+2*i:]))
+				hi := float64(binary.BigEndian.Uint16(b[12+2*(i+1):]))
+				return (lo + (hi-lo)*(pos-float64(i))) / 65535
+			}
+		}
+	case "para":
+		fn := int(binary.BigEndian.Uint16(b[8:]))
+		counts := []int{1, 3, 4, 5, 7}
+		if fn >= len(counts) || len(b) < 12+4*counts[fn] {
+			return lut, fmt.Errorf("unsupported parametric curve")
+		}
+		var g [7]float64
+		for i := 0; i < counts[fn]; i++ {
+			g[i] = s15Fixed16(b[12+4*i:])
+		}
+		eval = func(x float64) float64 { return parametricCurve(fn, g, x) }
+	default:
+		return lut, fmt.Errorf("unsupported curve type %q", b[:4])
+	}
+
+	for i := range lut {
+		lut[i] = eval(float64(i) / 255)
+	}
+	return lut, nil
+}
+
+func parametricCurve(fn int, p [7]float64, x float64) float64 {
+	g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+	switch fn {
+	case 1:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g)
+		}
+		return 0
+	case 2:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g) + c
+		}
+		return c
+	case 3:
+		if x >= d {
+			return math.Pow(a*x+b, g)
+		}
+		return c * x
+	case 4:
+		if x >= d {
+			return math.Pow(a*x+b, g) + e
+		}
+		return c*x + f
+	}
+	return math.Pow(x, g)
+}
+
+func srgbEncode(v float64) uint8 {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return uint8(v*255 + 0.5)
+}
+
+// srgbTable maps linear values in [0,1], in 4096 steps, to 8-bit sRGB.
+var srgbTable = sync.OnceValue(func() *[4096]uint8 {
+	var encode [4096]uint8
+	for i := range encode {
+		encode[i] = srgbEncode(float64(i) / float64(len(encode)-1))
+	}
+	return &encode
+})
+
+// convertToSRGB returns img converted from the display profile p to sRGB,
+// in a new image; img is left as it is.
+func convertToSRGB(img *image.RGBA, p *iccProfile) *image.RGBA {
+	encode := srgbTable()
+	lookup := func(v float64) uint8 {
+		i := int(v*float64(len(encode)-1) + 0.5)
+		return encode[max(0, min(len(encode)-1, i))]
+	}
+
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	m := &p.matrix
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			px := img.Pix[img.PixOffset(x, y):]
+			out := dst.Pix[dst.PixOffset(x-b.Min.X, y-b.Min.Y):]
+			r, g, bl := p.curves[0][px[0]], p.curves[1][px[1]], p.curves[2][px[2]]
+			out[0] = lookup(m[0][0]*r + m[0][1]*g + m[0][2]*bl)
+			out[1] = lookup(m[1][0]*r + m[1][1]*g + m[1][2]*bl)
+			out[2] = lookup(m[2][0]*r + m[2][1]*g + m[2][2]*bl)
+			out[3] = px[3]
+		}
+	}
+	return dst
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+	buf.WriteString(typ)
+	buf.Write(data)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	binary.Write(&buf, binary.BigEndian, crc.Sum32())
+	return buf.Bytes()
+}
+
+// tagPNG inserts an iCCP chunk (or an sRGB chunk when profile is nil) after IHDR.
+func tagPNG(data []byte, profile []byte) []byte {
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+	if len(data) < ihdrEnd {
+		return data
+	}
+
+	var chunk []byte
+	if profile == nil {
+		chunk = pngChunk("sRGB", []byte{0})
+	} else {
+		var payload bytes.Buffer
+		payload.WriteString("ICC Profile\x00\x00")
+		zw := zlib.NewWriter(&payload)
+		zw.Write(profile)
+		zw.Close()
+		chunk = pngChunk("iCCP", payload.Bytes())
+	}
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
+
+// tagJPEG inserts an ICC_PROFILE APP2 segment after SOI.
+func tagJPEG(data []byte, profile []byte) []byte {
+	const maxSegment = 65535 - 2 - 14
+	if len(data) < 2 || profile == nil || len(profile) > maxSegment {
+		return data
+	}
+
+	var seg bytes.Buffer
+	seg.Write([]byte{0xFF, 0xE2})
+	binary.Write(&seg, binary.BigEndian, uint16(2+14+len(profile)))
+	seg.WriteString("ICC_PROFILE\x00")
+	seg.Write([]byte{1, 1})
+	seg.Write(profile)
+
+	out := make([]byte, 0, len(data)+seg.Len())
+	out = append(out, data[:2]...)
+	out = append(out, seg.Bytes()...)
+	return append(out, data[2:]...)
+}
+
+// colorTag returns the profile to embed in saved images: the display profile
+// when captures keep display colors, nil once they have been converted to sRGB.
+func colorTag(opts options) []byte {
+	if opts.iccProfile == nil || opts.toSRGB {
+		return nil
+	}
+	return opts.iccProfile.raw
+}
+
+// srgbProfile builds a minimal ICC v2 sRGB display profile: D50 primaries
+// from the Bradford-adapted sRGB matrix and a sampled sRGB transfer curve.
+func srgbProfile() []byte {
+	xyz := func(x, y, z float64) []byte {
+		b := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range []float64{x, y, z} {
+			b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(v*65536))))
+		}
+		return b
+	}
+	text := func(typ, s string) []byte {
+		b := append([]byte(typ), 0, 0, 0, 0)
+		if typ == "desc" {
+			b = binary.BigEndian.AppendUint32(b, uint32(len(s)+1))
+			b = append(append(b, s...), 0)
+			return append(b, make([]byte, 4+4+2+1+67)...) // empty Unicode and ScriptCode parts
+		}
+		return append(append(b, s...), 0)
+	}
+	curve := []byte("curv\x00\x00\x00\x00")
+	curve = binary.BigEndian.AppendUint32(curve, 1024)
+	for i := 0; i < 1024; i++ {
+		v := float64(i) / 1023
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		curve = binary.BigEndian.AppendUint16(curve, uint16(math.Round(v*65535)))
+	}
+
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", text("desc", "sRGB IEC61966-2.1")},
+		{"cprt", text("text", "No copyright, use freely")},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	var body []byte
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	start := 128 + 4 + 12*len(tags)
+	offsets := map[*byte]int{}
+	for _, t := range tags {
+		offset, shared := offsets[&t.data[0]]
+		if !shared {
+			offset = start + len(body)
+			offsets[&t.data[0]] = offset
+			body = append(body, t.data...)
+			for len(body)%4 != 0 {
+				body = append(body, 0)
+			}
+		}
+		table = append(table, t.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(t.data)))
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(start+len(body)))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntrRGB XYZ ")
+	binary.BigEndian.PutUint16(header[24:], 2000) // creation date: 2000-01-01
+	binary.BigEndian.PutUint16(header[26:], 1)
+	binary.BigEndian.PutUint16(header[28:], 1)
+	copy(header[36:], "acsp")
+	copy(header[68:], xyz(0.9642, 1.0, 0.8249)[8:])
+	return append(append(header, table...), body...)
+}
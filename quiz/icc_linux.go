@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// displayICCProfile reads the _ICC_PROFILE root window property set by
+// colord and most colour managers on X11.
+func displayICCProfile() ([]byte, error) {
+	c, err := xgb.NewConn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	const name = "_ICC_PROFILE"
+	atom, err := xproto.InternAtom(c, true, uint16(len(name)), name).Reply()
+	if err != nil {
+		return nil, err
+	}
+	if atom.Atom == xproto.AtomNone {
+		return nil, fmt.Errorf("no display profile set (%s missing)", name)
+	}
+
+	root := xproto.Setup(c).DefaultScreen(c).Root
+	prop, err := xproto.GetProperty(c, false, root, atom.Atom, xproto.GetPropertyTypeAny, 0, 1<<24).Reply()
+	if err != nil {
+		return nil, err
+	}
+	if len(prop.Value) == 0 {
+		return nil, fmt.Errorf("no display profile set (%s empty)", name)
+	}
+	return prop.Value, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func displayICCProfile() ([]byte, error) {
+	return nil, errors.New("automatic profile detection is not supported on this platform; pass a profile path")
+}
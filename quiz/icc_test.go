@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+// TestConvertToSRGB checks that converting from the sRGB profile keeps the
+// colours, and that the source image is not written to.
+func TestConvertToSRGB(t *testing.T) {
+	profile, err := parseICC(srgbProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := noiseImage(16, 8)
+	sub := src.SubImage(src.Rect.Inset(2)).(*image.RGBA)
+	before := bytes.Clone(src.Pix)
+	for _, img := range []*image.RGBA{src, sub} {
+		out := convertToSRGB(img, profile)
+		b := img.Bounds()
+		if out.Bounds() != b.Sub(b.Min) {
+			t.Fatalf("converted bounds %v, want %v", out.Bounds(), b.Sub(b.Min))
+		}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				want, got := img.RGBAAt(x, y), out.RGBAAt(x-b.Min.X, y-b.Min.Y)
+				if absDiff(uint32(want.R), uint32(got.R)) > 2 || absDiff(uint32(want.G), uint32(got.G)) > 2 ||
+					absDiff(uint32(want.B), uint32(got.B)) > 2 || want.A != got.A {
+					t.Fatalf("pixel %d,%d: %v became %v", x, y, want, got)
+				}
+			}
+		}
+	}
+	if !bytes.Equal(src.Pix, before) {
+		t.Error("convertToSRGB changed its source")
+	}
+}
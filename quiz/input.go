@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// inputDriver sends mouse and keyboard input, selected with --input.
+// Buttons are left, right or middle.
+type inputDriver interface {
+	move(x, y int) error
+	location() (int, int, error)
+	click(button string, double bool) error
+	toggle(button string, down bool) error
+	keyTap(k keyPress) error
+	typeText(text string) error
+	// scroll turns the wheel n steps, negative scrolling down.
+	scroll(n int) error
+}
+
+// inputDrivers are the --input backends.
+var inputDrivers = map[string]inputDriver{
+	"robotgo": robotgoInput{},
+	"xdotool": xdotoolInput{},
+}
+
+// robotgoInput is the default driver, built into the binary.
+type robotgoInput struct{}
+
+func (robotgoInput) move(x, y int) error {
+	robotgo.Move(x, y)
+	return nil
+}
+
+func (robotgoInput) location() (int, int, error) {
+	x, y := robotgo.Location()
+	return x, y, nil
+}
+
+func (robotgoInput) click(button string, double bool) error {
+	robotgo.Click(button, double)
+	return nil
+}
+
+func (robotgoInput) toggle(button string, down bool) error {
+	if down {
+		return robotgo.MouseDown(button)
+	}
+	return robotgo.MouseUp(button)
+}
+
+func (robotgoInput) keyTap(k keyPress) error {
+	args := make([]interface{}, len(k.mods))
+	for i, m := range k.mods {
+		args[i] = m
+	}
+	if err := robotgo.KeyTap(k.key, args...); err != nil {
+		return fmt.Errorf("key %s: %w", k, err)
+	}
+	return nil
+}
+
+func (robotgoInput) typeText(text string) error {
+	robotgo.TypeStr(text)
+	return nil
+}
+
+func (robotgoInput) scroll(n int) error {
+	robotgo.Scroll(0, n)
+	return nil
+}
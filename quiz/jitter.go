@@ -0,0 +1,32 @@
+package main
+
+import (
+	"image"
+	"math/rand/v2"
+	"time"
+)
+
+// clickJitterPx is how far, in pixels, --jitter may move an explicit click
+// target in each direction.
+const clickJitterPx = 3
+
+// jittered shifts d by a random amount within ±jitter, never below zero.
+func jittered(d, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return d
+	}
+	return max(0, d+time.Duration(rand.Int64N(int64(2*jitter)+1))-jitter)
+}
+
+// sleep waits for d, randomized by --jitter.
+func (s *session) sleep(d time.Duration) {
+	time.Sleep(jittered(d, s.opts.jitter))
+}
+
+// jitterPoint nudges p by a few pixels when --jitter is set.
+func jitterPoint(p image.Point, opts options) image.Point {
+	if opts.jitter <= 0 {
+		return p
+	}
+	return p.Add(image.Pt(rand.IntN(2*clickJitterPx+1)-clickJitterPx, rand.IntN(2*clickJitterPx+1)-clickJitterPx))
+}
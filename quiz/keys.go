@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keyAliases maps common alternative key names to robotgo's.
+var keyAliases = map[string]string{
+	"pgdn":       "pagedown",
+	"pgup":       "pageup",
+	"page_down":  "pagedown",
+	"page_up":    "pageup",
+	"return":     "enter",
+	"esc":        "escape",
+	"del":        "delete",
+	"ins":        "insert",
+	"arrowright": "right",
+	"arrowleft":  "left",
+	"arrowup":    "up",
+	"arrowdown":  "down",
+	"control":    "ctrl",
+	"option":     "alt",
+	"super":      "cmd",
+	"win":        "cmd",
+}
+
+var keyModifiers = map[string]bool{"ctrl": true, "alt": true, "shift": true, "cmd": true}
+
+// keyPress is a key with optional modifiers, e.g. ctrl+shift+tab.
+type keyPress struct {
+	key  string
+	mods []string
+}
+
+func (k keyPress) String() string {
+	return strings.Join(append(append([]string{}, k.mods...), k.key), "+")
+}
+
+func keyName(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if alias, ok := keyAliases[s]; ok {
+		return alias
+	}
+	return s
+}
+
+// parseKey parses a key name such as PageDown, Right, Space or ctrl+Tab.
+func parseKey(s string) (keyPress, error) {
+	parts := strings.Split(s, "+")
+	k := keyPress{key: keyName(parts[len(parts)-1])}
+	if k.key == "" {
+		return k, fmt.Errorf("missing key in %q", s)
+	}
+	for _, m := range parts[:len(parts)-1] {
+		m = keyName(m)
+		if !keyModifiers[m] {
+			return k, fmt.Errorf("unknown modifier %q in %q (want ctrl, alt, shift or cmd)", m, s)
+		}
+		k.mods = append(k.mods, m)
+	}
+	return k, nil
+}
+
+// parseKeys parses a comma-separated key sequence such as "tab,tab,enter".
+func parseKeys(s string) ([]keyPress, error) {
+	var keys []keyPress
+	for _, name := range strings.Split(s, ",") {
+		k, err := parseKey(name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
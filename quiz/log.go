@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	slog.SetDefault(slog.New(newConsoleHandler(os.Stdout, slog.LevelInfo, false)))
+}
+
+// setupLogging applies --verbose, --quiet and --log-format. Text logs go to
+// stdout as before, through the --progress bar or dashboard, or moved to
+// stderr by --progress json; JSON logs go to stderr, one object per line.
+func setupLogging(opts options) {
+	level := slog.LevelInfo
+	if opts.verbose {
+		level = slog.LevelDebug
+	} else if opts.quiet {
+		level = slog.LevelWarn
+	}
+	var h slog.Handler
+	if opts.logFormat == "json" {
+		h = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	} else {
+		var out io.Writer = os.Stdout
+		switch {
+		case opts.progress == "json":
+			out = os.Stderr // stdout carries the progress events
+		case opts.view != nil:
+			out = opts.view
+		}
+		h = newConsoleHandler(out, level, opts.verbose)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// consoleHandler prints records for people: the message, the "err" attribute
+// after a colon, then the other attributes as key=value. Warnings and errors
+// are prefixed as such.
+type consoleHandler struct {
+	w     io.Writer
+	mu    *sync.Mutex
+	level slog.Level
+	times bool // prefix each line with the time
+	attrs []slog.Attr
+}
+
+func newConsoleHandler(w io.Writer, level slog.Level, times bool) *consoleHandler {
+	return &consoleHandler{w: w, mu: &sync.Mutex{}, level: level, times: times}
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if h.times {
+		b.WriteString(r.Time.Format("15:04:05.000 "))
+	}
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("Error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("Warning: ")
+	}
+	b.WriteString(r.Message)
+
+	attrs := append([]slog.Attr(nil), h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	for _, a := range attrs {
+		if a.Key == "err" {
+			b.WriteString(": " + a.Value.String())
+		}
+	}
+	for _, a := range attrs {
+		if a.Key != "err" {
+			b.WriteString(" " + a.Key + "=" + consoleValue(a.Value))
+		}
+	}
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func consoleValue(v slog.Value) string {
+	v = v.Resolve()
+	var s string
+	switch v.Kind() {
+	case slog.KindDuration:
+		s = v.Duration().Round(time.Millisecond).String()
+	default:
+		s = v.String()
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &c
+}
+
+// WithGroup is a no-op: the program does not group attributes.
+func (h *consoleHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// loggedInput logs each input action and its result at debug level. Moves
+// are left out: a --human-mouse glide is dozens of them.
+type loggedInput struct {
+	inputDriver
+}
+
+func logInput(err error, msg string, args ...any) error {
+	if err != nil {
+		args = append(args, "err", err)
+	}
+	slog.Debug(msg, args...)
+	return err
+}
+
+func (l loggedInput) click(button string, double bool) error {
+	return logInput(l.inputDriver.click(button, double), "Input click", "button", button, "double", double)
+}
+
+func (l loggedInput) toggle(button string, down bool) error {
+	return logInput(l.inputDriver.toggle(button, down), "Input button", "button", button, "down", down)
+}
+
+func (l loggedInput) keyTap(k keyPress) error {
+	return logInput(l.inputDriver.keyTap(k), "Input key", "key", k.String())
+}
+
+func (l loggedInput) typeText(text string) error {
+	// The text stays out of the log, like in the session log.
+	return logInput(l.inputDriver.typeText(text), "Input text", "chars", len([]rune(text)))
+}
+
+func (l loggedInput) scroll(n int) error {
+	return logInput(l.inputDriver.scroll(n), "Input scroll", "steps", n)
+}
+
+// fatal logs an error, with any attribute pairs in args, and exits with
+// status 1.
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append([]any{"err", err}, args...)...)
+	os.Exit(1)
+}
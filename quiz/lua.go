@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// luaFlow is a loaded --lua flow, run in process by gopher-lua (Lua 5.1).
+// The flow defines step(i), called once per iteration; returning false
+// ends the session.
+type luaFlow struct {
+	path string
+	L    *lua.LState
+	step *lua.LFunction
+
+	// s and run are the session and iteration of the step being run, for
+	// the Go functions the flow calls.
+	s   *session
+	run *scriptRun
+}
+
+// startLua loads the flow in path with the quiz functions defined.
+func startLua(path string) (*luaFlow, error) {
+	l := &luaFlow{path: path, L: lua.NewState()}
+	for name, fn := range l.functions() {
+		l.L.SetGlobal(name, l.L.NewFunction(fn))
+	}
+	// Lua's own output would land in the middle of the progress bar or the
+	// dashboard, so print and io.write log instead.
+	l.L.SetField(l.L.GetGlobal("io"), "write", l.L.NewFunction(l.print("")))
+
+	if err := l.L.DoFile(path); err != nil {
+		l.close()
+		return nil, err
+	}
+	step, ok := l.L.GetGlobal("step").(*lua.LFunction)
+	if !ok {
+		l.close()
+		return nil, fmt.Errorf("%s does not define step(i)", path)
+	}
+	l.step = step
+	return l, nil
+}
+
+func (l *luaFlow) close() {
+	if l != nil {
+		l.L.Close()
+	}
+}
+
+// runLua runs the flow's step(i). It returns the frame of the last capture
+// and whether the session should end, which it does when the flow returns
+// false.
+func (s *session) runLua(i int) (image.Image, bool) {
+	r := &scriptRun{i: i}
+	l := s.lua
+	l.s, l.run = s, r
+	err := l.L.CallByParam(lua.P{Fn: l.step, NRet: 1, Protect: true}, lua.LNumber(i))
+	if err != nil {
+		if s.halted != "" {
+			return r.frame, true
+		}
+		msg := err.Error()
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			msg = apiErr.Object.String()
+		}
+		slog.Error("in Lua step", "err", msg, "capture", i)
+		s.log.add(logEvent{Type: "error", Capture: i, Error: msg})
+		return r.frame, false
+	}
+	res := l.L.Get(-1)
+	l.L.Pop(1)
+	if res == lua.LFalse {
+		slog.Info("Lua flow finished")
+		return r.frame, true
+	}
+	return r.frame, false
+}
+
+// functions are the globals a flow calls. A failing call raises a Lua
+// error.
+func (l *luaFlow) functions() map[string]lua.LGFunction {
+	do := func(spec func(*lua.LState) string) lua.LGFunction {
+		return func(L *lua.LState) int {
+			a, err := parseAction(spec(L))
+			if err == nil {
+				err = l.runStep(a)
+			}
+			l.check(err)
+			return 0
+		}
+	}
+	num := func(L *lua.LState, n int) string {
+		return strconv.Itoa(int(L.CheckNumber(n)))
+	}
+
+	return map[string]lua.LGFunction{
+		"print": l.print("\t"),
+
+		"capture": func(L *lua.LState) int {
+			before := len(l.s.files)
+			l.check(l.runStep(action{kind: "capture"}))
+			if len(l.s.files) == before {
+				L.Push(lua.LNil) // failed or a duplicate
+			} else {
+				L.Push(lua.LString(l.s.files[len(l.s.files)-1]))
+			}
+			return 1
+		},
+		"click": do(func(L *lua.LState) string {
+			if L.Get(1) == lua.LNil {
+				return "click"
+			}
+			return "click:" + num(L, 1) + "," + num(L, 2)
+		}),
+		"key":    do(func(L *lua.LState) string { return "key:" + L.CheckString(1) }),
+		"keys":   do(func(L *lua.LState) string { return "keys:" + L.CheckString(1) }),
+		"scroll": do(func(L *lua.LState) string { return "scroll:" + num(L, 1) }),
+		"drag": do(func(L *lua.LState) string {
+			return "drag:" + num(L, 1) + "," + num(L, 2) + "->" + num(L, 3) + "," + num(L, 4)
+		}),
+		"act": do(func(L *lua.LState) string { return L.CheckString(1) }),
+
+		"type_text": func(L *lua.LState) int {
+			l.check(l.runStep(action{kind: "type", text: L.OptString(1, "")}))
+			return 0
+		},
+		"click_text": func(L *lua.LState) int {
+			l.check(l.runStep(action{kind: "click-text", text: L.CheckString(1)}))
+			return 0
+		},
+		"wait": func(L *lua.LState) int {
+			var d time.Duration
+			var err error
+			switch v := L.CheckAny(1).(type) {
+			case lua.LNumber:
+				d = time.Duration(float64(v) * float64(time.Second))
+			default:
+				d, err = time.ParseDuration(lua.LVAsString(v))
+			}
+			if err != nil || d < 0 {
+				L.RaiseError("wait wants seconds or a duration such as \"1.5s\", got %s", L.Get(1).String())
+			}
+			l.check(l.runStep(action{kind: "wait", wait: d}))
+			return 0
+		},
+		"wait_for_change": func(L *lua.LState) int {
+			l.check(l.runStep(action{kind: "wait-for-change"}))
+			return 0
+		},
+
+		"ocr": func(L *lua.LState) int {
+			l.check(l.running())
+			words, _, err := ocrScreen(l.s.opts)
+			l.check(err)
+			texts := make([]string, len(words))
+			for i, w := range words {
+				texts[i] = w.text
+			}
+			L.Push(lua.LString(strings.Join(texts, " ")))
+			return 1
+		},
+		"find_image": func(L *lua.LState) int {
+			l.check(l.running())
+			file := L.CheckString(1)
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(filepath.Dir(l.path), file)
+			}
+			img, err := decodeImageFile(file)
+			l.check(err)
+			p, score, err := searchScreen(toGray(img), l.s.opts)
+			l.check(err)
+			if score > l.s.opts.clickThreshold {
+				L.Push(lua.LNil)
+				return 1
+			}
+			L.Push(lua.LNumber(p.X))
+			L.Push(lua.LNumber(p.Y))
+			return 2
+		},
+	}
+}
+
+// print returns a print or io.write for the flow: it logs its arguments,
+// joined by sep, as one message per line.
+func (l *luaFlow) print(sep string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		parts := make([]string, L.GetTop())
+		for i := range parts {
+			parts[i] = lua.LVAsString(L.ToStringMeta(L.Get(i + 1)))
+		}
+		for _, line := range strings.Split(strings.TrimRight(strings.Join(parts, sep), "\n"), "\n") {
+			slog.Info(line)
+		}
+		return 0
+	}
+}
+
+// running reports errSessionLimit once the session has been halted, so a
+// flow stops acting on the screen.
+func (l *luaFlow) running() error {
+	if l.s == nil {
+		return fmt.Errorf("called outside step(i)")
+	}
+	if l.s.halted != "" {
+		return errSessionLimit
+	}
+	return nil
+}
+
+func (l *luaFlow) runStep(a action) error {
+	if err := l.running(); err != nil {
+		return err
+	}
+	return l.s.runStep(l.run, a, nil)
+}
+
+// check raises err in the flow.
+func (l *luaFlow) check(err error) {
+	if err != nil {
+		l.L.RaiseError("%s", err.Error())
+	}
+}
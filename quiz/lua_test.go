@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestStartLuaErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, flow, want string
+	}{
+		{"syntax.lua", "function step(i)\n", "syntax.lua"},
+		{"nostep.lua", "x = 1\n", "does not define step(i)"},
+		{"fails.lua", "error('at load')\n", "at load"},
+	}
+	for _, tt := range tests {
+		l, err := startLua(writeFile(t, dir, tt.name, tt.flow))
+		if err == nil {
+			l.close()
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: startLua error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestRunLua checks that step results, errors and output reach the
+// session rather than stdout.
+func TestRunLua(t *testing.T) {
+	var out bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(newConsoleHandler(&out, slog.LevelInfo, false)))
+
+	l, err := startLua(writeFile(t, t.TempDir(), "flow.lua", `
+local calls = 0
+function step(i)
+  calls = calls + 1
+  if i == 1 then print("step", i, calls) io.write("partial ", "line\n") end
+  if i == 2 then error("boom") end
+  if i == 3 then wait("soon") end
+  if i == 4 then key("tab") end
+  if i == 5 then return false end
+end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+	s := &session{lua: l, log: &sessionLog{}}
+
+	for _, tt := range []struct {
+		i      int
+		halted string
+		done   bool
+		err    string
+	}{
+		{1, "", false, ""},
+		{2, "", false, "boom"},
+		{3, "", false, "wait wants seconds"},
+		{4, "--max-actions reached", true, ""},
+		{5, "", true, ""},
+	} {
+		s.halted = tt.halted
+		before := len(s.log.Events)
+		if _, done := s.runLua(tt.i); done != tt.done {
+			t.Errorf("step %d: done = %v, want %v", tt.i, done, tt.done)
+		}
+		logged := s.log.Events[before:]
+		if tt.err == "" && len(logged) > 0 {
+			t.Errorf("step %d: logged %+v", tt.i, logged)
+		} else if tt.err != "" && (len(logged) != 1 || !strings.Contains(logged[0].Error, tt.err)) {
+			t.Errorf("step %d: logged %+v, want an error with %q", tt.i, logged, tt.err)
+		}
+	}
+	for _, want := range []string{"step\t1\t1\n", "partial line\n", "Lua flow finished\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("log lacks %q:\n%s", want, out.String())
+		}
+	}
+}
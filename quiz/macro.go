@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var macroNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// macroDir is where save-macro keeps named scripts: clitoolbox/macros in
+// the user's config directory, one subdirectory per macro holding the
+// script and the images it refers to. Macros saved in the old quiz/macros
+// are moved there.
+func macroDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	root := filepath.Join(dir, "clitoolbox", "macros")
+	old := filepath.Join(dir, "quiz", "macros")
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		if _, err := os.Stat(old); err == nil {
+			if err := os.MkdirAll(filepath.Dir(root), 0755); err != nil {
+				return "", err
+			}
+			if err := os.Rename(old, root); err != nil {
+				return "", fmt.Errorf("moving the macros from %s: %w", old, err)
+			}
+			os.Remove(filepath.Dir(old)) // only if nothing else is left in it
+			slog.Info("Moved the saved macros", "from", old, "to", root)
+		}
+	}
+	return root, nil
+}
+
+// macroScript returns the script file of the saved macro name.
+func macroScript(name string) (string, error) {
+	dir, err := macroDir()
+	if err != nil {
+		return "", err
+	}
+	for _, ext := range []string{".yaml", ".json"} {
+		path := filepath.Join(dir, name, "script"+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	names, _ := macroNames()
+	if len(names) == 0 {
+		return "", fmt.Errorf("macro %q not found; save one with save-macro", name)
+	}
+	return "", fmt.Errorf("macro %q not found (saved: %s)", name, strings.Join(names, ", "))
+}
+
+func macroNames() ([]string, error) {
+	dir, err := macroDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// saveMacro implements `save-macro NAME FILE`: it checks the script FILE
+// and copies it, with the images its blocks refer to, into the macro
+// library. Without arguments it lists the saved macros.
+func saveMacro(args []string) error {
+	if len(args) == 0 {
+		names, err := macroNames()
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if len(names) == 0 {
+			fmt.Println("No saved macros")
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s save-macro NAME SCRIPT_FILE", filepath.Base(os.Args[0]))
+	}
+	name, file := args[0], args[1]
+	if !macroNameRe.MatchString(name) {
+		return fmt.Errorf("invalid macro name %q (use letters, digits, '.', '_' and '-')", name)
+	}
+	steps, err := loadScript(file)
+	if err != nil {
+		return fmt.Errorf("invalid script: %w", err)
+	}
+
+	root, err := macroDir()
+	if err != nil {
+		return err
+	}
+	ext := ".yaml"
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		ext = ".json"
+	}
+	files := map[string]string{file: "script" + ext}
+	for _, img := range macroImages(steps) {
+		if filepath.IsAbs(img) {
+			continue
+		}
+		if !filepath.IsLocal(img) {
+			return fmt.Errorf("image %s is outside the script's folder; move it next to the script", img)
+		}
+		files[filepath.Join(filepath.Dir(file), img)] = img
+	}
+
+	dir := filepath.Join(root, name)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	for src, rel := range files {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Saved macro %q to %s; use it with --macro %s\n", name, dir, name)
+	return nil
+}
+
+// macroImages lists the image files named by script blocks.
+func macroImages(steps []action) []string {
+	var images []string
+	for _, a := range steps {
+		if a.image != nil {
+			images = append(images, a.text)
+		}
+		images = append(images, macroImages(a.then)...)
+		images = append(images, macroImages(a.els)...)
+	}
+	return images
+}
@@ -1,153 +1,253 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
-	"image"
-	_ "image/jpeg"
-	"image/png"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-vgo/robotgo"
-	"github.com/jung-kurt/gofpdf"
-	"github.com/kbinani/screenshot"
 )
 
 const (
 	screenshotDirPrefix = "Pictures"
 	screenshotPrefix    = "Q"
-	screenshotExt       = ".png"
 )
 
-func captureScreenshot(filePath string) error {
-	oldStderr := os.Stderr
-	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
-	if err == nil {
-		os.Stderr = devNull
+// runCommand implements `run`: the capture session, then the PDF.
+func runCommand(args []string) {
+	fs := newFlagSet("run")
+	opts, err := parseOptions(fs, args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fs.Usage()
+		os.Exit(1)
+	}
+	var dash *dashboard
+	switch opts.progress {
+	case "bar":
+		opts.view = newProgressBar(os.Stdout, opts.repetitions)
+	case "tui":
+		if dash, err = newDashboard(opts.repetitions); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.view = dash
+	}
+	setupLogging(opts)
+	if opts.listDisplays {
+		printDisplays(opts)
+		return
 	}
 
-	bounds := screenshot.GetDisplayBounds(0)
-	img, captureErr := screenshot.CaptureRect(bounds)
+	screenshotDir := outputDir(opts)
 
-	if devNull != nil {
-		os.Stderr = oldStderr
-		devNull.Close()
+	if opts.pickRegion {
+		region, err := pickRegion(bufio.NewReader(os.Stdin))
+		if err != nil {
+			fatal("selecting region", err)
+		}
+		opts.region = region
+		slog.Info("Using region", "region", fmt.Sprintf("%d,%d,%d,%d", region.Min.X, region.Min.Y, region.Dx(), region.Dy()))
 	}
 
-	err = captureErr
+	if opts.record != "" {
+		steps, err := recordScript(opts.record, opts)
+		if err != nil {
+			fatal("recording", err)
+		}
+		opts.script = steps
+	}
 
-	if err != nil {
-		return fmt.Errorf("screenshot capture failed: %w", err)
+	var flow *luaFlow
+	if opts.lua != "" {
+		if flow, err = startLua(opts.lua); err != nil {
+			fatal("loading --lua flow", err)
+		}
 	}
 
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+	if opts.browserURL != "" {
+		slog.Info("Opening the page in Chrome", "url", opts.browserURL)
+		if opts.browser, err = startBrowser(opts.browserURL, opts); err != nil {
+			fatal("starting browser", err)
+		}
+		opts.input = opts.browser
+	} else {
+		slog.Info("Position cursor now! Starting in 5 seconds...")
+		time.Sleep(5 * time.Second)
+	}
+	if opts.verbose {
+		opts.input = loggedInput{opts.input}
 	}
-	defer file.Close()
 
-	if err := png.Encode(file, img); err != nil {
-		return fmt.Errorf("failed to encode PNG: %w", err)
+	if opts.windowName != "" || opts.pid > 0 {
+		pid, err := resolveTargetPid(opts)
+		if err != nil {
+			fatal("finding target window", err)
+		}
+		opts.targetPid = pid
+		slog.Info("Target window", "title", robotgo.GetTitle(pid), "pid", pid)
 	}
 
-	return nil
-}
+	slog.Info("Starting automation...")
+
+	start := time.Now()
 
-func getImageDimensions(filePath string) (int, int, error) {
-	file, err := os.Open(filePath)
+	sess, err := newSession(opts, screenshotDir)
 	if err != nil {
-		return 0, 0, err
+		fatal("setting up hotkeys", err)
+	}
+	// The streamed PDF is renamed once the capture count for --out is known.
+	partialPath := filepath.Join(screenshotDir, fmt.Sprintf("Qz_%s.partial.pdf", start.Format("150405")))
+	if opts.stream && !opts.dryRun {
+		if sess.stream, err = newStreamPDF(partialPath, opts); err != nil {
+			fatal("creating PDF", err)
+		}
+	}
+	sess.lua = flow
+	if dash != nil {
+		if err := dash.start(); err != nil {
+			fatal("starting the dashboard", err)
+		}
 	}
-	defer file.Close()
+	sess.run()
+	dash.close()
+	flow.close()
+	opts.browser.close()
+	sess.summary()
+	screenshotFiles := sess.files
 
-	img, _, err := image.DecodeConfig(file)
-	if err != nil {
-		return 0, 0, err
+	if opts.dryRun {
+		pdfPath, err := outputPath(screenshotDir, start, len(screenshotFiles), opts)
+		if err != nil {
+			fatal("naming the PDF", err)
+		}
+		if opts.appendTo != "" {
+			pdfPath = opts.appendTo
+		}
+		slog.Info("Dry run finished", "pages", len(screenshotFiles), "pdf", pdfPath)
+		return
 	}
 
-	return img.Width, img.Height, nil
+	if opts.attachLog {
+		if opts.sessionLog, err = sess.log.encode(); err != nil {
+			fatal("encoding session log", err)
+		}
+	}
+	outputs := writeOutputs(screenshotFiles, screenshotDir, start, opts, sess.stream, partialPath)
+	sess.log.emit(logEvent{Type: "done", Outputs: outputs})
 }
 
-func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: go run main.go <number_of_repetitions>")
+// assembleCommand implements `assemble`: existing images into the PDF and
+// other outputs, as if a session had just captured them.
+func assembleCommand(args []string) {
+	fs := newFlagSet("assemble")
+	opts, err := parseOptions(fs, args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fs.Usage()
 		os.Exit(1)
 	}
-	repetitions, err := strconv.Atoi(os.Args[1])
-	if err != nil || repetitions < 1 {
-		fmt.Println("Error: Please provide a valid positive number")
-		os.Exit(1)
+	setupLogging(opts)
+	for _, file := range opts.images {
+		if _, err := os.Stat(file); err != nil {
+			fatal("reading images", err)
+		}
 	}
+	writeOutputs(opts.images, outputDir(opts), time.Now(), opts, nil, "")
+}
 
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		fmt.Printf("Error getting home directory: %v\n", err)
-		os.Exit(1)
+// outputDir returns --out-dir, or ~/Pictures, creating it.
+func outputDir(opts options) string {
+	dir := opts.outDir
+	if dir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			fatal("getting home directory", err)
+		}
+		dir = filepath.Join(homeDir, screenshotDirPrefix)
 	}
-	screenshotDir := filepath.Join(homeDir, screenshotDirPrefix)
-	if err := os.MkdirAll(screenshotDir, 0755); err != nil {
-		fmt.Printf("Error creating screenshot directory: %v\n", err)
-		os.Exit(1)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fatal("creating screenshot directory", err)
 	}
+	return dir
+}
 
-	fmt.Println("Position cursor now! Starting in 5 seconds...")
-	for i := 5; i > 0; i-- {
-		fmt.Printf("%d... ", i)
-		time.Sleep(1 * time.Second)
+// writeOutputs builds the PDF, exports and archive from the capture files
+// in screenshotDir and then applies --cleanup. With --stream, the PDF was
+// written during the session as stream, at partialPath. It returns the files
+// written.
+func writeOutputs(screenshotFiles []string, screenshotDir string, start time.Time, opts options, stream *streamPDF, partialPath string) []string {
+	pages, err := orderFiles(screenshotFiles, opts)
+	if err != nil {
+		fatal("reading --order-file", err)
+	}
+	pages = dedupePages(pages, opts)
+	rotated, rotateDir, err := rotatePages(pages, screenshotDir, opts)
+	if err != nil {
+		fatal("rotating pages", err)
 	}
-	fmt.Println("\nStarting automation...")
-
-	var screenshotFiles []string
-	for i := 1; i <= repetitions; i++ {
-		fmt.Printf("[%d/%d]\n", i, repetitions)
-
-		fileName := fmt.Sprintf("%s_%d%s", screenshotPrefix, i, screenshotExt)
-		filePath := filepath.Join(screenshotDir, fileName)
 
-		if err := captureScreenshot(filePath); err != nil {
-			fmt.Printf("Error taking screenshot: %v\n", err)
-			continue
+	pdfPath, err := outputPath(screenshotDir, start, len(screenshotFiles), opts)
+	if err != nil {
+		fatal("creating PDF", err)
+	}
+	pdfPaths := []string{pdfPath}
+	switch {
+	case !opts.export["pdf"]:
+		pdfPaths = nil
+	case stream != nil:
+		if err = stream.Close(); err == nil {
+			err = os.Rename(partialPath, pdfPath)
 		}
-
-		fmt.Printf("Screenshot saved: %s\n", filePath)
-		screenshotFiles = append(screenshotFiles, filePath)
-
-		time.Sleep(500 * time.Millisecond)
-		robotgo.Click("left")
-		time.Sleep(500 * time.Millisecond)
+	case opts.appendTo != "":
+		slog.Info("Converting to PDF with original image dimensions...")
+		pdfPaths[0] = opts.appendTo
+		err = appendPDF(opts.appendTo, rotated, opts)
+	default:
+		slog.Info("Converting to PDF with original image dimensions...")
+		pdfPaths, err = writePDFs(pdfPath, rotated, opts)
+	}
+	if err != nil {
+		fatal("creating PDF", err)
 	}
 
-	pdfTime := time.Now().Format("150405")
-	pdfName := fmt.Sprintf("Qz_%s.pdf", pdfTime)
-	pdfPath := filepath.Join(screenshotDir, pdfName)
-	fmt.Println("Converting to PDF with original image dimensions...")
-
-	pdf := gofpdf.New("P", "pt", "", "")
-	pdf.SetAutoPageBreak(false, 0)
-
-	for _, file := range screenshotFiles {
-		imgWidth, imgHeight, err := getImageDimensions(file)
-		if err != nil {
-			fmt.Printf("Error reading image dimensions for %s: %v\n", file, err)
-			continue
+	if opts.linearize {
+		password := opts.pdfOwnerPassword
+		if password == "" {
+			password = opts.pdfPassword
+		}
+		for _, path := range pdfPaths {
+			if err := linearizePDF(path, password); err != nil {
+				fatal("linearizing", err, "pdf", path)
+			}
 		}
-
-		pdf.AddPageFormat("P", gofpdf.SizeType{Wd: float64(imgWidth), Ht: float64(imgHeight)})
-		pdf.Image(file, 0, 0, float64(imgWidth), float64(imgHeight), false, "", 0, "")
 	}
 
-	if err := pdf.OutputFileAndClose(pdfPath); err != nil {
-		fmt.Printf("Error creating PDF: %v\n", err)
-		os.Exit(1)
+	exported, err := writeExports(pdfPath, rotated, opts)
+	if err != nil {
+		fatal("exporting", err)
+	}
+	outputs := append(pdfPaths, exported...)
+	if rotateDir != "" {
+		os.RemoveAll(rotateDir)
 	}
 
-	for _, file := range screenshotFiles {
-		if err := os.Remove(file); err != nil {
-			fmt.Printf("Error deleting file %s: %v\n", file, err)
+	// The archive keeps every capture as it was taken, including those
+	// --order-file and --dedupe-pages left out.
+	if opts.archive == "zip" {
+		path := exportPath(pdfPath, "zip")
+		if err := writeArchive(path, screenshotFiles, pages, opts); err != nil {
+			fatal("writing archive", err)
 		}
+		outputs = append(outputs, path)
 	}
 
-	fmt.Printf("✓ Done: %s\n", pdfPath)
+	cleanupImages(screenshotFiles, outputs[0], opts)
+
+	slog.Info("✓ Done", "outputs", strings.Join(outputs, ", "))
+	return outputs
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"sort"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// matchMinSide is the smallest template side, in pixels, kept by the coarse
+// search pass.
+const matchMinSide = 16
+
+func shrinkGray(g *image.Gray, factor int) *image.Gray {
+	if factor == 1 {
+		return g
+	}
+	b := g.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, max(1, b.Dx()/factor), max(1, b.Dy()/factor)))
+	xdraw.ApproxBiLinear.Scale(dst, dst.Bounds(), g, b, xdraw.Src, nil)
+	return dst
+}
+
+// sad returns the sum of absolute differences between tmpl and screen at
+// offset p, giving up once it exceeds limit.
+func sad(screen, tmpl *image.Gray, p image.Point, limit int) int {
+	tw, th := tmpl.Bounds().Dx(), tmpl.Bounds().Dy()
+	sum := 0
+	for y := 0; y < th; y++ {
+		srow := screen.Pix[(p.Y+y)*screen.Stride+p.X:]
+		trow := tmpl.Pix[y*tmpl.Stride:]
+		for x := 0; x < tw; x++ {
+			d := int(srow[x]) - int(trow[x])
+			if d < 0 {
+				d = -d
+			}
+			sum += d
+		}
+		if sum > limit {
+			return sum
+		}
+	}
+	return sum
+}
+
+// findTemplate locates tmpl in screen. It searches a downscaled copy first
+// and refines the best few candidates at full resolution. The score is the
+// mean absolute difference per pixel, from 0 (identical) to 1.
+func findTemplate(screen, tmpl *image.Gray) (image.Point, float64) {
+	sw, sh := screen.Bounds().Dx(), screen.Bounds().Dy()
+	tw, th := tmpl.Bounds().Dx(), tmpl.Bounds().Dy()
+	if tw > sw || th > sh {
+		return image.Point{}, 1
+	}
+
+	factor := max(1, min(4, min(tw, th)/matchMinSide))
+	small, smallTmpl := shrinkGray(screen, factor), shrinkGray(tmpl, factor)
+	type candidate struct {
+		p   image.Point
+		sum int
+	}
+	var candidates []candidate
+	const keep = 16
+	limit := int(^uint(0) >> 1)
+	for y := 0; y+smallTmpl.Bounds().Dy() <= small.Bounds().Dy(); y++ {
+		for x := 0; x+smallTmpl.Bounds().Dx() <= small.Bounds().Dx(); x++ {
+			p := image.Pt(x, y)
+			sum := sad(small, smallTmpl, p, limit)
+			if sum > limit {
+				continue
+			}
+			// Neighbouring offsets see the same match; keep only the better.
+			near := -1
+			for i, c := range candidates {
+				if d := c.p.Sub(p); d.X >= -1 && d.X <= 1 && d.Y >= -1 && d.Y <= 1 {
+					near = i
+					break
+				}
+			}
+			switch {
+			case near >= 0 && sum >= candidates[near].sum:
+				continue
+			case near >= 0:
+				candidates[near] = candidate{p, sum}
+			default:
+				candidates = append(candidates, candidate{p, sum})
+			}
+			sort.Slice(candidates, func(i, j int) bool { return candidates[i].sum < candidates[j].sum })
+			if len(candidates) >= keep {
+				candidates = candidates[:keep]
+				limit = candidates[keep-1].sum
+			}
+		}
+	}
+
+	best, bestSum := image.Point{}, int(^uint(0)>>1)
+	for _, c := range candidates {
+		for y := c.p.Y*factor - factor; y <= c.p.Y*factor+factor; y++ {
+			for x := c.p.X*factor - factor; x <= c.p.X*factor+factor; x++ {
+				if x < 0 || y < 0 || x+tw > sw || y+th > sh {
+					continue
+				}
+				if sum := sad(screen, tmpl, image.Pt(x, y), bestSum); sum < bestSum {
+					best, bestSum = image.Pt(x, y), sum
+				}
+			}
+		}
+	}
+	return best, float64(bestSum) / float64(tw*th*255)
+}
+
+// locateImage finds tmpl on the screen (all displays) and returns the
+// screen coordinates of its centre.
+func locateImage(tmpl *image.Gray, threshold float64, opts options) (image.Point, error) {
+	p, score, err := searchScreen(tmpl, opts)
+	if err != nil {
+		return image.Point{}, err
+	}
+	if score > threshold {
+		return image.Point{}, fmt.Errorf("reference image not found on screen (best match %.3f, threshold %.3f)", score, threshold)
+	}
+	return p, nil
+}
+
+// searchScreen returns the centre of the best match for tmpl on the screen
+// and its findTemplate score.
+func searchScreen(tmpl *image.Gray, opts options) (image.Point, float64, error) {
+	img, bounds, err := captureScreen(opts)
+	if err != nil {
+		return image.Point{}, 1, err
+	}
+	p, score := findTemplate(toGray(img), tmpl)
+	return bounds.Min.Add(p).Add(tmpl.Bounds().Size().Div(2)), score, nil
+}
+
+// captureScreen grabs all displays as one image, with its bounds in screen
+// coordinates; with --browser, the page's viewport.
+func captureScreen(opts options) (image.Image, image.Rectangle, error) {
+	if opts.browser != nil {
+		return opts.browser.screenshot(false)
+	}
+	all := opts
+	all.allDisplays = true
+	var img image.Image
+	var bounds image.Rectangle
+	var err error
+	withStderrSilenced(func() {
+		img, bounds, err = captureDisplays(all.displays(), opts)
+	})
+	if err != nil {
+		return nil, bounds, fmt.Errorf("screen capture failed: %w", err)
+	}
+	return img, bounds, nil
+}
+
+// stopImageFound reports whether the --stop-on-image reference is on
+// screen, ending the session.
+func (s *session) stopImageFound() bool {
+	if s.opts.stopImage == nil {
+		return false
+	}
+	p, score, err := searchScreen(s.opts.stopImage, s.opts)
+	if err != nil {
+		slog.Warn("--stop-on-image", "err", err)
+		return false
+	}
+	if score > s.opts.clickThreshold {
+		return false
+	}
+	slog.Info("Stop image found, stopping", "x", p.X, "y", p.Y)
+	return true
+}
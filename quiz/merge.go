@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// pdfMergers are the external tools tried, in order, to concatenate PDFs.
+var pdfMergers = []struct {
+	tool string
+	args func(out string, in []string) []string
+}{
+	{"qpdf", func(out string, in []string) []string {
+		return append(append([]string{"--empty", "--pages"}, in...), "--", out)
+	}},
+	{"pdfunite", func(out string, in []string) []string {
+		return append(in, out)
+	}},
+}
+
+// mergePDFs concatenates the input PDFs into out.
+func mergePDFs(out string, in ...string) error {
+	for _, m := range pdfMergers {
+		path, err := exec.LookPath(m.tool)
+		if err != nil {
+			continue
+		}
+		if msg, err := exec.Command(path, m.args(out, in)...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s failed: %w: %s", m.tool, err, msg)
+		}
+		return nil
+	}
+	return fmt.Errorf("merging PDFs requires qpdf or pdfunite")
+}
+
+// appendPDF writes the captures as a new PDF and appends its pages to target.
+// target is only replaced once the merge has succeeded.
+func appendPDF(target string, files []string, opts options) error {
+	dir := filepath.Dir(target)
+	pages, err := os.CreateTemp(dir, ".quiz-append-*.pdf")
+	if err != nil {
+		return err
+	}
+	pages.Close()
+	defer os.Remove(pages.Name())
+
+	if err := exportPDF(pages.Name(), files, opts); err != nil {
+		return err
+	}
+
+	merged := pages.Name() + ".merged"
+	if err := mergePDFs(merged, target, pages.Name()); err != nil {
+		os.Remove(merged)
+		return err
+	}
+	return os.Rename(merged, target)
+}
+
+// linearizePDF rewrites path in place as a linearized ("fast web view") PDF
+// using qpdf. password opens an encrypted file; its encryption is kept.
+func linearizePDF(path, password string) error {
+	tmp := path + ".linearized"
+	args := []string{"--linearize"}
+	if password != "" {
+		args = append(args, "--password="+password)
+	}
+	args = append(args, path, tmp)
+	if msg, err := exec.Command("qpdf", args...).CombinedOutput(); err != nil {
+		// Exit status 3 means qpdf succeeded with warnings.
+		if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 3 {
+			os.Remove(tmp)
+			return fmt.Errorf("qpdf failed: %w: %s", err, msg)
+		}
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Timing of --human-mouse movements: one step per humanMoveStep, taking
+// longer for longer distances.
+const (
+	humanMoveStep = 8 * time.Millisecond
+	humanMoveMin  = 150 * time.Millisecond
+	humanMoveMax  = 900 * time.Millisecond
+)
+
+// moveMouse puts the cursor at x,y: at once, or with --human-mouse along a
+// randomly curved path that speeds up and slows down like a hand.
+func moveMouse(x, y int, opts options) error {
+	in := opts.input
+	if !opts.humanMouse {
+		return in.move(x, y)
+	}
+
+	fx, fy, err := in.location()
+	if err != nil {
+		return err
+	}
+	x0, y0 := float64(fx), float64(fy)
+	dx, dy := float64(x)-x0, float64(y)-y0
+	dist := math.Hypot(dx, dy)
+	if dist < 1 {
+		return in.move(x, y)
+	}
+
+	// A cubic Bézier curve whose control points sit off the straight line
+	// by up to a quarter of its length, on either side.
+	bend := func() float64 { return (rand.Float64()*2 - 1) * dist / 4 }
+	nx, ny := -dy/dist, dx/dist
+	b1, b2 := bend(), bend()
+	x1, y1 := x0+dx*0.3+nx*b1, y0+dy*0.3+ny*b1
+	x2, y2 := x0+dx*0.7+nx*b2, y0+dy*0.7+ny*b2
+
+	d := humanMoveMin + time.Duration(dist)*time.Millisecond/2
+	d = min(d, humanMoveMax)
+	d = time.Duration(float64(d) * (0.8 + 0.4*rand.Float64()))
+	steps := max(2, int(d/humanMoveStep))
+	for k := 1; k < steps; k++ {
+		t := float64(k) / float64(steps)
+		t = t * t * (3 - 2*t) // ease in and out
+		u := 1 - t
+		px := u*u*u*x0 + 3*u*u*t*x1 + 3*u*t*t*x2 + t*t*t*float64(x)
+		py := u*u*u*y0 + 3*u*u*t*y1 + 3*u*t*t*y2 + t*t*t*float64(y)
+		if err := in.move(int(math.Round(px)), int(math.Round(py))); err != nil {
+			return err
+		}
+		time.Sleep(humanMoveStep)
+	}
+	return in.move(x, y)
+}
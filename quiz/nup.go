@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// nupGrids maps a --per-page count to columns and rows on a portrait page.
+var nupGrids = map[int][2]int{2: {1, 2}, 3: {1, 3}, 4: {2, 2}, 6: {2, 3}, 8: {2, 4}, 9: {3, 3}}
+
+// nupGap is the space between cells, in points; separators run down its middle.
+const nupGap = 12.0
+
+type cellRect struct{ x, y, w, h float64 }
+
+type nupLayout struct {
+	orientation string
+	size        gofpdf.SizeType
+	cells       []cellRect
+	cols, rows  int
+}
+
+// layoutNup divides a --page-size page, less margins, into a grid of cells.
+// Landscape pages transpose the portrait grid.
+func layoutNup(opts options) nupLayout {
+	grid := nupGrids[opts.perPage]
+	cols, rows := grid[0], grid[1]
+	size := pageSizes[opts.pageSize]
+	pw, ph := size.Wd, size.Ht
+	orientation := "P"
+	if opts.orientation == "L" {
+		orientation = "L"
+		cols, rows = rows, cols
+		pw, ph = ph, pw
+	}
+
+	m := opts.margin
+	cw := (pw - 2*m - float64(cols-1)*nupGap) / float64(cols)
+	ch := (ph - 2*m - float64(rows-1)*nupGap) / float64(rows)
+	l := nupLayout{orientation: orientation, size: size, cols: cols, rows: rows}
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			x := m + float64(c)*(cw+nupGap)
+			y := m + float64(r)*(ch+nupGap)
+			l.cells = append(l.cells, cellRect{x, y, cw, ch})
+		}
+	}
+	return l
+}
+
+// drawSeparators draws thin rules between the cells of the current page.
+func drawSeparators(pdf *gofpdf.Fpdf, l nupLayout) {
+	first, last := l.cells[0], l.cells[len(l.cells)-1]
+	pdf.SetDrawColor(180, 180, 180)
+	pdf.SetLineWidth(0.5)
+	for c := 1; c < l.cols; c++ {
+		x := l.cells[c].x - nupGap/2
+		pdf.Line(x, first.y, x, last.y+last.h)
+	}
+	for r := 1; r < l.rows; r++ {
+		y := l.cells[r*l.cols].y - nupGap/2
+		pdf.Line(first.x, y, last.x+last.w, y)
+	}
+}
+
+// addImageCell draws file into the given cell, starting a new page for cell 0,
+// and returns the cell's top for bookmarking.
+func addImageCell(pdf *gofpdf.Fpdf, file string, cell int, l nupLayout, opts options) (float64, error) {
+	if cell == 0 {
+		pdf.AddPageFormat(l.orientation, l.size)
+		drawSeparators(pdf, l)
+	}
+	c := l.cells[cell]
+
+	imgWidth, imgHeight, err := getImageDimensions(file)
+	if err != nil {
+		return c.y, fmt.Errorf("reading image dimensions: %w", err)
+	}
+	w := float64(imgWidth) / opts.pageScale
+	h := float64(imgHeight) / opts.pageScale
+	f := min(c.w/w, c.h/h)
+	w, h = w*f, h*f
+
+	if err := prepareImage(pdf, file, image.Pt(imgWidth, imgHeight), w, opts); err != nil {
+		return c.y, err
+	}
+	x, y := c.x+(c.w-w)/2, c.y+(c.h-h)/2
+	pdf.Image(file, x, y, w, h, false, "", 0, "")
+	if opts.ocr {
+		addTextLayer(pdf, file, x, y, w/float64(imgWidth), opts)
+	}
+	return c.y, nil
+}
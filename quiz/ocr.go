@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// ocrWord is one recognised word and its box in image pixels.
+type ocrWord struct {
+	text string
+	box  image.Rectangle
+	conf float64
+}
+
+// runOCR recognises the words in an image file with the tesseract CLI.
+func runOCR(file, lang string) ([]ocrWord, error) {
+	path, err := exec.LookPath("tesseract")
+	if err != nil {
+		return nil, fmt.Errorf("OCR requires tesseract")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, file, "stdout", "-l", lang, "tsv")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("tesseract failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseTSV(out), nil
+}
+
+// parseTSV reads the word rows (level 5) of tesseract's TSV output.
+func parseTSV(data []byte) []ocrWord {
+	var words []ocrWord
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(f) < 12 || f[0] != "5" {
+			continue
+		}
+		text := strings.TrimSpace(f[11])
+		conf, err := strconv.ParseFloat(f[10], 64)
+		if text == "" || err != nil || conf < 0 {
+			continue
+		}
+		var n [4]int
+		for i := range n {
+			n[i], _ = strconv.Atoi(f[6+i])
+		}
+		words = append(words, ocrWord{text: text, box: image.Rect(n[0], n[1], n[0]+n[2], n[1]+n[3]), conf: conf})
+	}
+	return words
+}
+
+// locateText OCRs the screen and returns the centre, in screen
+// coordinates, of the first run of words matching phrase. Case and
+// surrounding punctuation are ignored.
+func locateText(phrase string, opts options) (image.Point, error) {
+	want := strings.Fields(phrase)
+	for i := range want {
+		want[i] = ocrNormalize(want[i])
+	}
+	words, bounds, err := ocrScreen(opts)
+	if err != nil {
+		return image.Point{}, err
+	}
+
+	for i := 0; i+len(want) <= len(words); i++ {
+		box := words[i].box
+		n := 0
+		for n < len(want) && ocrNormalize(words[i+n].text) == want[n] {
+			box = box.Union(words[i+n].box)
+			n++
+		}
+		if n == len(want) {
+			c := box.Min.Add(box.Size().Div(2))
+			return bounds.Min.Add(c), nil
+		}
+	}
+	return image.Point{}, fmt.Errorf("text %q not found on screen", phrase)
+}
+
+// ocrScreen recognises the words on screen, returning them with the
+// screen bounds their boxes are relative to.
+func ocrScreen(opts options) ([]ocrWord, image.Rectangle, error) {
+	img, bounds, err := captureScreen(opts)
+	if err != nil {
+		return nil, bounds, err
+	}
+
+	f, err := os.CreateTemp("", "quiz-ocr-*.png")
+	if err != nil {
+		return nil, bounds, err
+	}
+	defer os.Remove(f.Name())
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, bounds, err
+	}
+	words, err := runOCR(f.Name(), opts.ocrLang)
+	return words, bounds, err
+}
+
+func ocrNormalize(word string) string {
+	return strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
+}
+
+// addTextLayer OCRs file and writes its words as invisible text over the
+// image drawn at x, y with the given points-per-pixel scale, so the page can
+// be searched and copied. OCR failures only cost the text layer.
+func addTextLayer(pdf *gofpdf.Fpdf, file string, x, y, scale float64, opts options) {
+	words, ok := opts.ocrWords[file]
+	if !ok {
+		var err error
+		if words, err = runOCR(file, opts.ocrLang); err != nil {
+			slog.Error("recognising text", "err", err, "file", file)
+			return
+		}
+		if opts.ocrWords != nil {
+			opts.ocrWords[file] = words
+		}
+	}
+
+	tr := textEncoder(pdf, opts)
+	pdf.SetTextRenderingMode(3) // invisible
+	for _, w := range words {
+		text := tr(w.text)
+		pdf.SetFont(fontFamily(opts), "", 10)
+		width := pdf.GetStringWidth(text)
+		if width <= 0 {
+			continue
+		}
+		// Size each word so its width matches the recognised box.
+		size := 10 * float64(w.box.Dx()) * scale / width
+		pdf.SetFont(fontFamily(opts), "", size)
+		pdf.Text(x+float64(w.box.Min.X)*scale, y+float64(w.box.Max.Y)*scale, text)
+	}
+	pdf.SetTextRenderingMode(0)
+}
@@ -0,0 +1,1229 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-vgo/robotgo"
+	"github.com/jung-kurt/gofpdf"
+)
+
+type options struct {
+	// What to capture.
+	display      int
+	allDisplays  bool
+	activeWindow bool
+	windowName   string
+	pid          int
+	targetPid    int
+	allWindows   bool
+	listDisplays bool
+	pickRegion   bool
+	region       image.Rectangle
+	backend      string
+	displayEnv   string
+
+	scrollCapture bool
+	scrollStep    int
+	scrollMax     int
+
+	// --browser captures and drives a Chrome page instead of the screen.
+	browserURL      string
+	browserBin      string
+	browserProfile  string
+	browserHeadless bool
+	browser         *browser
+
+	// Image processing.
+	showCursor       bool
+	masks            rectList
+	maskMode         string
+	iccProfile       *iccProfile
+	toSRGB           bool
+	crop             margins
+	rotate           int
+	rotateAuto       bool
+	resize           float64
+	maxWidth         int
+	maxHeight        int
+	stamp            string
+	stampPos         string
+	stampSize        float64
+	watermark        image.Image
+	watermarkPos     string
+	watermarkOpacity float64
+	grayscale        bool
+
+	// Output.
+	format     string
+	quality    int
+	pngLevel   png.CompressionLevel
+	scale      string
+	logicalDPI float64
+	pageScale  float64
+
+	tiffCompression string
+
+	// PDF.
+	embedFormat  string
+	embedQuality int
+	pdfDPI       float64
+	orientation  string
+	pageSize     string
+	perPage      int
+	outTemplate  string
+	outDir       string
+	export       map[string]bool
+	order        string
+	orderFile    string
+	archive      string
+	cleanup      string
+	appendTo     string
+	images       []string
+	stream       bool
+	pdfBackend   string
+	linearize    bool
+	splitEvery   int
+	maxPDFSize   int64
+	firstPage    int // captures before this PDF part, for bookmark labels
+	margin       float64
+
+	pageRotations []pageRotation
+
+	pdfTitle    string
+	pdfAuthor   string
+	pdfSubject  string
+	pdfKeywords string
+	bookmarks   bool
+	labels      []string
+	toc         bool
+	ocr         bool
+	ocrLang     string
+	ocrWords    map[string][]ocrWord // recognised text by capture, kept while PDF parts are rewritten
+	cover       bool
+	title       string
+	settings    []string // flags given on the command line, for the cover page
+	attachLog   bool
+	sessionLog  []byte // JSON session log embedded by --attach-log
+
+	pageNumbers     string
+	pageNumbersPos  string
+	pageNumbersSize float64
+	header          string
+	headerPos       string
+	footer          string
+	footerPos       string
+	pageFont        string
+	pageTextSize    float64
+
+	pdfa             bool
+	protect          bool
+	pdfPassword      string
+	pdfOwnerPassword string
+	pdfPermissions   byte
+
+	// Session control.
+	repetitions int
+	triggerKey  string
+	stopKey     string
+	pauseKey    string
+	maxPages    int
+	maxDuration time.Duration
+	maxActions  int
+	failsafe    bool
+	dryRun      bool
+	verbose     bool
+	quiet       bool
+	logFormat   string
+	progress    string
+	view        progressView
+
+	action         action
+	clickType      string
+	humanMouse     bool
+	restoreMouse   bool
+	focus          bool // reactivate the --window/--pid window before each input action
+	input          inputDriver
+	keyDelay       time.Duration
+	typeDelay      time.Duration
+	script         []action     // --script steps run each iteration instead of capture and advance
+	do             actionList   // --do actions run in place of --action
+	answers        []string     // --answers lines, typed by a type step without text
+	record         string       // --record file, recorded before the session and replayed as a script
+	lua            string       // --lua flow file, run by the embedded interpreter
+	clickAt        *image.Point // nil clicks wherever the mouse is
+	clickImage     *image.Gray  // reference image located and clicked each iteration
+	clickThreshold float64
+	clickCycle     []image.Point
+	clickElement   elementQuery
+	stopImage      *image.Gray // reference image whose appearance ends the session
+
+	interval       time.Duration
+	duration       time.Duration
+	retries        int
+	retryBackoff   time.Duration
+	captureDelay   time.Duration
+	preClickDelay  time.Duration
+	postClickDelay time.Duration
+	jitter         time.Duration
+
+	dedupe          string
+	dedupeDistance  int
+	dedupePages     string
+	waitChange      bool
+	changeThreshold float64
+	changeTimeout   time.Duration
+	stopUnchanged   int
+}
+
+func (o options) capturesSingleDisplay() bool {
+	return !o.allDisplays && !o.activeWindow && o.windowName == "" && o.pid == 0 && !o.pickRegion && o.region.Empty()
+}
+
+func (o options) imageExt() string {
+	switch o.format {
+	case "jpeg":
+		return ".jpg"
+	case "webp", "avif":
+		return "." + o.format
+	}
+	return ".png"
+}
+
+func (o options) displays() []int {
+	if !o.allDisplays {
+		return []int{o.display}
+	}
+	active, _ := o.activeDisplays()
+	ids := make([]int, len(active))
+	for i := range ids {
+		ids[i] = i
+	}
+	return ids
+}
+
+// flagValues holds the flags that parseOptions checks and converts into
+// options fields itself.
+type flagValues struct {
+	configFile      *string
+	profile         *string
+	region          *string
+	crop            *string
+	rotate          *string
+	watermark       *string
+	iccSpec         *string
+	pngLevel        *string
+	orientation     *string
+	margin          *string
+	rotatePagesSpec *string
+	export          *string
+	keepImages      *bool
+	maxPDFSize      *string
+	deny            *string
+	labelsFile      *string
+	actionSpec      *string
+	keys            *string
+	answersFile     *string
+	macro           *string
+	scriptFile      *string
+	clickCycle      *string
+	clickAt         *string
+	clickImage      *string
+	stopImage       *string
+	trigger         *string
+	input           *string
+}
+
+// defineFlags defines the session flags on fs, storing plain values in
+// opts and returning the rest.
+func defineFlags(fs *flag.FlagSet, opts *options) *flagValues {
+	v := &flagValues{}
+	v.configFile = fs.String("config", "", "read default flag values from this YAML `file`; flags on the command line win (default ~/.config/clitoolbox/quiz.yaml)")
+	v.profile = fs.String("profile", "", "use the flag values saved as `name` with `profile add`; they override the config file")
+	fs.IntVar(&opts.display, "display", 0, "index of the display to capture")
+	fs.BoolVar(&opts.allDisplays, "all-displays", false, "capture every display and stitch them into one image")
+	fs.BoolVar(&opts.activeWindow, "active-window", false, "capture only the focused window, re-reading its bounds every iteration")
+	fs.StringVar(&opts.windowName, "window", "", "capture the window whose process name or title contains `name`")
+	fs.IntVar(&opts.pid, "pid", 0, "capture the window belonging to process `pid`")
+	fs.BoolVar(&opts.allWindows, "all-windows", false, "with --window/--pid, capture every window of the process as its own page")
+	fs.BoolVar(&opts.listDisplays, "list-displays", false, "list available displays and exit")
+	v.region = fs.String("region", "", "capture only the rectangle `x,y,w,h` in screen coordinates")
+	fs.BoolVar(&opts.pickRegion, "pick-region", false, "interactively select the capture region with the mouse before starting")
+	fs.StringVar(&opts.backend, "backend", "auto", "capture backend: auto (grim when WAYLAND_DISPLAY is set), grim, or native (X11/macOS/Windows)")
+	fs.StringVar(&opts.displayEnv, "display-env", "", "X display to use, e.g. :99 for an Xvfb virtual display (overrides $DISPLAY)")
+	fs.BoolVar(&opts.scrollCapture, "scroll-capture", false, "scroll the area under the mouse and stitch the segments into one tall capture")
+	fs.IntVar(&opts.scrollStep, "scroll-step", 5, "mouse wheel clicks per scroll-capture step")
+	fs.IntVar(&opts.scrollMax, "scroll-max", 10, "maximum number of segments per scroll capture")
+	fs.StringVar(&opts.browserURL, "browser", "", "open this `url` in Chrome and capture and drive the page over the DevTools protocol instead of the screen, mouse and keyboard")
+	fs.StringVar(&opts.browserBin, "browser-bin", "", "Chrome or Chromium `binary` for --browser (default: the first found on PATH)")
+	fs.StringVar(&opts.browserProfile, "browser-profile", "", "Chrome profile `dir` for --browser, e.g. to stay logged in (default: a fresh temporary profile)")
+	fs.BoolVar(&opts.browserHeadless, "browser-headless", true, "run the --browser Chrome without a window")
+	fs.BoolVar(&opts.showCursor, "show-cursor", false, "draw the mouse cursor onto each capture")
+	fs.Var(&opts.masks, "mask", "black out or blur the rectangle `x,y,w,h` (relative to the capture); repeatable")
+	fs.StringVar(&opts.maskMode, "mask-mode", "black", "how to mask regions: black or blur")
+	fs.BoolVar(&opts.grayscale, "grayscale", false, "convert captures to 8-bit grayscale")
+	v.crop = fs.String("crop", "", "trim `top,right,bottom,left` pixels from every capture")
+	v.rotate = fs.String("rotate", "0", "rotate captures clockwise: 0, 90, 180, 270, or auto to follow the monitor's orientation")
+	fs.Float64Var(&opts.resize, "resize", 1, "scale captures by this factor, e.g. 0.5")
+	fs.IntVar(&opts.maxWidth, "max-width", 0, "downscale captures wider than this many pixels")
+	fs.IntVar(&opts.maxHeight, "max-height", 0, "downscale captures taller than this many pixels")
+	fs.StringVar(&opts.stamp, "stamp", "", "label each capture, e.g. \"{index} {time}\" (also {date}, {datetime})")
+	fs.StringVar(&opts.stampPos, "stamp-pos", "bottom-left", "label position: top-left, top-right, bottom-left, bottom-right or center")
+	fs.Float64Var(&opts.stampSize, "stamp-size", 0, "label font size in pixels (0 scales with the image)")
+	v.watermark = fs.String("watermark", "", "overlay this image `file` on every capture")
+	fs.StringVar(&opts.watermarkPos, "watermark-pos", "bottom-right", "watermark position: top-left, top-right, bottom-left, bottom-right or center")
+	fs.Float64Var(&opts.watermarkOpacity, "watermark-opacity", 0.3, "watermark opacity (0-1)")
+	v.iccSpec = fs.String("icc-profile", "", "display ICC profile `path`, or auto to read it from the display server")
+	fs.BoolVar(&opts.toSRGB, "to-srgb", false, "convert captures from the display profile to sRGB")
+	fs.StringVar(&opts.format, "format", "png", "image format for captures: png, jpeg, webp or avif")
+	fs.IntVar(&opts.quality, "quality", 90, "JPEG/WebP/AVIF quality (1-100)")
+	v.pngLevel = fs.String("png-level", "default", "PNG compression: none, best-speed, default or best-compression")
+	fs.StringVar(&opts.scale, "scale", "1", "pixels per PDF point: a factor like 2, or auto to detect display scaling")
+	fs.Float64Var(&opts.logicalDPI, "logical-dpi", 0, "treat captures as having this DPI when sizing PDF pages (overrides --scale)")
+	fs.StringVar(&opts.embedFormat, "embed-format", "auto", "image format inside the PDF: auto (as captured), png or jpeg")
+	fs.IntVar(&opts.embedQuality, "embed-quality", 85, "JPEG quality (1-100) for --embed-format jpeg")
+	fs.Float64Var(&opts.pdfDPI, "pdf-dpi", 0, "downsample images whose resolution on the page exceeds this DPI (0 keeps full resolution)")
+	v.orientation = fs.String("orientation", "auto", "PDF page orientation: auto (follow each image), portrait or landscape")
+	fs.StringVar(&opts.pageSize, "page-size", "", "fit each image onto a standard page: A3, A4, A5, Letter or Legal (default: page matches the image)")
+	v.margin = fs.String("margin", "0", "blank `length` around each image on the page, e.g. 36pt, 12mm, 0.5in (default unit pt)")
+	v.rotatePagesSpec = fs.String("rotate-pages", "", "rotate PDF pages clockwise: DEGREES for all pages, or RANGE:DEGREES entries like 5-10:180, comma separated")
+	fs.IntVar(&opts.perPage, "per-page", 1, "tile this many captures onto each page: 1, 2, 3, 4, 6, 8 or 9 (uses --page-size, default A4)")
+	fs.StringVar(&opts.outTemplate, "out", defaultOutTemplate, "PDF file name `template`; placeholders {date}, {time}, {title}, {count}, {host}")
+	fs.StringVar(&opts.outDir, "out-dir", "", "`directory` for screenshots and the PDF (default ~/Pictures)")
+	v.export = fs.String("export", "pdf", "comma-separated output formats: pdf, cbz (comic archive), epub (fixed-layout e-book) and tiff (multi-page)")
+	fs.StringVar(&opts.tiffCompression, "tiff-compression", "lzw", "compression for --export tiff: lzw, deflate or none")
+	fs.StringVar(&opts.order, "order", "capture", "page order in the output: capture or reverse")
+	fs.StringVar(&opts.orderFile, "order-file", "", "read the page order from `file`: one capture number or file name per line; unlisted captures follow")
+	fs.StringVar(&opts.archive, "archive", "", "also bundle the original screenshots and a manifest into an archive next to the PDF: zip")
+	fs.StringVar(&opts.cleanup, "cleanup", "delete", "what to do with screenshots after the PDF is written: delete, keep or move (into a folder named after the PDF)")
+	v.keepImages = fs.Bool("keep-images", false, "keep the screenshots after the PDF is written (same as --cleanup keep)")
+	fs.StringVar(&opts.pdfBackend, "pdf-backend", "gofpdf", "PDF writer: gofpdf (all features) or pdfcpu (image pages, no cover, TOC, page text or OCR)")
+	fs.BoolVar(&opts.stream, "stream", false, "write each page to the PDF as soon as it is captured, so a crash keeps the pages so far")
+	fs.BoolVar(&opts.linearize, "linearize", false, "linearize the PDF for fast web view so it renders before fully downloaded (needs qpdf)")
+	fs.StringVar(&opts.appendTo, "append", "", "add the pages to this existing PDF `file` instead of creating a new one (needs qpdf or pdfunite)")
+	fs.IntVar(&opts.splitEvery, "split-every", 0, "start a new numbered PDF after this many captures (0 disables)")
+	v.maxPDFSize = fs.String("max-pdf-size", "", "keep each PDF under this `size`, e.g. 20MB, splitting into numbered files")
+	fs.StringVar(&opts.pdfTitle, "pdf-title", "", "PDF document title")
+	fs.StringVar(&opts.pdfAuthor, "pdf-author", "", "PDF document author")
+	fs.StringVar(&opts.pdfSubject, "pdf-subject", "", "PDF document subject")
+	fs.StringVar(&opts.pdfKeywords, "pdf-keywords", "", "PDF document keywords, space or comma separated")
+	fs.BoolVar(&opts.bookmarks, "bookmarks", true, "add a PDF outline entry per page")
+	fs.StringVar(&opts.pageNumbers, "page-numbers", "", "draw this page number `format` on every PDF page; placeholders {page} and {pages}")
+	fs.StringVar(&opts.pageNumbersPos, "page-numbers-pos", "bottom-center", "page number position: top-left, top-center, top-right, bottom-left, bottom-center or bottom-right")
+	fs.Float64Var(&opts.pageNumbersSize, "page-numbers-size", 0, "page number font size in points; 0 scales with the page")
+	fs.StringVar(&opts.header, "header", "", "draw this `template` at the top of every PDF page; placeholders {session}, {page}, {pages}, {date}, {time}, {datetime}")
+	fs.StringVar(&opts.headerPos, "header-pos", "top-center", "header position, same values as --page-numbers-pos")
+	fs.StringVar(&opts.footer, "footer", "", "draw this `template` at the bottom of every PDF page, same placeholders as --header")
+	fs.StringVar(&opts.footerPos, "footer-pos", "bottom-left", "footer position, same values as --page-numbers-pos")
+	fs.StringVar(&opts.pageFont, "page-font", "helvetica", "font for header, footer and page numbers: helvetica, times or courier")
+	fs.Float64Var(&opts.pageTextSize, "page-text-size", 0, "header and footer font size in points; 0 scales with the page")
+	fs.BoolVar(&opts.pdfa, "pdfa", false, "write PDF/A-2b archival output (embedded fonts and sRGB profile, XMP metadata, no encryption)")
+	fs.StringVar(&opts.pdfPassword, "pdf-password", "", "password required to open the PDF")
+	fs.StringVar(&opts.pdfOwnerPassword, "pdf-owner-password", "", "password granting full access to the PDF (default random, i.e. none)")
+	v.deny = fs.String("pdf-deny", "", "comma-separated permissions to withhold: print, copy, modify, annotate")
+	fs.BoolVar(&opts.toc, "toc", false, "start the PDF with a contents page linking to each capture")
+	fs.BoolVar(&opts.ocr, "ocr", false, "add an invisible OCR text layer so the PDF is searchable (needs tesseract)")
+	fs.StringVar(&opts.ocrLang, "ocr-lang", "eng", "tesseract language(s) for --ocr, e.g. eng+deu")
+	fs.BoolVar(&opts.attachLog, "attach-log", false, "embed a JSON session log (timings, clicks, errors, settings) in the PDF as a file attachment")
+	fs.BoolVar(&opts.cover, "cover", false, "start the PDF with a cover page describing the session")
+	fs.StringVar(&opts.title, "title", "", "session title shown on the cover page; also the default --pdf-title")
+	v.labelsFile = fs.String("bookmark-labels", "", "read bookmark labels from `file`, one per line (default \"Question N\")")
+	v.actionSpec = fs.String("action", "click", "how to advance after each capture: click, key:NAME (e.g. key:PageDown, key:Right, key:Space), type:TEXT, click-text:TEXT, scroll:N (wheel steps, negative scrolls down) or drag:x1,y1->x2,y2")
+	v.keys = fs.String("keys", "", "advance by pressing this comma-separated key `sequence`, e.g. \"tab,tab,enter\"")
+	fs.DurationVar(&opts.keyDelay, "key-delay", 100*time.Millisecond, "wait this long between the keys of --keys")
+	fs.StringVar(&opts.clickType, "click-type", "left", "mouse click used by --action click: left, right, middle or double")
+	fs.Var(&opts.do, "do", "run this `action` after each capture instead of --action; repeatable, in order (e.g. --do click:1200,800 --do wait:2s --do key:PageDown)")
+	fs.DurationVar(&opts.typeDelay, "type-delay", 50*time.Millisecond, "wait this long between the characters of a type action")
+	v.answersFile = fs.String("answers", "", "`file` with one answer per line; a type action without text types the current question's line")
+	fs.StringVar(&opts.record, "record", "", "record one iteration of clicks and key presses (F9 marks the capture, F10 ends) into this script `file`, then replay it every iteration (X11, needs xinput)")
+	v.macro = fs.String("macro", "", "run the script saved as `name` with save-macro, like --script")
+	fs.StringVar(&opts.lua, "lua", "", "run step(i) from this Lua `file` every iteration instead of capture-then-advance")
+	v.scriptFile = fs.String("script", "", "run the steps in this `file` (YAML list or JSON) every iteration instead of capture-then-advance")
+	v.clickCycle = fs.String("click-cycle", "", "click these `x1,y1;x2,y2` points in turn, one per iteration, e.g. a Reveal button then a Next button")
+	v.clickAt = fs.String("click-at", "", "move the mouse to `x,y` and click there every iteration (default: click at the current mouse position)")
+	fs.StringVar(&opts.clickElement.name, "click-element", "", "click the button or other control whose accessibility `name` is this (AT-SPI on Linux), falling back to --click-at when it is not found")
+	fs.StringVar(&opts.clickElement.role, "element-role", "", "with --click-element, only match elements whose accessibility role contains this, e.g. button or link")
+	v.clickImage = fs.String("click-image", "", "find this reference image `file` (e.g. a Next button) on screen every iteration and click its centre")
+	v.stopImage = fs.String("stop-on-image", "", "end the session once this reference image `file` (e.g. a Results button) appears on screen after a capture")
+	fs.Float64Var(&opts.clickThreshold, "click-threshold", 0.1, "largest mean pixel difference (0-1) accepted as a --click-image or --stop-on-image match")
+	v.trigger = fs.String("trigger", "loop", "what starts each capture: loop, or hotkey:KEY (e.g. hotkey:F9)")
+	fs.StringVar(&opts.stopKey, "stop-key", "", "global hotkey that ends the session and builds the PDF (default F10 when no count is given)")
+	fs.StringVar(&opts.pauseKey, "pause-key", "F8", "global hotkey that pauses the session and, pressed again, resumes it (empty disables)")
+	fs.IntVar(&opts.maxPages, "max-pages", 500, "safety limit on captures when running without a count")
+	fs.DurationVar(&opts.maxDuration, "max-duration", 0, "hard limit on how long the session runs, e.g. 30m; the PDF is still built (0 = no limit)")
+	fs.IntVar(&opts.maxActions, "max-actions", 0, "hard limit on clicks, key presses and other input actions, after which the session stops and the PDF is built (0 = no limit)")
+	fs.BoolVar(&opts.failsafe, "failsafe", true, "stop the session, still building the PDF, as soon as the mouse is pushed into a screen corner")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "walk through the session, moving the mouse but without clicking, typing or saving files, and print what would happen")
+	fs.BoolVar(&opts.verbose, "verbose", false, "also log capture timings and every click, key press and other input action with its result")
+	fs.BoolVar(&opts.quiet, "quiet", false, "log only warnings and errors")
+	fs.StringVar(&opts.logFormat, "log-format", "text", "log format: text (stdout) or json (one object per line on stderr)")
+	fs.StringVar(&opts.progress, "progress", "auto", "progress reporting: bar (a status line with elapsed time, ETA, capture rate and errors), lines (\"[i/N]\" log lines), json (one event per capture, action and error on stdout; text logs move to stderr), tui (a full-screen dashboard with the last capture, errors and p/q keys to pause and stop), or auto (bar on a terminal, else lines)")
+	fs.DurationVar(&opts.interval, "interval", 0, "time-lapse mode: capture on this interval without clicking")
+	fs.DurationVar(&opts.duration, "duration", 0, "time-lapse mode: stop after this long")
+	fs.IntVar(&opts.retries, "retries", 2, "retry a failed capture this many times")
+	fs.DurationVar(&opts.retryBackoff, "retry-backoff", 250*time.Millisecond, "initial wait before retrying a failed capture; doubles each attempt")
+	fs.DurationVar(&opts.captureDelay, "capture-delay", 0, "wait this long before each capture")
+	fs.DurationVar(&opts.preClickDelay, "pre-click-delay", 500*time.Millisecond, "wait this long between a capture and the click")
+	fs.DurationVar(&opts.postClickDelay, "post-click-delay", 500*time.Millisecond, "wait this long after each click")
+	v.input = fs.String("input", "robotgo", "how mouse and keyboard input is sent: robotgo (built in) or xdotool (X11, needs the xdotool command)")
+	fs.BoolVar(&opts.focus, "focus", false, "with --window/--pid, bring the target window back to the front before each click, key press, scroll or typed text")
+	fs.BoolVar(&opts.humanMouse, "human-mouse", false, "move the mouse to click and scroll targets along a curved, variable-speed path instead of jumping")
+	fs.BoolVar(&opts.restoreMouse, "restore-mouse", false, "put the cursor back where it was after each click, scroll or drag")
+	fs.DurationVar(&opts.jitter, "jitter", 0, "randomize delays by up to this much either way and nudge --click-at/--click-image targets by a few pixels")
+	fs.StringVar(&opts.dedupe, "dedupe", "off", "skip captures identical to the previous one: off, exact or perceptual")
+	fs.StringVar(&opts.dedupePages, "dedupe-pages", "off", "when building the PDF, drop pages identical to the one before: off, exact (same file bytes) or perceptual")
+	fs.IntVar(&opts.stopUnchanged, "stop-unchanged", 0, "end the session once this many consecutive captures match the one before (the quiz no longer advances); the repeats are discarded")
+	fs.IntVar(&opts.dedupeDistance, "dedupe-distance", 4, "max perceptual hash distance (0-64) treated as a duplicate")
+	fs.BoolVar(&opts.waitChange, "wait-for-change", false, "after each click, wait until the screen changes before the next capture")
+	fs.Float64Var(&opts.changeThreshold, "change-threshold", 0.005, "fraction of pixels that must differ to count as a change")
+	fs.DurationVar(&opts.changeTimeout, "change-timeout", 10*time.Second, "give up waiting for a change after this long")
+	return v
+}
+
+// parseOptions defines the session flags on fs, which names the command
+// (run or assemble), and parses args with them.
+func parseOptions(fs *flag.FlagSet, args []string) (options, error) {
+	var opts options
+	assemble := fs.Name() == "assemble"
+	v := defineFlags(fs, &opts)
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	// The command line wins over the environment, then the profile, then
+	// the config file.
+	if err := loadEnv(fs); err != nil {
+		return opts, err
+	}
+	if *v.profile != "" {
+		if err := loadProfile(fs, *v.profile); err != nil {
+			return opts, err
+		}
+	}
+	if err := loadConfig(fs, *v.configFile); err != nil {
+		return opts, err
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		if !coverHidden[f.Name] {
+			opts.settings = append(opts.settings, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+		}
+	})
+	if opts.pdfTitle == "" {
+		opts.pdfTitle = opts.title
+	}
+
+	if opts.displayEnv != "" {
+		if err := useXDisplay(opts.displayEnv); err != nil {
+			return opts, fmt.Errorf("invalid --display-env: %w", err)
+		}
+	}
+
+	if *v.region != "" {
+		r, err := parseRect(*v.region)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --region: %w", err)
+		}
+		opts.region = r
+	}
+
+	if opts.listDisplays {
+		return opts, nil
+	}
+
+	if opts.verbose && opts.quiet {
+		return opts, fmt.Errorf("--verbose and --quiet are mutually exclusive")
+	}
+	if opts.logFormat != "text" && opts.logFormat != "json" {
+		return opts, fmt.Errorf("unsupported --log-format %q (want text or json)", opts.logFormat)
+	}
+	switch opts.progress {
+	case "auto":
+		opts.progress = "lines"
+		if isTerminal(os.Stdout) {
+			opts.progress = "bar"
+		}
+	case "bar", "lines", "json", "tui":
+	default:
+		return opts, fmt.Errorf("unsupported --progress %q (want bar, lines, json, tui or auto)", opts.progress)
+	}
+
+	if *v.crop != "" {
+		v, err := parseInts(*v.crop, 4)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --crop: %w", err)
+		}
+		for _, n := range v {
+			if n < 0 {
+				return opts, fmt.Errorf("invalid --crop: margins must not be negative")
+			}
+		}
+		opts.crop = margins{top: v[0], right: v[1], bottom: v[2], left: v[3]}
+	}
+	a, err := parseAction(*v.actionSpec)
+	if err != nil {
+		return opts, fmt.Errorf("invalid --action: %w", err)
+	}
+	switch a.kind {
+	case "click", "key", "keys", "type", "click-text", "scroll", "drag":
+	default:
+		return opts, fmt.Errorf("unsupported --action %q (want click, key:NAME, type[:TEXT], click-text:TEXT, scroll:N or drag:x1,y1->x2,y2)", *v.actionSpec)
+	}
+	opts.action = a
+	if *v.keys != "" {
+		if *v.actionSpec != "click" {
+			return opts, fmt.Errorf("--keys cannot be combined with --action")
+		}
+		seq, err := parseKeys(*v.keys)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --keys: %w", err)
+		}
+		opts.action = action{kind: "keys", keys: seq}
+	}
+	if opts.keyDelay < 0 || opts.typeDelay < 0 {
+		return opts, fmt.Errorf("--key-delay and --type-delay must not be negative")
+	}
+	if *v.answersFile != "" {
+		data, err := os.ReadFile(*v.answersFile)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --answers: %w", err)
+		}
+		opts.answers = strings.Split(strings.TrimRight(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"), "\n")
+	}
+	if len(opts.do.actions) > 0 && (*v.actionSpec != "click" || *v.keys != "") {
+		return opts, fmt.Errorf("--do cannot be combined with --action or --keys")
+	}
+	if *v.macro != "" {
+		if *v.scriptFile != "" {
+			return opts, fmt.Errorf("--macro and --script are mutually exclusive")
+		}
+		path, err := macroScript(*v.macro)
+		if err != nil {
+			return opts, err
+		}
+		*v.scriptFile = path
+	}
+	if *v.scriptFile != "" || opts.record != "" {
+		if *v.actionSpec != "click" || *v.keys != "" || len(opts.do.actions) > 0 {
+			return opts, fmt.Errorf("--script and --record cannot be combined with --action, --keys or --do")
+		}
+	}
+	if *v.scriptFile != "" && opts.record != "" {
+		return opts, fmt.Errorf("--script and --record are mutually exclusive")
+	}
+	if opts.lua != "" {
+		if *v.scriptFile != "" || opts.record != "" || *v.actionSpec != "click" || *v.keys != "" || len(opts.do.actions) > 0 {
+			return opts, fmt.Errorf("--lua cannot be combined with --script, --macro, --record, --action, --keys or --do")
+		}
+		if _, err := os.Stat(opts.lua); err != nil {
+			return opts, fmt.Errorf("invalid --lua: %w", err)
+		}
+	}
+	if *v.scriptFile != "" {
+		steps, err := loadScript(*v.scriptFile)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --script: %w", err)
+		}
+		opts.script = steps
+	}
+
+	if *v.clickAt != "" {
+		v, err := parseInts(*v.clickAt, 2)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --click-at: %w", err)
+		}
+		opts.clickAt = &image.Point{X: v[0], Y: v[1]}
+	}
+	if *v.clickCycle != "" {
+		for _, pt := range strings.Split(*v.clickCycle, ";") {
+			v, err := parseInts(pt, 2)
+			if err != nil {
+				return opts, fmt.Errorf("invalid --click-cycle: %w", err)
+			}
+			opts.clickCycle = append(opts.clickCycle, image.Point{X: v[0], Y: v[1]})
+		}
+		if opts.clickAt != nil {
+			return opts, fmt.Errorf("--click-cycle and --click-at are mutually exclusive")
+		}
+	}
+
+	if *v.clickImage != "" {
+		img, err := decodeImageFile(*v.clickImage)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --click-image: %w", err)
+		}
+		opts.clickImage = toGray(img)
+	}
+	if *v.stopImage != "" {
+		img, err := decodeImageFile(*v.stopImage)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --stop-on-image: %w", err)
+		}
+		opts.stopImage = toGray(img)
+	}
+	if opts.clickThreshold < 0 || opts.clickThreshold > 1 {
+		return opts, fmt.Errorf("--click-threshold must be between 0 and 1")
+	}
+	opts.input = inputDrivers[*v.input]
+	if opts.input == nil {
+		return opts, fmt.Errorf("unsupported --input %q (want robotgo or xdotool)", *v.input)
+	}
+	if *v.input == "xdotool" {
+		if _, err := exec.LookPath("xdotool"); err != nil {
+			return opts, fmt.Errorf("--input xdotool requires xdotool")
+		}
+	}
+	switch opts.clickType {
+	case "left", "right", "middle", "double":
+	default:
+		return opts, fmt.Errorf("unsupported --click-type %q (want left, right, middle or double)", opts.clickType)
+	}
+	if opts.action.kind != "click" && opts.clickImage != nil {
+		return opts, fmt.Errorf("--click-image needs --action click")
+	}
+	if opts.clickElement.name != "" && (opts.action.kind != "click" || opts.clickImage != nil) {
+		return opts, fmt.Errorf("--click-element needs --action click and no --click-image")
+	}
+	if opts.clickElement.role != "" && opts.clickElement.name == "" {
+		return opts, fmt.Errorf("--element-role requires --click-element")
+	}
+	if opts.clickCycle != nil && (opts.action.kind != "click" || opts.clickImage != nil) {
+		return opts, fmt.Errorf("--click-cycle needs --action click and no --click-image")
+	}
+	if len(opts.action.keys) > 0 && opts.clickAt != nil {
+		return opts, fmt.Errorf("--click-at cannot be combined with key actions")
+	}
+
+	switch {
+	case *v.trigger == "loop":
+	case strings.HasPrefix(*v.trigger, "hotkey:") && len(*v.trigger) > len("hotkey:"):
+		opts.triggerKey = strings.TrimPrefix(*v.trigger, "hotkey:")
+	default:
+		return opts, fmt.Errorf("unsupported --trigger %q (want loop or hotkey:KEY)", *v.trigger)
+	}
+
+	if opts.maxDuration < 0 || opts.maxActions < 0 {
+		return opts, fmt.Errorf("--max-duration and --max-actions must not be negative")
+	}
+	if opts.retries < 0 || opts.retryBackoff < 0 {
+		return opts, fmt.Errorf("--retries and --retry-backoff must not be negative")
+	}
+
+	if opts.interval < 0 || opts.duration < 0 {
+		return opts, fmt.Errorf("--interval and --duration must not be negative")
+	}
+	if opts.duration > 0 && opts.interval == 0 {
+		return opts, fmt.Errorf("--duration requires --interval")
+	}
+	if opts.interval > 0 && (len(opts.script) > 0 || opts.record != "" || opts.lua != "") {
+		return opts, fmt.Errorf("--script, --record and --lua cannot be combined with --interval")
+	}
+
+	if opts.captureDelay < 0 || opts.preClickDelay < 0 || opts.postClickDelay < 0 || opts.jitter < 0 {
+		return opts, fmt.Errorf("delays must not be negative")
+	}
+	switch opts.dedupe {
+	case "off", "exact", "perceptual":
+	default:
+		return opts, fmt.Errorf("unsupported --dedupe %q (want off, exact or perceptual)", opts.dedupe)
+	}
+	if opts.stopUnchanged < 0 {
+		return opts, fmt.Errorf("--stop-unchanged must not be negative")
+	}
+	switch opts.dedupePages {
+	case "off", "exact", "perceptual":
+	default:
+		return opts, fmt.Errorf("unsupported --dedupe-pages %q (want off, exact or perceptual)", opts.dedupePages)
+	}
+	if opts.changeThreshold < 0 || opts.changeThreshold >= 1 {
+		return opts, fmt.Errorf("--change-threshold must be in [0, 1)")
+	}
+	switch *v.rotate {
+	case "auto":
+		opts.rotate, opts.rotateAuto = -1, true
+	case "0", "90", "180", "270":
+		opts.rotate, _ = strconv.Atoi(*v.rotate)
+	default:
+		return opts, fmt.Errorf("unsupported --rotate %q (want 0, 90, 180, 270 or auto)", *v.rotate)
+	}
+	if opts.resize <= 0 {
+		return opts, fmt.Errorf("--resize must be positive")
+	}
+	if opts.maxWidth < 0 || opts.maxHeight < 0 {
+		return opts, fmt.Errorf("--max-width and --max-height must not be negative")
+	}
+
+	if *v.iccSpec != "" {
+		profile, err := loadICCProfile(*v.iccSpec)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --icc-profile: %w", err)
+		}
+		opts.iccProfile = profile
+	} else if opts.toSRGB {
+		return opts, fmt.Errorf("--to-srgb requires --icc-profile")
+	}
+
+	if opts.scrollCapture && (opts.scrollStep < 1 || opts.scrollMax < 1) {
+		return opts, fmt.Errorf("--scroll-step and --scroll-max must be positive")
+	}
+
+	switch opts.backend {
+	case "auto", "grim", "native":
+	default:
+		return opts, fmt.Errorf("unsupported --backend %q (want auto, grim or native)", opts.backend)
+	}
+
+	if !validPosition(opts.stampPos) {
+		return opts, fmt.Errorf("unsupported --stamp-pos %q", opts.stampPos)
+	}
+
+	if *v.watermark != "" {
+		img, err := decodeImageFile(*v.watermark)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --watermark: %w", err)
+		}
+		opts.watermark = img
+	}
+	if !validPosition(opts.watermarkPos) {
+		return opts, fmt.Errorf("unsupported --watermark-pos %q", opts.watermarkPos)
+	}
+	if opts.watermarkOpacity < 0 || opts.watermarkOpacity > 1 {
+		return opts, fmt.Errorf("--watermark-opacity must be between 0 and 1")
+	}
+
+	for name, pos := range map[string]string{"page-numbers-pos": opts.pageNumbersPos, "header-pos": opts.headerPos, "footer-pos": opts.footerPos} {
+		if !validPageTextPosition(pos) {
+			return opts, fmt.Errorf("unsupported --%s %q", name, pos)
+		}
+	}
+	opts.pageFont = strings.ToLower(opts.pageFont)
+	if _, ok := pageFonts[opts.pageFont]; !ok {
+		return opts, fmt.Errorf("unsupported --page-font %q (want helvetica, times or courier)", opts.pageFont)
+	}
+
+	switch strings.ToLower(opts.embedFormat) {
+	case "auto", "png":
+		opts.embedFormat = strings.ToLower(opts.embedFormat)
+	case "jpeg", "jpg":
+		opts.embedFormat = "jpeg"
+	default:
+		return opts, fmt.Errorf("unsupported --embed-format %q (want auto, png or jpeg)", opts.embedFormat)
+	}
+	if opts.embedQuality < 1 || opts.embedQuality > 100 {
+		return opts, fmt.Errorf("--embed-quality must be between 1 and 100")
+	}
+
+	switch strings.ToLower(*v.orientation) {
+	case "auto":
+		opts.orientation = "auto"
+	case "portrait", "p":
+		opts.orientation = "P"
+	case "landscape", "l":
+		opts.orientation = "L"
+	default:
+		return opts, fmt.Errorf("unsupported --orientation %q (want auto, portrait or landscape)", *v.orientation)
+	}
+
+	if opts.outDir != "" {
+		dir, err := expandHome(opts.outDir)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --out-dir: %w", err)
+		}
+		opts.outDir = dir
+	}
+
+	opts.export = map[string]bool{}
+	for _, f := range strings.Split(strings.ToLower(*v.export), ",") {
+		f = strings.TrimSpace(f)
+		switch f {
+		case "pdf", "cbz", "epub", "tiff":
+		default:
+			return opts, fmt.Errorf("unsupported --export %q (want pdf, cbz, epub or tiff)", f)
+		}
+		opts.export[f] = true
+	}
+	if opts.order != "capture" && opts.order != "reverse" {
+		return opts, fmt.Errorf("unsupported --order %q (want capture or reverse)", opts.order)
+	}
+	if opts.orderFile != "" {
+		if _, err := os.Stat(opts.orderFile); err != nil {
+			return opts, fmt.Errorf("invalid --order-file: %w", err)
+		}
+		if opts.order == "reverse" {
+			return opts, fmt.Errorf("--order reverse cannot be combined with --order-file")
+		}
+	}
+
+	if _, ok := tiffCompressions[opts.tiffCompression]; !ok {
+		return opts, fmt.Errorf("unsupported --tiff-compression %q (want lzw, deflate or none)", opts.tiffCompression)
+	}
+
+	if opts.archive != "" && opts.archive != "zip" {
+		return opts, fmt.Errorf("unsupported --archive %q (want zip)", opts.archive)
+	}
+	if !opts.export["pdf"] && (opts.stream || opts.appendTo != "") {
+		return opts, fmt.Errorf("--stream and --append need pdf in --export")
+	}
+
+	if *v.keepImages || (assemble && !set["cleanup"]) {
+		opts.cleanup = "keep"
+	}
+	switch opts.cleanup {
+	case "delete", "keep", "move":
+	default:
+		return opts, fmt.Errorf("unsupported --cleanup %q (want delete, keep or move)", opts.cleanup)
+	}
+
+	if opts.appendTo != "" {
+		if _, err := os.Stat(opts.appendTo); err != nil {
+			return opts, fmt.Errorf("invalid --append: %w", err)
+		}
+	}
+
+	if opts.splitEvery < 0 {
+		return opts, fmt.Errorf("--split-every must not be negative")
+	}
+	if *v.maxPDFSize != "" {
+		size, err := parseSize(*v.maxPDFSize)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --max-pdf-size: %w", err)
+		}
+		opts.maxPDFSize = size
+	}
+	if opts.appendTo != "" && (opts.splitEvery > 0 || opts.maxPDFSize > 0) {
+		return opts, fmt.Errorf("--append cannot be combined with --split-every or --max-pdf-size")
+	}
+
+	if _, ok := nupGrids[opts.perPage]; !ok && opts.perPage != 1 {
+		return opts, fmt.Errorf("unsupported --per-page %d (want 1, 2, 3, 4, 6, 8 or 9)", opts.perPage)
+	}
+	if opts.perPage > 1 && opts.pageSize == "" {
+		opts.pageSize = "a4"
+	}
+
+	if opts.pageSize != "" {
+		opts.pageSize = strings.ToLower(opts.pageSize)
+		if _, ok := pageSizes[opts.pageSize]; !ok {
+			return opts, fmt.Errorf("unsupported --page-size %q (want A3, A4, A5, Letter or Legal)", opts.pageSize)
+		}
+	}
+
+	m, err := parseLength(*v.margin)
+	if err != nil {
+		return opts, fmt.Errorf("invalid --margin: %w", err)
+	}
+	opts.margin = m
+	if size, ok := pageSizes[opts.pageSize]; ok && 2*m >= size.Wd {
+		return opts, fmt.Errorf("--margin too large for --page-size %s", opts.pageSize)
+	}
+
+	if *v.rotatePagesSpec != "" {
+		rotations, err := parsePageRotations(*v.rotatePagesSpec)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --rotate-pages: %w", err)
+		}
+		opts.pageRotations = rotations
+	}
+
+	if opts.pdfDPI < 0 {
+		return opts, fmt.Errorf("--pdf-dpi must not be negative")
+	}
+
+	if opts.pdfPassword != "" || opts.pdfOwnerPassword != "" || *v.deny != "" {
+		opts.protect = true
+		perms, err := parsePermissions(*v.deny)
+		if err != nil {
+			return opts, err
+		}
+		opts.pdfPermissions = perms
+	}
+
+	if opts.ocr {
+		if _, err := exec.LookPath("tesseract"); err != nil {
+			return opts, fmt.Errorf("--ocr requires tesseract")
+		}
+	}
+	steps := append([]action{opts.action}, opts.do.actions...)
+	if opts.browserURL != "" {
+		switch {
+		case !opts.capturesSingleDisplay() || opts.allWindows || opts.scrollCapture:
+			return opts, fmt.Errorf("--browser captures the page; drop the screen area flags (--window, --region, --scroll-capture...)")
+		case *v.input != "robotgo":
+			return opts, fmt.Errorf("--browser sends its own input and cannot be combined with --input")
+		case opts.record != "" || opts.showCursor || opts.focus || opts.clickElement.name != "":
+			return opts, fmt.Errorf("--record, --show-cursor, --focus and --click-element need the real screen, not --browser")
+		}
+		if _, err := browserBinary(opts.browserBin); err != nil {
+			return opts, err
+		}
+	} else if usesAction("click-selector", append(steps, opts.script...)) || usesAction("navigate", append(steps, opts.script...)) {
+		return opts, fmt.Errorf("click-selector and navigate need --browser")
+	}
+	if usesAction("click-text", append(steps, opts.script...)) {
+		if _, err := exec.LookPath("tesseract"); err != nil {
+			return opts, fmt.Errorf("click-text requires tesseract")
+		}
+	}
+
+	if opts.linearize {
+		if _, err := exec.LookPath("qpdf"); err != nil {
+			return opts, fmt.Errorf("--linearize requires qpdf")
+		}
+	}
+
+	if opts.pdfa && opts.protect {
+		return opts, fmt.Errorf("--pdfa does not allow encryption (--pdf-password, --pdf-owner-password, --pdf-deny)")
+	}
+	if opts.pdfa && opts.appendTo != "" {
+		return opts, fmt.Errorf("--pdfa cannot be combined with --append")
+	}
+	if opts.attachLog && (opts.pdfa || opts.appendTo != "") {
+		return opts, fmt.Errorf("--attach-log cannot be combined with --pdfa (PDF/A-2 forbids attachments) or --append")
+	}
+
+	if _, ok := pdfBackends[opts.pdfBackend]; !ok {
+		return opts, fmt.Errorf("unsupported --pdf-backend %q (want gofpdf or pdfcpu)", opts.pdfBackend)
+	}
+	if opts.stream || opts.pdfBackend == "pdfcpu" {
+		name := "--pdf-backend pdfcpu"
+		unsupported := map[string]bool{
+			"--per-page":                       opts.perPage > 1,
+			"--toc":                            opts.toc,
+			"--cover":                          opts.cover,
+			"--ocr":                            opts.ocr,
+			"--header/--footer/--page-numbers": opts.header != "" || opts.footer != "" || opts.pageNumbers != "",
+		}
+		if opts.stream {
+			name = "--stream"
+			unsupported["--pdfa"] = opts.pdfa
+			unsupported["--attach-log"] = opts.attachLog
+			unsupported["encryption"] = opts.protect
+			unsupported["--append"] = opts.appendTo != ""
+			unsupported["--split-every/--max-pdf-size"] = opts.splitEvery > 0 || opts.maxPDFSize > 0
+			unsupported["--order/--order-file"] = opts.order != "capture" || opts.orderFile != ""
+			unsupported["--dedupe-pages"] = opts.dedupePages != "off"
+			unsupported["--rotate-pages"] = len(opts.pageRotations) > 0
+		}
+		for feature, set := range unsupported {
+			if set {
+				return opts, fmt.Errorf("%s does not support %s", name, feature)
+			}
+		}
+	}
+
+	if *v.labelsFile != "" {
+		data, err := os.ReadFile(*v.labelsFile)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --bookmark-labels: %w", err)
+		}
+		opts.labels = strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+		for i := range opts.labels {
+			opts.labels[i] = strings.TrimSpace(opts.labels[i])
+		}
+	}
+
+	if opts.maskMode != "black" && opts.maskMode != "blur" {
+		return opts, fmt.Errorf("unsupported --mask-mode %q (want black or blur)", opts.maskMode)
+	}
+
+	switch strings.ToLower(opts.format) {
+	case "png":
+		opts.format = "png"
+	case "jpeg", "jpg":
+		opts.format = "jpeg"
+	case "webp", "avif":
+		opts.format = strings.ToLower(opts.format)
+	default:
+		return opts, fmt.Errorf("unsupported --format %q (want png, jpeg, webp or avif)", opts.format)
+	}
+	switch *v.pngLevel {
+	case "none":
+		opts.pngLevel = png.NoCompression
+	case "best-speed":
+		opts.pngLevel = png.BestSpeed
+	case "default":
+		opts.pngLevel = png.DefaultCompression
+	case "best-compression":
+		opts.pngLevel = png.BestCompression
+	default:
+		return opts, fmt.Errorf("unsupported --png-level %q", *v.pngLevel)
+	}
+	if opts.quality < 1 || opts.quality > 100 {
+		return opts, fmt.Errorf("--quality must be between 1 and 100")
+	}
+
+	switch {
+	case opts.logicalDPI < 0:
+		return opts, fmt.Errorf("--logical-dpi must be positive")
+	case opts.logicalDPI > 0:
+		opts.pageScale = opts.logicalDPI / 72
+	case opts.scale == "auto":
+		opts.pageScale = robotgo.ScaleF()
+	default:
+		f, err := strconv.ParseFloat(opts.scale, 64)
+		if err != nil || f <= 0 {
+			return opts, fmt.Errorf("invalid --scale %q", opts.scale)
+		}
+		opts.pageScale = f
+	}
+
+	if assemble {
+		if fs.NArg() == 0 {
+			return opts, fmt.Errorf("no images to assemble")
+		}
+		if opts.stream || opts.attachLog {
+			return opts, fmt.Errorf("--stream and --attach-log only apply to run")
+		}
+		opts.images = fs.Args()
+		return opts, nil
+	}
+	switch fs.NArg() {
+	case 0:
+		if opts.stopKey == "" && opts.duration == 0 {
+			opts.stopKey = "F10"
+		}
+		if opts.maxPages < 1 {
+			return opts, fmt.Errorf("--max-pages must be positive")
+		}
+	case 1:
+		repetitions, err := strconv.Atoi(fs.Arg(0))
+		if err != nil || repetitions < 1 {
+			return opts, fmt.Errorf("please provide a valid positive number")
+		}
+		opts.repetitions = repetitions
+	default:
+		return opts, fmt.Errorf("expected at most one argument: [number_of_repetitions]")
+	}
+	if opts.pauseKey != "" && (opts.pauseKey == opts.stopKey || opts.pauseKey == opts.triggerKey) {
+		return opts, fmt.Errorf("--pause-key %s is already used by --stop-key or --trigger", opts.pauseKey)
+	}
+
+	active, err := opts.activeDisplays()
+	if err != nil {
+		return opts, err
+	}
+	n := len(active)
+	if n == 0 {
+		return opts, fmt.Errorf("no active displays found")
+	}
+	if opts.capturesSingleDisplay() && (opts.display < 0 || opts.display >= n) {
+		return opts, fmt.Errorf("display %d not found (%d available, see --list-displays)", opts.display, n)
+	}
+	if opts.allWindows && opts.windowName == "" && opts.pid == 0 {
+		return opts, fmt.Errorf("--all-windows requires --window or --pid")
+	}
+	if opts.windowName != "" && opts.pid > 0 {
+		return opts, fmt.Errorf("--window and --pid are mutually exclusive")
+	}
+	if opts.focus && opts.windowName == "" && opts.pid == 0 {
+		return opts, fmt.Errorf("--focus requires --window or --pid")
+	}
+	if opts.failsafe && set["failsafe"] {
+		if _, _, err := failsafeWatch(); err != nil {
+			return opts, fmt.Errorf("--failsafe unavailable: %w", err)
+		}
+	}
+
+	return opts, nil
+}
+
+func printDisplays(opts options) {
+	active, err := opts.activeDisplays()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(active) == 0 {
+		fmt.Println("No active displays found")
+		return
+	}
+	for i, d := range active {
+		b := d.bounds
+		fmt.Printf("%d: %dx%d at (%d,%d)", i, b.Dx(), b.Dy(), b.Min.X, b.Min.Y)
+		if d.name != "" {
+			fmt.Printf(" %s", d.name)
+		}
+		fmt.Println()
+	}
+}
+
+type margins struct {
+	top, right, bottom, left int
+}
+
+type rectList []image.Rectangle
+
+func (l *rectList) String() string {
+	parts := make([]string, len(*l))
+	for i, r := range *l {
+		parts[i] = fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l *rectList) Set(s string) error {
+	r, err := parseRect(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, r)
+	return nil
+}
+
+// actionList collects repeated --do flags in order.
+type actionList struct {
+	specs   []string
+	actions []action
+}
+
+func (l *actionList) String() string {
+	return strings.Join(l.specs, " ")
+}
+
+func (l *actionList) Set(s string) error {
+	a, err := parseAction(s)
+	if err != nil {
+		return err
+	}
+	switch a.kind {
+	case "click", "key", "keys", "type", "click-text", "scroll", "drag", "wait":
+	default:
+		return fmt.Errorf("--do supports click, key, keys, type, click-text, scroll, drag and wait, not %s", a.kind)
+	}
+	l.specs = append(l.specs, s)
+	l.actions = append(l.actions, a)
+	return nil
+}
+
+// useXDisplay points the screenshot library (via $DISPLAY) and robotgo at
+// the given X display before either opens a connection.
+func useXDisplay(name string) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("only supported on X11")
+	}
+	if err := os.Setenv("DISPLAY", name); err != nil {
+		return err
+	}
+	return robotgo.SetXDisplayName(name)
+}
+
+func parseInts(s string, count int) ([]int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != count {
+		return nil, fmt.Errorf("expected %d comma-separated values, got %d", count, len(parts))
+	}
+	values := make([]int, count)
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", p)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func parseRect(s string) (image.Rectangle, error) {
+	v, err := parseInts(s, 4)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	if v[2] <= 0 || v[3] <= 0 {
+		return image.Rectangle{}, fmt.Errorf("width and height must be positive")
+	}
+	return image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), nil
+}
+
+// expandHome replaces a leading ~ in path with the user's home directory.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// parseLength parses a non-negative length such as 36pt, 12mm, 1.5cm or 0.5in
+// into points. A bare number is taken as points.
+func parseLength(s string) (float64, error) {
+	units := []struct {
+		suffix string
+		points float64
+	}{{"pt", 1}, {"mm", 72 / 25.4}, {"cm", 72 / 2.54}, {"in", 72}}
+
+	s = strings.ToLower(strings.TrimSpace(s))
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, factor = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.points
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected a length like 36pt or 12mm")
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("length must not be negative")
+	}
+	return v * factor, nil
+}
+
+// parseSize parses a byte count with an optional KB, MB or GB suffix
+// (powers of 1024).
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		bytes  float64
+	}{{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}, {"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"b", 1}}
+
+	s = strings.ToLower(strings.TrimSpace(s))
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, factor = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.bytes
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("expected a size like 20MB")
+	}
+	return int64(v * factor), nil
+}
+
+// parsePermissions turns a --pdf-deny list into the gofpdf flags to grant.
+func parsePermissions(deny string) (byte, error) {
+	flags := map[string]byte{
+		"print":    gofpdf.CnProtectPrint,
+		"copy":     gofpdf.CnProtectCopy,
+		"modify":   gofpdf.CnProtectModify,
+		"annotate": gofpdf.CnProtectAnnotForms,
+	}
+	var allow byte = gofpdf.CnProtectPrint | gofpdf.CnProtectCopy | gofpdf.CnProtectModify | gofpdf.CnProtectAnnotForms
+	for _, p := range strings.Split(deny, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		f, ok := flags[p]
+		if !ok {
+			return 0, fmt.Errorf("unsupported --pdf-deny permission %q (want print, copy, modify or annotate)", p)
+		}
+		allow &^= f
+	}
+	return allow, nil
+}
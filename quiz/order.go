@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// orderFiles returns the captures in the sequence they should appear in the
+// output: reversed for --order reverse, or as listed in --order-file. Lines
+// in the order file name a capture by number (1-based) or file name;
+// captures it does not mention follow in capture order.
+func orderFiles(files []string, opts options) ([]string, error) {
+	if opts.orderFile == "" {
+		if opts.order != "reverse" {
+			return files, nil
+		}
+		out := make([]string, len(files))
+		for i, f := range files {
+			out[len(files)-1-i] = f
+		}
+		return out, nil
+	}
+
+	data, err := os.ReadFile(opts.orderFile)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]int, len(files))
+	for i, f := range files {
+		byName[filepath.Base(f)] = i
+	}
+
+	used := make([]bool, len(files))
+	var out []string
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i, ok := byName[filepath.Base(line)]
+		if num, err := strconv.Atoi(line); err == nil {
+			i, ok = num-1, num >= 1 && num <= len(files)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: no capture %q", opts.orderFile, n+1, line)
+		}
+		if used[i] {
+			return nil, fmt.Errorf("%s:%d: capture %q listed twice", opts.orderFile, n+1, line)
+		}
+		used[i] = true
+		out = append(out, files[i])
+	}
+	for i, f := range files {
+		if !used[i] {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
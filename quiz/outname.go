@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultOutTemplate = "Qz_{time}.pdf"
+
+// filenameUnsafe lists characters replaced in values substituted into --out.
+var filenameUnsafe = strings.NewReplacer("/", "_", `\`, "_", ":", "_", "*", "_", "?", "_", `"`, "_", "<", "_", ">", "_", "|", "_")
+
+// expandOutName fills the --out placeholders: {date}, {time}, {title},
+// {count} and {host}.
+func expandOutName(template string, start time.Time, count int, opts options) string {
+	title := strings.TrimSpace(opts.title)
+	if title == "" {
+		title = "untitled"
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	name := strings.NewReplacer(
+		"{date}", start.Format("2006-01-02"),
+		"{time}", start.Format("150405"),
+		"{title}", filenameUnsafe.Replace(title),
+		"{count}", strconv.Itoa(count),
+		"{host}", filenameUnsafe.Replace(host),
+	).Replace(template)
+	if !strings.EqualFold(filepath.Ext(name), ".pdf") {
+		name += ".pdf"
+	}
+	return name
+}
+
+// outputPath resolves the --out template against dir and avoids overwriting
+// existing files by adding _2, _3, ... before the extension.
+func outputPath(dir string, start time.Time, count int, opts options) (string, error) {
+	name := expandOutName(opts.outTemplate, start, count, opts)
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path, nil
+		}
+		path = fmt.Sprintf("%s_%d%s", base, n, ext)
+	}
+}
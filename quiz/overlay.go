@@ -0,0 +1,92 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+var overlayPositions = []string{"top-left", "top-right", "bottom-left", "bottom-right", "center"}
+
+func validPosition(pos string) bool {
+	for _, p := range overlayPositions {
+		if p == pos {
+			return true
+		}
+	}
+	return false
+}
+
+// anchorRect places a box of the given size inside bounds at pos, inset by margin.
+func anchorRect(bounds image.Rectangle, size image.Point, pos string, margin int) image.Rectangle {
+	x := bounds.Min.X + margin
+	y := bounds.Min.Y + margin
+	if strings.HasSuffix(pos, "right") {
+		x = bounds.Max.X - margin - size.X
+	}
+	if strings.HasPrefix(pos, "bottom") {
+		y = bounds.Max.Y - margin - size.Y
+	}
+	if pos == "center" {
+		x = bounds.Min.X + (bounds.Dx()-size.X)/2
+		y = bounds.Min.Y + (bounds.Dy()-size.Y)/2
+	}
+	return image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x+size.X, y+size.Y)}
+}
+
+// expandStamp fills {index}, {time}, {date} and {datetime} placeholders.
+func expandStamp(format string, index int, t time.Time) string {
+	return strings.NewReplacer(
+		"{index}", strconv.Itoa(index),
+		"{time}", t.Format("15:04:05"),
+		"{date}", t.Format("2006-01-02"),
+		"{datetime}", t.Format("2006-01-02 15:04:05"),
+	).Replace(format)
+}
+
+// drawLabel renders text on a translucent dark box at pos. The built-in
+// 7x13 bitmap font is scaled up to roughly size pixels tall.
+func drawLabel(img *image.RGBA, text, pos string, size float64) {
+	face := basicfont.Face7x13
+	if size <= 0 {
+		size = max(13, float64(img.Bounds().Dy())/60)
+	}
+	scale := max(1, int(size/float64(face.Height)+0.5))
+
+	textWidth := font.MeasureString(face, text).Ceil()
+	label := image.NewRGBA(image.Rect(0, 0, textWidth+4, face.Height+2))
+	draw.Draw(label, label.Bounds(), image.NewUniform(color.RGBA{A: 160}), image.Point{}, draw.Src)
+	d := font.Drawer{
+		Dst:  label,
+		Src:  image.White,
+		Face: face,
+		Dot:  fixed.P(2, 1+face.Ascent),
+	}
+	d.DrawString(text)
+
+	size2 := label.Bounds().Size().Mul(scale)
+	box := anchorRect(img.Bounds(), size2, pos, 2*scale)
+	xdraw.NearestNeighbor.Scale(img, box, label, label.Bounds(), xdraw.Over, nil)
+}
+
+// drawWatermark blends wm onto img at pos, shrinking it to at most a third
+// of the image width.
+func drawWatermark(img *image.RGBA, wm image.Image, pos string, opacity float64) {
+	size := wm.Bounds().Size()
+	if limit := img.Bounds().Dx() / 3; size.X > limit && limit > 0 {
+		size = image.Pt(limit, max(1, size.Y*limit/size.X))
+	}
+	margin := max(4, img.Bounds().Dx()/100)
+	box := anchorRect(img.Bounds(), size, pos, margin)
+
+	mask := image.NewUniform(color.Alpha{A: uint8(opacity*255 + 0.5)})
+	xdraw.CatmullRom.Scale(img, box, wm, wm.Bounds(), xdraw.Over, &xdraw.Options{SrcMask: mask})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pageRotation turns pages first..last (1-based, last 0 meaning the end)
+// clockwise by degrees.
+type pageRotation struct {
+	first, last int
+	degrees     int
+}
+
+// parsePageRotations parses --rotate-pages: comma-separated entries of
+// DEGREES (every page) or RANGE:DEGREES, where RANGE is N or N-M.
+// Later entries override earlier ones.
+func parsePageRotations(s string) ([]pageRotation, error) {
+	var rotations []pageRotation
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		r := pageRotation{first: 1}
+		deg := part
+		if pages, d, ok := strings.Cut(part, ":"); ok {
+			deg = d
+			lo, hi, isRange := strings.Cut(pages, "-")
+			first, err := strconv.Atoi(strings.TrimSpace(lo))
+			if err != nil || first < 1 {
+				return nil, fmt.Errorf("invalid page %q", lo)
+			}
+			r.first, r.last = first, first
+			if isRange {
+				last, err := strconv.Atoi(strings.TrimSpace(hi))
+				if err != nil || last < first {
+					return nil, fmt.Errorf("invalid page range %q", pages)
+				}
+				r.last = last
+			}
+		}
+		switch strings.TrimSpace(deg) {
+		case "0", "90", "180", "270":
+			r.degrees, _ = strconv.Atoi(strings.TrimSpace(deg))
+		default:
+			return nil, fmt.Errorf("unsupported rotation %q (want 0, 90, 180 or 270)", deg)
+		}
+		rotations = append(rotations, r)
+	}
+	return rotations, nil
+}
+
+// pageDegrees returns the rotation for page n.
+func pageDegrees(n int, rotations []pageRotation) int {
+	degrees := 0
+	for _, r := range rotations {
+		if n >= r.first && (r.last == 0 || n <= r.last) {
+			degrees = r.degrees
+		}
+	}
+	return degrees
+}
+
+// rotatePages returns files with the pages selected by --rotate-pages
+// replaced by rotated copies in a temporary directory under parent, which
+// the caller removes. The originals are left untouched.
+func rotatePages(files []string, parent string, opts options) ([]string, string, error) {
+	if len(opts.pageRotations) == 0 {
+		return files, "", nil
+	}
+	dir, err := os.MkdirTemp(parent, ".quiz-rotate-*")
+	if err != nil {
+		return nil, "", err
+	}
+	out := make([]string, len(files))
+	for i, file := range files {
+		out[i] = file
+		degrees := pageDegrees(i+1, opts.pageRotations)
+		if degrees == 0 {
+			continue
+		}
+		img, err := decodeImageFile(file)
+		if err != nil {
+			// writePDF reports unreadable files.
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)) + opts.imageExt()
+		rotated := filepath.Join(dir, name)
+		if err := saveImage(rotated, rotateImage(img, degrees), opts); err != nil {
+			return nil, dir, fmt.Errorf("rotating %s: %w", file, err)
+		}
+		out[i] = rotated
+	}
+	return out, dir, nil
+}
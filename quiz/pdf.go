@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+func getImageDimensions(filePath string) (int, int, error) {
+	if strings.EqualFold(filepath.Ext(filePath), ".avif") {
+		img, err := decodeImageFile(filePath)
+		if err != nil {
+			return 0, 0, err
+		}
+		return img.Bounds().Dx(), img.Bounds().Dy(), nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	img, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return img.Width, img.Height, nil
+}
+
+func embeddable(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".png", ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// registerConverted decodes an image gofpdf cannot read natively, or one that
+// should be transcoded or downsampled, and registers the re-encoded data at
+// the given pixel size.
+func registerConverted(pdf *gofpdf.Fpdf, filePath string, size image.Point, opts options) error {
+	data, imageType, err := convertImage(filePath, size, opts)
+	if err != nil {
+		return err
+	}
+	pdf.RegisterImageOptionsReader(filePath, gofpdf.ImageOptions{ImageType: imageType}, bytes.NewReader(data))
+	return pdf.Error()
+}
+
+// convertImage re-encodes filePath at the given pixel size as PNG, or as
+// JPEG with --embed-format jpeg, returning the data and its gofpdf type.
+func convertImage(filePath string, size image.Point, opts options) ([]byte, string, error) {
+	img, err := decodeImageFile(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	if img.Bounds().Size() != size {
+		img = resizeImage(img, size)
+	}
+
+	var buf bytes.Buffer
+	imageType := "PNG"
+	if opts.embedFormat == "jpeg" {
+		imageType = "JPG"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.embedQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), imageType, err
+}
+
+// embedSize limits px so that, drawn widthPt points wide, the image does not
+// exceed --pdf-dpi.
+func embedSize(px image.Point, widthPt float64, opts options) image.Point {
+	if opts.pdfDPI <= 0 {
+		return px
+	}
+	maxWidth := int(math.Round(widthPt * opts.pdfDPI / 72))
+	if px.X <= maxWidth {
+		return px
+	}
+	return image.Pt(maxWidth, max(1, px.Y*maxWidth/px.X))
+}
+
+// needsTranscode reports whether filePath must be re-encoded before embedding.
+func needsTranscode(filePath string, opts options) bool {
+	if !embeddable(filePath) {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(filePath))
+	switch opts.embedFormat {
+	case "jpeg":
+		return ext == ".png"
+	case "png":
+		return ext != ".png"
+	}
+	return false
+}
+
+// Standard page sizes in points, portrait.
+var pageSizes = map[string]gofpdf.SizeType{
+	"a3":     {Wd: 841.89, Ht: 1190.55},
+	"a4":     {Wd: 595.28, Ht: 841.89},
+	"a5":     {Wd: 420.94, Ht: 595.28},
+	"letter": {Wd: 612, Ht: 792},
+	"legal":  {Wd: 612, Ht: 1008},
+}
+
+// pageLayout describes a page and where its image is drawn, in points.
+type pageLayout struct {
+	orientation string
+	size        gofpdf.SizeType // portrait dimensions, as gofpdf expects
+	x, y, w, h  float64
+}
+
+// layoutPage sizes the page for an image of w by h points. With --page-size
+// the image is scaled to fit a standard page inside the margins; otherwise the
+// page matches the image plus margins, unless the orientation is forced
+// against the image's aspect ratio, in which case the image is scaled down to
+// fit. Either way it is centered.
+func layoutPage(w, h float64, opts options) pageLayout {
+	orientation := opts.orientation
+	if orientation == "auto" {
+		orientation = "P"
+		if w > h {
+			orientation = "L"
+		}
+	}
+
+	m := opts.margin
+	pw, ph := w+2*m, h+2*m
+	fixed, ok := pageSizes[opts.pageSize]
+	if ok {
+		pw, ph = fixed.Wd, fixed.Ht
+	}
+	if (orientation == "L") != (pw > ph) {
+		pw, ph = ph, pw
+	}
+
+	f := min((pw-2*m)/w, (ph-2*m)/h)
+	if !ok {
+		f = min(f, 1)
+	}
+	l := pageLayout{orientation: orientation, w: w * f, h: h * f}
+	l.x = (pw - l.w) / 2
+	l.y = (ph - l.h) / 2
+	l.size = gofpdf.SizeType{Wd: min(pw, ph), Ht: max(pw, ph)}
+	return l
+}
+
+func addImagePage(pdf *gofpdf.Fpdf, file string, opts options) error {
+	imgWidth, imgHeight, err := getImageDimensions(file)
+	if err != nil {
+		return fmt.Errorf("reading image dimensions: %w", err)
+	}
+
+	l := layoutPage(float64(imgWidth)/opts.pageScale, float64(imgHeight)/opts.pageScale, opts)
+	if err := prepareImage(pdf, file, image.Pt(imgWidth, imgHeight), l.w, opts); err != nil {
+		return err
+	}
+	pdf.AddPageFormat(l.orientation, l.size)
+	pdf.Image(file, l.x, l.y, l.w, l.h, false, "", 0, "")
+	if opts.ocr {
+		addTextLayer(pdf, file, l.x, l.y, l.w/float64(imgWidth), opts)
+	}
+	return nil
+}
+
+// prepareImage registers a converted copy of file when it must be transcoded
+// or downsampled to be drawn widthPt points wide.
+func prepareImage(pdf *gofpdf.Fpdf, file string, px image.Point, widthPt float64, opts options) error {
+	if size := embedSize(px, widthPt, opts); size != px || needsTranscode(file, opts) {
+		if err := registerConverted(pdf, file, size, opts); err != nil {
+			return fmt.Errorf("converting image: %w", err)
+		}
+	}
+	return nil
+}
+
+// setMetadata fills the document info dictionary. Empty values are skipped
+// since gofpdf would otherwise write a bare UTF-16 byte order mark.
+func setMetadata(pdf *gofpdf.Fpdf, opts options) {
+	pdf.SetCreator("quiz", false)
+	fields := []struct {
+		value string
+		set   func(string, bool)
+	}{
+		{opts.pdfTitle, pdf.SetTitle},
+		{opts.pdfAuthor, pdf.SetAuthor},
+		{opts.pdfSubject, pdf.SetSubject},
+		{opts.pdfKeywords, pdf.SetKeywords},
+	}
+	for _, f := range fields {
+		if f.value != "" {
+			f.set(f.value, true)
+		}
+	}
+}
+
+// pdfText encodes s for PDF string objects written without a UTF-8 font,
+// using UTF-16BE with a byte order mark when s is not plain ASCII.
+func pdfText(s string) string {
+	for _, r := range s {
+		if r > 0x7e {
+			var b strings.Builder
+			b.WriteString("\xfe\xff")
+			for _, u := range utf16.Encode([]rune(s)) {
+				b.WriteByte(byte(u >> 8))
+				b.WriteByte(byte(u))
+			}
+			return b.String()
+		}
+	}
+	return s
+}
+
+// pageLabel returns the bookmark label of capture n (1-based).
+func pageLabel(n int, opts options) string {
+	if n <= len(opts.labels) && opts.labels[n-1] != "" {
+		return opts.labels[n-1]
+	}
+	return fmt.Sprintf("Question %d", n)
+}
+
+func writePDF(pdfPath string, files []string, opts options) error {
+	now := time.Now()
+	pdf := gofpdf.New("P", "pt", "", "")
+	pdf.SetAutoPageBreak(false, 0)
+	if opts.pdfa {
+		setupPDFA(pdf)
+	}
+	setMetadata(pdf, opts)
+	if len(opts.sessionLog) > 0 {
+		pdf.SetAttachments([]gofpdf.Attachment{{
+			Content:     opts.sessionLog,
+			Filename:    sessionLogName,
+			Description: "Capture session log",
+		}})
+	}
+	pdf.AliasNbPages(pageCountAlias)
+	session := strings.TrimSuffix(filepath.Base(pdfPath), filepath.Ext(pdfPath))
+	var pages int // set once the unreadable captures are known
+
+	// Page text is drawn as each page is closed so it sits above all images.
+	texts := []struct {
+		format, pos string
+		size        float64
+	}{
+		{opts.header, opts.headerPos, opts.pageTextSize},
+		{opts.footer, opts.footerPos, opts.pageTextSize},
+		{opts.pageNumbers, opts.pageNumbersPos, opts.pageNumbersSize},
+	}
+	pdf.SetFooterFunc(func() {
+		for _, t := range texts {
+			if t.format != "" {
+				text := expandPageText(t.format, session, pdf.PageNo(), now)
+				drawPageText(pdf, text, t.pos, t.size, pages, opts)
+			}
+		}
+	})
+
+	// Unreadable captures are dropped up front so the contents can predict
+	// the page of every entry.
+	type entry struct {
+		file string
+		n    int // capture number, for labels
+	}
+	var entries []entry
+	for i, file := range files {
+		if _, _, err := getImageDimensions(file); err != nil {
+			slog.Error("adding page", "err", err, "file", file)
+			continue
+		}
+		entries = append(entries, entry{file, opts.firstPage + i + 1})
+	}
+	pages = (len(entries) + opts.perPage - 1) / opts.perPage
+	if opts.cover {
+		pages++
+	}
+	if opts.toc {
+		pages += tocPages(len(entries), opts)
+	}
+
+	offset := 0
+	if opts.cover {
+		addCover(pdf, len(entries), now, opts)
+		offset++
+	}
+
+	var links []int
+	if opts.toc {
+		contents := make([]tocEntry, len(entries))
+		offset += tocPages(len(entries), opts)
+		for k, e := range entries {
+			links = append(links, pdf.AddLink())
+			contents[k] = tocEntry{label: pageLabel(e.n, opts), page: offset + k/opts.perPage + 1, link: links[k]}
+		}
+		addTOC(pdf, contents, opts)
+	}
+
+	var nup nupLayout
+	if opts.perPage > 1 {
+		nup = layoutNup(opts)
+	}
+	for k, e := range entries {
+		var y float64
+		var err error
+		if opts.perPage > 1 {
+			y, err = addImageCell(pdf, e.file, k%opts.perPage, nup, opts)
+		} else {
+			err = addImagePage(pdf, e.file, opts)
+		}
+		if err != nil {
+			slog.Error("adding page", "err", err, "file", e.file)
+			continue
+		}
+		if opts.toc {
+			pdf.SetLink(links[k], y, -1)
+		}
+		if opts.bookmarks {
+			label := pageLabel(e.n, opts)
+			if !opts.pdfa {
+				// gofpdf only converts to UTF-16 itself while a UTF-8 font is selected.
+				label = pdfText(label)
+			}
+			pdf.Bookmark(label, 0, y)
+		}
+	}
+
+	if !opts.pdfa && !opts.protect && colorTag(opts) == nil {
+		return pdf.OutputFileAndClose(pdfPath)
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return err
+	}
+	return finishPDF(pdfPath, opts, func(conf *model.Configuration) (*model.Context, error) {
+		return api.ReadContext(bytes.NewReader(buf.Bytes()), conf)
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// pdfaFont is the embedded font family used for all text in --pdfa mode,
+// since PDF/A forbids the non-embedded core fonts.
+const pdfaFont = "gofont"
+
+// fontFamily returns the font family for page text.
+func fontFamily(opts options) string {
+	if opts.pdfa {
+		return pdfaFont
+	}
+	return pageFonts[opts.pageFont]
+}
+
+// textEncoder converts UTF-8 text for the current page font: the embedded
+// font takes UTF-8 directly, core fonts need cp1252.
+func textEncoder(pdf *gofpdf.Fpdf, opts options) func(string) string {
+	if opts.pdfa {
+		return func(s string) string { return s }
+	}
+	return pdf.UnicodeTranslatorFromDescriptor("")
+}
+
+// setupPDFA registers the embedded fonts. Selecting the UTF-8 font before
+// the first page keeps gofpdf in UTF-8 mode for the whole document; the
+// rest of PDF/A is added by finishPDF.
+func setupPDFA(pdf *gofpdf.Fpdf) {
+	pdf.AddUTF8FontFromBytes(pdfaFont, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(pdfaFont, "B", gobold.TTF)
+	pdf.SetFont(pdfaFont, "", tocFontSize)
+}
+
+// pdfaXMP renders the XMP packet declaring PDF/A-2b, repeating the document
+// info dictionary as PDF/A requires: producer and date must match the ones
+// the PDF writer puts there.
+func pdfaXMP(opts options, producer, date string) []byte {
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/"><pdfaid:part>2</pdfaid:part><pdfaid:conformance>B</pdfaid:conformance></rdf:Description>` + "\n")
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/"><xmp:CreatorTool>quiz</xmp:CreatorTool>`)
+	fmt.Fprintf(&b, "<xmp:CreateDate>%s</xmp:CreateDate><xmp:ModifyDate>%s</xmp:ModifyDate></rdf:Description>\n", date, date)
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/"><pdf:Producer>` + esc(producer) + "</pdf:Producer>")
+	if opts.pdfKeywords != "" {
+		fmt.Fprintf(&b, "<pdf:Keywords>%s</pdf:Keywords>", esc(opts.pdfKeywords))
+	}
+	b.WriteString("</rdf:Description>\n")
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">`)
+	if opts.pdfTitle != "" {
+		fmt.Fprintf(&b, `<dc:title><rdf:Alt><rdf:li xml:lang="x-default">%s</rdf:li></rdf:Alt></dc:title>`, esc(opts.pdfTitle))
+	}
+	if opts.pdfAuthor != "" {
+		fmt.Fprintf(&b, "<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>", esc(opts.pdfAuthor))
+	}
+	if opts.pdfSubject != "" {
+		fmt.Fprintf(&b, `<dc:description><rdf:Alt><rdf:li xml:lang="x-default">%s</rdf:li></rdf:Alt></dc:description>`, esc(opts.pdfSubject))
+	}
+	b.WriteString("</rdf:Description>\n</rdf:RDF></x:xmpmeta>\n<?xpacket end=\"w\"?>")
+	return []byte(b.String())
+}
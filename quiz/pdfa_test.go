@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var (
+	startxrefRe  = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	subsectionRe = regexp.MustCompile(`^(\d+) (\d+)$`)
+	prevRe       = regexp.MustCompile(`/Prev (\d+)`)
+	sizeRe       = regexp.MustCompile(`/Size (\d+)`)
+)
+
+// checkXRef follows the cross-reference sections of data from the last
+// startxref through every /Prev, and checks each in-use entry points at
+// the "N G obj" line of its object. It returns the object numbers in use.
+func checkXRef(t *testing.T, name string, data []byte) map[int]bool {
+	t.Helper()
+	m := startxrefRe.FindSubmatch(data)
+	if m == nil {
+		t.Fatalf("%s: no startxref at the end", name)
+	}
+	at, _ := strconv.Atoi(string(m[1]))
+	seen := map[int]bool{}
+	size := 0 // from the newest trailer, which covers the whole file
+	for sections := 0; at >= 0; sections++ {
+		if sections > 100 || at >= len(data) || !bytes.HasPrefix(data[at:], []byte("xref")) {
+			t.Fatalf("%s: startxref %d does not point at an xref section", name, at)
+		}
+		end := bytes.Index(data[at:], []byte("trailer"))
+		if end < 0 {
+			t.Fatalf("%s: xref section at %d has no trailer", name, at)
+		}
+		lines := bytes.Split(bytes.TrimSpace(data[at+len("xref"):at+end]), []byte("\n"))
+		for i := 0; i < len(lines); {
+			sub := subsectionRe.FindSubmatch(bytes.TrimSpace(lines[i]))
+			if sub == nil {
+				t.Fatalf("%s: bad xref subsection header %q", name, lines[i])
+			}
+			first, _ := strconv.Atoi(string(sub[1]))
+			count, _ := strconv.Atoi(string(sub[2]))
+			if i+1+count > len(lines) {
+				t.Fatalf("%s: xref subsection %d %d is short", name, first, count)
+			}
+			for k, line := range lines[i+1 : i+1+count] {
+				var offset, gen int
+				var kind string
+				if _, err := fmt.Sscanf(string(line), "%d %d %s", &offset, &gen, &kind); err != nil || len(bytes.TrimRight(line, " \r")) != 18 {
+					t.Fatalf("%s: bad xref entry %q", name, line)
+				}
+				num := first + k
+				if kind != "n" || seen[num] {
+					// Free, or superseded by a later update.
+					continue
+				}
+				seen[num] = true
+				if want := fmt.Sprintf("%d %d obj", num, gen); offset >= len(data) || !bytes.HasPrefix(data[offset:], []byte(want)) {
+					t.Errorf("%s: object %d at offset %d, found %.20q", name, num, offset, data[min(offset, len(data)):])
+				}
+			}
+			i += 1 + count
+		}
+		trailer := data[at+end:]
+		if next := bytes.Index(trailer, []byte("startxref")); next >= 0 {
+			trailer = trailer[:next]
+		}
+		if s := sizeRe.FindSubmatch(trailer); s == nil {
+			t.Errorf("%s: trailer without /Size", name)
+		} else if sections == 0 {
+			size, _ = strconv.Atoi(string(s[1]))
+		}
+		at = -1
+		if p := prevRe.FindSubmatch(trailer); p != nil {
+			at, _ = strconv.Atoi(string(p[1]))
+		}
+	}
+	if len(seen) == 0 {
+		t.Errorf("%s: no objects in use", name)
+	}
+	for num := range seen {
+		if num >= size {
+			t.Errorf("%s: object %d in use, /Size %d", name, num, size)
+		}
+	}
+	return seen
+}
+
+// TestXRefOffsets writes a small PDF through each path that builds a
+// cross-reference table and checks every entry.
+func TestXRefOffsets(t *testing.T) {
+	dir := t.TempDir()
+	files := writeCaptures(t, dir)
+	base := pdfOptions()
+	base.pageFont = "helvetica"
+	base.pageNumbersPos, base.footerPos = "bottom-center", "bottom-left"
+
+	withText := base
+	withText.toc = true
+	withText.footer = "{session}"
+	withText.pageNumbers = "{page}/{pages}"
+	withText.pdfTitle = "Week (3)"
+	attached := base
+	attached.sessionLog = []byte(`{"captures":2}`)
+	encrypted := func(opts options) options {
+		opts.protect, opts.pdfPassword, opts.pdfPermissions = true, "secret", 4
+		return opts
+	}
+	archival := func(opts options) options {
+		opts.pdfa = true
+		return opts
+	}
+
+	for _, tt := range []struct {
+		name  string
+		write func(string, []string, options) error
+		opts  options
+	}{
+		{"gofpdf", writePDF, withText},
+		{"gofpdf encrypted", writePDF, encrypted(withText)},
+		{"gofpdf with attachment", writePDF, attached},
+		{"gofpdf PDF/A", writePDF, archival(withText)},
+		{"pdfcpu", writePDFCPU, attached},
+		{"pdfcpu encrypted", writePDFCPU, encrypted(base)},
+		{"pdfcpu PDF/A", writePDFCPU, archival(base)},
+	} {
+		path := filepath.Join(dir, "out.pdf")
+		if err := tt.write(path, files, tt.opts); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkXRef(t, tt.name, data)
+		if tt.opts.pdfa && !bytes.Contains(data, []byte("/OutputIntents")) {
+			t.Errorf("%s: no output intent", tt.name)
+		}
+	}
+}
+
+// TestStreamXRef checks the incremental updates --stream appends: the file
+// is complete after every page, and the final one still reaches all pages.
+func TestStreamXRef(t *testing.T) {
+	dir := t.TempDir()
+	files := writeCaptures(t, dir)
+	opts := pdfOptions()
+	opts.stream = true
+	opts.pdfTitle = "Straße (1)"
+
+	path := filepath.Join(dir, "stream.pdf")
+	s, err := newStreamPDF(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inUse int
+	for i, file := range files {
+		if err := s.addPage(file); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := checkXRef(t, fmt.Sprintf("after page %d", i+1), data)
+		if want := streamInfo + 3*(i+1); len(seen) != want {
+			t.Errorf("after page %d: %d objects in use, want %d", i+1, len(seen), want)
+		}
+		if want := fmt.Sprintf("/Count %d", i+1); !bytes.Contains(data, []byte(want)) {
+			t.Errorf("after page %d: no %s page tree", i+1, want)
+		}
+		inUse = len(seen)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen := checkXRef(t, "closed", data); len(seen) != inUse {
+		t.Errorf("closed: %d objects in use, want %d", len(seen), inUse)
+	}
+	if ctx := readPDFCPU(t, path, nil); ctx.PageCount != len(files) || ctx.Title != opts.pdfTitle {
+		t.Errorf("closed: %d pages titled %q", ctx.PageCount, ctx.Title)
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// pdfcpuProducer is the Producer pdfcpu stamps into every document it writes.
+var pdfcpuProducer = "pdfcpu " + model.VersionStr
+
+// pdfcpuConfig returns the pdfcpu settings for opts. Classic cross-reference
+// tables keep the output readable by the tools --append and --linearize use.
+func pdfcpuConfig(opts options) *model.Configuration {
+	api.DisableConfigDir()
+	conf := model.NewDefaultConfiguration()
+	conf.WriteObjectStream = false
+	conf.WriteXRefStream = false
+	if opts.protect {
+		conf.UserPW = opts.pdfPassword
+		conf.OwnerPW = opts.pdfOwnerPassword
+		if conf.OwnerPW == "" {
+			// As with gofpdf, no owner password means a random one.
+			conf.OwnerPW = newUUID()
+		}
+		conf.EncryptUsingAES = true
+		conf.EncryptKeyLength = 256
+		conf.Permissions = pdfcpuPermissions(opts.pdfPermissions)
+	}
+	return conf
+}
+
+// pdfcpuPermissions converts the gofpdf permission bits kept in opts to
+// pdfcpu's flags, setting each revision 3 bit along with its older one.
+func pdfcpuPermissions(perms byte) model.PermissionFlags {
+	p := model.PermissionsNone | model.PermissionFlags(perms)
+	for bit, rev3 := range map[byte]model.PermissionFlags{
+		gofpdf.CnProtectPrint:      model.PermissionPrintRev3,
+		gofpdf.CnProtectModify:     model.PermissionAssembleRev3,
+		gofpdf.CnProtectCopy:       model.PermissionExtractRev3,
+		gofpdf.CnProtectAnnotForms: model.PermissionFillRev3,
+	} {
+		if perms&bit != 0 {
+			p |= rev3
+		}
+	}
+	return p
+}
+
+// writePDFCPU is the pdfcpu --pdf-backend: one capture per page, with
+// bookmarks, metadata, attachments, encryption and PDF/A.
+func writePDFCPU(pdfPath string, files []string, opts options) error {
+	return finishPDF(pdfPath, opts, func(conf *model.Configuration) (*model.Context, error) {
+		return newPDFCPUDocument(files, opts, conf)
+	})
+}
+
+// finishPDF writes the document build returns to pdfPath, adding what both
+// backends leave to pdfcpu: the display profile, PDF/A and encryption.
+func finishPDF(pdfPath string, opts options, build func(*model.Configuration) (*model.Context, error)) error {
+	conf := pdfcpuConfig(opts)
+	var buf bytes.Buffer
+	// pdfcpu stamps the document dates as it writes, and PDF/A needs the
+	// XMP metadata to repeat them; in the rare case the clock ticks over to
+	// the next second in between, write the document again.
+	for attempt := 0; ; attempt++ {
+		ctx, err := build(conf)
+		if err != nil {
+			return err
+		}
+		if profile := colorTag(opts); profile != nil {
+			if err := tagImages(ctx, profile); err != nil {
+				return fmt.Errorf("embedding the display profile: %w", err)
+			}
+		}
+		buf.Reset()
+		now := time.Now()
+		if opts.pdfa {
+			if err := addPDFAParts(ctx, opts, now); err != nil {
+				return fmt.Errorf("PDF/A: %w", err)
+			}
+		}
+		if err := api.WriteContext(ctx, &buf); err != nil {
+			return err
+		}
+		if !opts.pdfa || infoDate(ctx) == types.DateString(now) {
+			break
+		}
+		if attempt == 2 {
+			return fmt.Errorf("PDF/A: document date keeps changing while writing")
+		}
+	}
+
+	if !opts.protect {
+		return os.WriteFile(pdfPath, buf.Bytes(), 0644)
+	}
+	out, err := os.Create(pdfPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := api.Encrypt(bytes.NewReader(buf.Bytes()), out, conf); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// tagImages marks the RGB images in ctx as being in the colour space of
+// profile, so viewers render the captures in the display's colours.
+func tagImages(ctx *model.Context, profile []byte) error {
+	var images []types.Dict
+	for _, e := range ctx.Table {
+		if e == nil || e.Free {
+			continue
+		}
+		sd, ok := e.Object.(types.StreamDict)
+		if !ok {
+			continue
+		}
+		if st := sd.Subtype(); st != nil && *st == "Image" {
+			if cs := sd.NameEntry("ColorSpace"); cs != nil && *cs == "DeviceRGB" {
+				images = append(images, sd.Dict)
+			}
+		}
+	}
+	if len(images) == 0 {
+		return nil
+	}
+
+	sd, err := ctx.NewStreamDictForBuf(profile)
+	if err != nil {
+		return err
+	}
+	sd.InsertInt("N", 3)
+	sd.InsertName("Alternate", "DeviceRGB")
+	if err := sd.Encode(); err != nil {
+		return err
+	}
+	ref, err := ctx.IndRefForNewObject(*sd)
+	if err != nil {
+		return err
+	}
+	for _, d := range images {
+		d.Update("ColorSpace", types.Array{types.Name("ICCBased"), *ref})
+	}
+	return nil
+}
+
+// newPDFCPUDocument builds the pages, bookmarks, document info and any
+// attachment for files.
+func newPDFCPUDocument(files []string, opts options, conf *model.Configuration) (*model.Context, error) {
+	a4 := pageSizes["a4"]
+	ctx, err := pdfcpu.CreateContextWithXRefTable(conf, &types.Dim{Width: a4.Wd, Height: a4.Ht})
+	if err != nil {
+		return nil, err
+	}
+
+	var bookmarks []pdfcpu.Bookmark
+	for i, file := range files {
+		if err := addPDFCPUPage(ctx, file, opts); err != nil {
+			slog.Error("adding page", "err", err, "file", file)
+			continue
+		}
+		if opts.bookmarks {
+			bookmarks = append(bookmarks, pdfcpu.Bookmark{Title: pageLabel(opts.firstPage+i+1, opts), PageFrom: ctx.PageCount})
+		}
+	}
+	if len(bookmarks) > 0 {
+		if err := pdfcpu.AddBookmarks(ctx, bookmarks, true); err != nil {
+			return nil, fmt.Errorf("adding bookmarks: %w", err)
+		}
+	}
+
+	info := types.NewDict()
+	for _, f := range []struct{ key, value string }{
+		{"Creator", "quiz"}, {"Title", opts.pdfTitle}, {"Author", opts.pdfAuthor}, {"Subject", opts.pdfSubject}, {"Keywords", opts.pdfKeywords},
+	} {
+		if f.value == "" {
+			continue
+		}
+		s, err := types.Escape(pdfText(f.value))
+		if err != nil {
+			return nil, err
+		}
+		info.Insert(f.key, types.StringLiteral(*s))
+	}
+	if ctx.Info, err = ctx.IndRefForNewObject(info); err != nil {
+		return nil, err
+	}
+
+	if len(opts.sessionLog) > 0 {
+		now := time.Now()
+		if err := ctx.AddAttachment(model.Attachment{
+			Reader:   bytes.NewReader(opts.sessionLog),
+			ID:       sessionLogName,
+			FileName: sessionLogName,
+			Desc:     "Capture session log",
+			ModTime:  &now,
+		}, false); err != nil {
+			return nil, fmt.Errorf("attaching the session log: %w", err)
+		}
+	}
+	return ctx, nil
+}
+
+// addPDFCPUPage embeds an image file as a new page.
+func addPDFCPUPage(ctx *model.Context, file string, opts options) error {
+	w, h, err := getImageDimensions(file)
+	if err != nil {
+		return fmt.Errorf("reading image dimensions: %w", err)
+	}
+	px := image.Pt(w, h)
+	l := layoutPage(float64(w)/opts.pageScale, float64(h)/opts.pageScale, opts)
+
+	var data []byte
+	if size := embedSize(px, l.w, opts); size != px || needsTranscode(file, opts) {
+		data, _, err = convertImage(file, size, opts)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return fmt.Errorf("converting image: %w", err)
+	}
+	img, _, _, err := model.CreateImageResource(ctx.XRefTable, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	pw, ph := l.size.Wd, l.size.Ht
+	if l.orientation == "L" {
+		pw, ph = ph, pw
+	}
+	content, err := ctx.NewStreamDictForBuf([]byte(fmt.Sprintf("q %.2f 0 0 %.2f %.2f %.2f cm /Im0 Do Q", l.w, l.h, l.x, ph-l.y-l.h)))
+	if err != nil {
+		return err
+	}
+	if err := content.Encode(); err != nil {
+		return err
+	}
+	contentRef, err := ctx.IndRefForNewObject(*content)
+	if err != nil {
+		return err
+	}
+
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	pagesRef := root.IndirectRefEntry("Pages")
+	pages, err := ctx.DereferenceDict(*pagesRef)
+	if err != nil {
+		return err
+	}
+	page, err := ctx.IndRefForNewObject(types.Dict{
+		"Type":      types.Name("Page"),
+		"Parent":    *pagesRef,
+		"MediaBox":  types.RectForDim(pw, ph).Array(),
+		"Resources": types.Dict{"XObject": types.Dict{"Im0": *img}},
+		"Contents":  *contentRef,
+	})
+	if err != nil {
+		return err
+	}
+	kids := append(pages.ArrayEntry("Kids"), *page)
+	pages.Update("Kids", kids)
+	pages.Update("Count", types.Integer(len(kids)))
+	ctx.PageCount = len(kids)
+	return nil
+}
+
+// addPDFAParts adds what PDF/A-2b needs on top of a plain document: XMP
+// metadata matching the info dictionary, dated now, an sRGB output intent
+// and printable link annotations. pdfcpu already writes the binary header
+// comment and a file ID.
+func addPDFAParts(ctx *model.Context, opts options, now time.Time) error {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	for _, e := range ctx.Table {
+		if e == nil || e.Free {
+			continue
+		}
+		if page, ok := e.Object.(types.Dict); ok && page.Type() != nil && *page.Type() == "Page" {
+			if err := printableLinks(ctx, page); err != nil {
+				return err
+			}
+		}
+	}
+	xmp := pdfaXMP(opts, pdfcpuProducer, now.Format("2006-01-02T15:04:05-07:00"))
+	metadata := types.StreamDict{Dict: types.Dict{"Type": types.Name("Metadata"), "Subtype": types.Name("XML")}, Content: xmp}
+	if err := metadata.Encode(); err != nil {
+		return err
+	}
+	metadataRef, err := ctx.IndRefForNewObject(metadata)
+	if err != nil {
+		return err
+	}
+	profile, err := ctx.NewStreamDictForBuf(srgbProfile())
+	if err != nil {
+		return err
+	}
+	profile.InsertInt("N", 3)
+	if err := profile.Encode(); err != nil {
+		return err
+	}
+	profileRef, err := ctx.IndRefForNewObject(*profile)
+	if err != nil {
+		return err
+	}
+	root.Insert("Metadata", *metadataRef)
+	root.Insert("OutputIntents", types.Array{types.Dict{
+		"Type":                      types.Name("OutputIntent"),
+		"S":                         types.Name("GTS_PDFA1"),
+		"OutputConditionIdentifier": types.StringLiteral("sRGB IEC61966-2.1"),
+		"Info":                      types.StringLiteral("sRGB IEC61966-2.1"),
+		"DestOutputProfile":         *profileRef,
+	}})
+	return nil
+}
+
+// printableLinks sets the print flag on the link annotations of page, as
+// PDF/A requires for every annotation.
+func printableLinks(ctx *model.Context, page types.Dict) error {
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	if err != nil {
+		return err
+	}
+	for _, o := range annots {
+		d, err := ctx.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+		if st := d.Subtype(); st != nil && *st == "Link" {
+			d.Update("F", types.Integer(4))
+		}
+	}
+	return nil
+}
+
+// infoDate returns the modification date pdfcpu wrote into the document
+// info dictionary.
+func infoDate(ctx *model.Context) string {
+	if ctx.Info == nil {
+		return ""
+	}
+	d, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil || d == nil {
+		return ""
+	}
+	if s := d.StringLiteralEntry("ModDate"); s != nil {
+		return string(*s)
+	}
+	return ""
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// pdfOptions returns the defaults the PDF writers see for a plain run.
+func pdfOptions() options {
+	return options{
+		orientation:  "auto",
+		pageScale:    1,
+		perPage:      1,
+		embedFormat:  "auto",
+		embedQuality: 90,
+		bookmarks:    true,
+	}
+}
+
+// writeCaptures writes a PNG and a JPEG capture to dir.
+func writeCaptures(t *testing.T, dir string) []string {
+	t.Helper()
+	png := filepath.Join(dir, "001.png")
+	writePNG(t, png)
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	jpg := writeFile(t, dir, "002.jpg", buf.String())
+	return []string{png, jpg}
+}
+
+func readPDFCPU(t *testing.T, path string, conf *model.Configuration) *model.Context {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if conf == nil {
+		conf = model.NewDefaultConfiguration()
+	}
+	ctx, err := api.ReadAndValidate(f, conf)
+	if err != nil {
+		t.Fatalf("%s: %v", filepath.Base(path), err)
+	}
+	return ctx
+}
+
+func TestWritePDFCPU(t *testing.T) {
+	dir := t.TempDir()
+	files := writeCaptures(t, dir)
+	opts := pdfOptions()
+	opts.pdfTitle = "Quiz (week 3) – ünits"
+	opts.pdfAuthor = "Staff"
+	opts.sessionLog = []byte(`{"captures":2}`)
+	opts.labels = []string{"Intro"}
+
+	path := filepath.Join(dir, "out.pdf")
+	if err := writePDFCPU(path, append(files, filepath.Join(dir, "missing.png")), opts); err != nil {
+		t.Fatal(err)
+	}
+	ctx := readPDFCPU(t, path, nil)
+	if ctx.PageCount != 2 {
+		t.Errorf("page count = %d, want 2", ctx.PageCount)
+	}
+	if ctx.Title != opts.pdfTitle || ctx.Author != opts.pdfAuthor || ctx.Creator != "quiz" {
+		t.Errorf("info = %q, %q, %q", ctx.Title, ctx.Author, ctx.Creator)
+	}
+
+	bookmarks, err := api.Bookmarks(mustOpen(t, path), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, b := range bookmarks {
+		labels = append(labels, b.Title)
+	}
+	if got := strings.Join(labels, ", "); got != "Intro, Question 2" {
+		t.Errorf("bookmarks = %q, want Intro, Question 2", got)
+	}
+
+	attachments, err := ctx.ListAttachments()
+	if err != nil || len(attachments) != 1 || attachments[0].FileName != sessionLogName {
+		t.Errorf("attachments = %+v, %v; want %s", attachments, err, sessionLogName)
+	}
+
+	// The 40x20 JPEG is laid out landscape at its pixel size.
+	page, _, _, err := ctx.PageDict(2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if box := page.ArrayEntry("MediaBox"); box.String() != "[0.00 0.00 40.00 20.00]" {
+		t.Errorf("page 2 MediaBox = %s, want [0 0 40 20]", box)
+	}
+}
+
+func mustOpen(t *testing.T, path string) *os.File {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestWritePDFCPUEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	opts := pdfOptions()
+	opts.protect = true
+	opts.pdfPassword = "secret"
+	perms, err := parsePermissions("copy,modify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.pdfPermissions = perms
+
+	path := filepath.Join(dir, "out.pdf")
+	if err := writePDFCPU(path, writeCaptures(t, dir), opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.ReadAndValidate(mustOpen(t, path), model.NewDefaultConfiguration()); err == nil {
+		t.Error("opened without the password")
+	}
+	ctx := readPDFCPU(t, path, model.NewAESConfiguration("secret", "", 256))
+	if ctx.PageCount != 2 || ctx.E == nil {
+		t.Fatalf("page count %d, encryption %v", ctx.PageCount, ctx.E)
+	}
+	p := model.PermissionFlags(ctx.E.P)
+	if p&model.PermissionPrintRev3 == 0 || p&model.PermissionExtract != 0 || p&model.PermissionModify != 0 {
+		t.Errorf("permissions = %#x, want print only", p)
+	}
+}
+
+func TestWritePDFCPUPDFA(t *testing.T) {
+	dir := t.TempDir()
+	opts := pdfOptions()
+	opts.pdfa = true
+	opts.pdfTitle = "Archive"
+
+	path := filepath.Join(dir, "out.pdf")
+	if err := writePDFCPU(path, writeCaptures(t, dir), opts); err != nil {
+		t.Fatal(err)
+	}
+	ctx := readPDFCPU(t, path, nil)
+	root, err := ctx.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.IndirectRefEntry("Metadata") == nil || len(root.ArrayEntry("OutputIntents")) != 1 || len(ctx.ID) != 2 {
+		t.Fatalf("missing PDF/A parts: %s", root)
+	}
+	sd, _, err := ctx.DereferenceStreamDict(*root.IndirectRefEntry("Metadata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	// The XMP packet must repeat the info dictionary.
+	modified, ok := types.DateTime(ctx.ModDate, false)
+	if !ok {
+		t.Fatalf("ModDate %q", ctx.ModDate)
+	}
+	for _, want := range []string{
+		"<pdfaid:part>2</pdfaid:part>",
+		"<pdf:Producer>" + ctx.Producer + "</pdf:Producer>",
+		"<xmp:ModifyDate>" + modified.Format("2006-01-02T15:04:05-07:00") + "</xmp:ModifyDate>",
+		`<rdf:li xml:lang="x-default">Archive</rdf:li>`,
+	} {
+		if !bytes.Contains(sd.Content, []byte(want)) {
+			t.Errorf("XMP metadata lacks %s:\n%s", want, sd.Content)
+		}
+	}
+}
+
+// imageColorSpaces returns the colour space of every image in ctx.
+func imageColorSpaces(ctx *model.Context) []string {
+	var spaces []string
+	for _, e := range ctx.Table {
+		if sd, ok := e.Object.(types.StreamDict); ok && sd.Subtype() != nil && *sd.Subtype() == "Image" {
+			cs := sd.Dict["ColorSpace"]
+			if a, ok := cs.(types.Array); ok {
+				cs = a[0]
+			}
+			spaces = append(spaces, cs.String())
+		}
+	}
+	sort.Strings(spaces)
+	return spaces
+}
+
+// TestDisplayProfile checks that both backends and --stream tag the RGB
+// captures with the display profile, unless they were converted to sRGB.
+func TestDisplayProfile(t *testing.T) {
+	dir := t.TempDir()
+	files := writeCaptures(t, dir)
+	profile, err := parseICC(srgbProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := func(path string, files []string, opts options) error {
+		s, err := newStreamPDF(path, opts)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := s.addPage(file); err != nil {
+				return err
+			}
+		}
+		return s.Close()
+	}
+	for _, tt := range []struct {
+		name   string
+		write  func(string, []string, options) error
+		toSRGB bool
+		pdfa   bool
+		want   string
+	}{
+		{"gofpdf", writePDF, false, false, "DeviceGray ICCBased"},
+		{"gofpdf PDF/A", writePDF, false, true, "DeviceGray ICCBased"},
+		{"gofpdf sRGB", writePDF, true, false, "DeviceGray DeviceRGB"},
+		{"pdfcpu", writePDFCPU, false, false, "DeviceGray ICCBased"},
+		{"pdfcpu sRGB", writePDFCPU, true, false, "DeviceGray DeviceRGB"},
+		{"stream", stream, false, false, "DeviceGray ICCBased"},
+	} {
+		opts := pdfOptions()
+		opts.iccProfile, opts.toSRGB, opts.pdfa = profile, tt.toSRGB, tt.pdfa
+		path := filepath.Join(dir, "out.pdf")
+		if err := tt.write(path, files, opts); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := strings.Join(imageColorSpaces(readPDFCPU(t, path, nil)), " "); got != tt.want {
+			t.Errorf("%s: image colour spaces %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestPDFALinks checks that the contents links of a gofpdf PDF/A document
+// are marked printable.
+func TestPDFALinks(t *testing.T) {
+	dir := t.TempDir()
+	opts := pdfOptions()
+	opts.pdfa, opts.toc, opts.pageFont = true, true, "helvetica"
+	path := filepath.Join(dir, "out.pdf")
+	if err := writePDF(path, writeCaptures(t, dir), opts); err != nil {
+		t.Fatal(err)
+	}
+	ctx := readPDFCPU(t, path, nil)
+	page, _, _, err := ctx.PageDict(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	if err != nil || len(annots) == 0 {
+		t.Fatalf("contents page annotations %v, %v", annots, err)
+	}
+	for _, o := range annots {
+		d, err := ctx.DereferenceDict(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := d.IntEntry("F"); f == nil || *f != 4 {
+			t.Errorf("link %s is not printable", d)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pageCountAlias is replaced by gofpdf with the final page count on output.
+const pageCountAlias = "{nb}"
+
+var pageFonts = map[string]string{"helvetica": "Helvetica", "times": "Times", "courier": "Courier"}
+
+var pageTextPositions = []string{"top-left", "top-center", "top-right", "bottom-left", "bottom-center", "bottom-right"}
+
+func validPageTextPosition(pos string) bool {
+	for _, p := range pageTextPositions {
+		if p == pos {
+			return true
+		}
+	}
+	return false
+}
+
+// expandPageText fills {session}, {page} and {pages} plus the --stamp
+// placeholders. {pages} is left as an alias since failed captures are only
+// known once the PDF is complete.
+func expandPageText(format, session string, page int, t time.Time) string {
+	format = strings.NewReplacer(
+		"{session}", session,
+		"{pages}", pageCountAlias,
+		"{page}", strconv.Itoa(page),
+	).Replace(format)
+	return expandStamp(format, page, t)
+}
+
+// drawPageText writes text on the current page at pos over a translucent
+// white box. A size of 0 scales the text with the page height; total is the
+// expected page count, used to measure text containing the page count alias.
+func drawPageText(pdf *gofpdf.Fpdf, text, pos string, size float64, total int, opts options) {
+	w, h := pdf.GetPageSize()
+	if size <= 0 {
+		size = max(8, h/60)
+	}
+	text = textEncoder(pdf, opts)(text)
+
+	pdf.SetFont(fontFamily(opts), "", size)
+	tw := pdf.GetStringWidth(strings.ReplaceAll(text, pageCountAlias, strconv.Itoa(total)))
+	margin := size
+	x := margin
+	switch {
+	case strings.HasSuffix(pos, "right"):
+		x = w - margin - tw
+	case strings.HasSuffix(pos, "center"):
+		x = (w - tw) / 2
+	}
+	y := margin
+	if strings.HasPrefix(pos, "bottom") {
+		y = h - margin - size
+	}
+
+	pad := size / 4
+	pdf.SetAlpha(0.6, "Normal")
+	pdf.SetFillColor(255, 255, 255)
+	pdf.Rect(x-pad, y-pad, tw+2*pad, size+2*pad, "F")
+	pdf.SetAlpha(1, "Normal")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Text(x, y+size*0.8, text)
+}
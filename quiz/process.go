@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// finishFrame processes raw, the capture numbered index, and checks it
+// against dedupe. The check comes before the stamp and watermark, which
+// would make every frame differ.
+func finishFrame(raw image.Image, bounds image.Rectangle, index int, opts options, dedupe *deduper) (img image.Image, dup bool, err error) {
+	if img, err = processImage(raw, bounds, opts); err != nil {
+		return nil, false, err
+	}
+	if dedupe.duplicate(img) {
+		return img, true, nil
+	}
+	return decorateImage(img, index, opts), false, nil
+}
+
+// processImage applies the post-capture stages up to scaling. bounds is
+// the screen area the image was captured from. img itself is left as
+// captured: callers compare it with later captures.
+func processImage(img image.Image, bounds image.Rectangle, opts options) (image.Image, error) {
+	// The drawing stages work in place, so the first of them copies img.
+	owned := false
+	writable := func() *image.RGBA {
+		if owned {
+			return toRGBA(img)
+		}
+		owned = true
+		return copyRGBA(img)
+	}
+	if opts.iccProfile != nil && opts.toSRGB {
+		img, owned = convertToSRGB(toRGBA(img), opts.iccProfile), true
+	}
+	if opts.showCursor {
+		img = drawCursor(writable(), bounds)
+	}
+	if len(opts.masks) > 0 {
+		img = applyMasks(writable(), opts.masks, opts.maskMode)
+	}
+	if opts.crop != (margins{}) {
+		cropped, err := cropImage(img, opts.crop)
+		if err != nil {
+			return nil, err
+		}
+		img = cropped
+	}
+	if degrees := opts.rotate; degrees != 0 {
+		if opts.rotateAuto {
+			degrees = detectRotation(bounds)
+		}
+		img = rotateImage(img, degrees)
+	}
+	if size := targetSize(img.Bounds().Size(), opts); size != img.Bounds().Size() {
+		img = resizeImage(img, size)
+	}
+	return img, nil
+}
+
+// decorateImage draws the stamp for capture index and the watermark on a
+// copy of img, then applies --grayscale.
+func decorateImage(img image.Image, index int, opts options) image.Image {
+	if opts.stamp != "" || opts.watermark != nil {
+		rgba := copyRGBA(img)
+		if opts.stamp != "" {
+			drawLabel(rgba, expandStamp(opts.stamp, index, time.Now()), opts.stampPos, opts.stampSize)
+		}
+		if opts.watermark != nil {
+			drawWatermark(rgba, opts.watermark, opts.watermarkPos, opts.watermarkOpacity)
+		}
+		img = rgba
+	}
+	if opts.grayscale {
+		img = toGray(img)
+	}
+	return img
+}
+
+// targetSize applies --resize and then the --max-width/--max-height limits,
+// preserving aspect ratio.
+func targetSize(size image.Point, opts options) image.Point {
+	w, h := float64(size.X), float64(size.Y)
+	if opts.resize > 0 && opts.resize != 1 {
+		w, h = w*opts.resize, h*opts.resize
+	}
+	if opts.maxWidth > 0 && w > float64(opts.maxWidth) {
+		w, h = float64(opts.maxWidth), h*float64(opts.maxWidth)/w
+	}
+	if opts.maxHeight > 0 && h > float64(opts.maxHeight) {
+		w, h = w*float64(opts.maxHeight)/h, float64(opts.maxHeight)
+	}
+	return image.Pt(max(1, int(w+0.5)), max(1, int(h+0.5)))
+}
+
+func resizeImage(img image.Image, size image.Point) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	return dst
+}
+
+func toGray(img image.Image) *image.Gray {
+	b := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, b.Min, draw.Src)
+	return gray
+}
+
+const maskBlurRadius = 12
+
+func applyMasks(img *image.RGBA, masks []image.Rectangle, mode string) *image.RGBA {
+	for _, m := range masks {
+		r := m.Intersect(img.Bounds())
+		if r.Empty() {
+			continue
+		}
+		if mode == "blur" {
+			// Three box-blur passes approximate a gaussian blur.
+			for i := 0; i < 3; i++ {
+				boxBlur(img, r, maskBlurRadius)
+			}
+			continue
+		}
+		draw.Draw(img, r, image.Black, image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func boxBlur(img *image.RGBA, r image.Rectangle, radius int) {
+	src := image.NewRGBA(r)
+	draw.Draw(src, r, img, r.Min, draw.Src)
+
+	// Horizontal pass from src into img, then vertical pass back.
+	blurLine := func(get func(i int) []uint8, set func(i int, px [4]uint8), n int) {
+		for i := 0; i < n; i++ {
+			var sum [4]int
+			count := 0
+			for j := i - radius; j <= i+radius; j++ {
+				if j < 0 || j >= n {
+					continue
+				}
+				p := get(j)
+				for c := 0; c < 4; c++ {
+					sum[c] += int(p[c])
+				}
+				count++
+			}
+			var px [4]uint8
+			for c := 0; c < 4; c++ {
+				px[c] = uint8(sum[c] / count)
+			}
+			set(i, px)
+		}
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		blurLine(
+			func(i int) []uint8 { o := src.PixOffset(r.Min.X+i, y); return src.Pix[o : o+4] },
+			func(i int, px [4]uint8) { o := img.PixOffset(r.Min.X+i, y); copy(img.Pix[o:o+4], px[:]) },
+			r.Dx(),
+		)
+	}
+	draw.Draw(src, r, img, r.Min, draw.Src)
+	for x := r.Min.X; x < r.Max.X; x++ {
+		blurLine(
+			func(i int) []uint8 { o := src.PixOffset(x, r.Min.Y+i); return src.Pix[o : o+4] },
+			func(i int, px [4]uint8) { o := img.PixOffset(x, r.Min.Y+i); copy(img.Pix[o:o+4], px[:]) },
+			r.Dy(),
+		)
+	}
+}
+
+func cropImage(img image.Image, m margins) (image.Image, error) {
+	b := img.Bounds()
+	r := image.Rect(b.Min.X+m.left, b.Min.Y+m.top, b.Max.X-m.right, b.Max.Y-m.bottom)
+	if r.Empty() {
+		return nil, fmt.Errorf("crop margins remove the whole %dx%d image", b.Dx(), b.Dy())
+	}
+	return toRGBA(img).SubImage(r), nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	return copyRGBA(img)
+}
+
+// copyRGBA returns img in a new buffer with its origin at (0,0).
+func copyRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
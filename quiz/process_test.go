@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// noiseImage returns a w x h image of random opaque pixels.
+func noiseImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rng := rand.New(rand.NewSource(1))
+	for i := range img.Pix {
+		img.Pix[i] = byte(rng.Intn(256))
+		if i%4 == 3 {
+			img.Pix[i] = 0xff
+		}
+	}
+	return img
+}
+
+// TestProcessKeepsCapture checks that the drawing stages work on a copy,
+// so the capture still matches an unchanged screen afterwards.
+func TestProcessKeepsCapture(t *testing.T) {
+	profile, err := parseICC(srgbProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := options{masks: rectList{image.Rect(0, 0, 32, 48)}, maskMode: "black", stamp: "{index}", stampPos: "bottom-left"}
+	withProfile := base
+	withProfile.iccProfile, withProfile.toSRGB = profile, true
+	cropped := base
+	cropped.crop = margins{right: 8, bottom: 8}
+	watermarked := base
+	watermarked.watermark, watermarked.watermarkPos, watermarked.watermarkOpacity = noiseImage(8, 8), "center", 0.5
+	blurred := base
+	blurred.maskMode = "blur"
+
+	for _, tt := range []struct {
+		name string
+		opts options
+	}{
+		{"mask and stamp", base},
+		{"sRGB", withProfile},
+		{"cropped", cropped},
+		{"watermark", watermarked},
+		{"blur", blurred},
+	} {
+		raw := noiseImage(64, 48)
+		before := bytes.Clone(raw.Pix)
+		img, _, err := finishFrame(raw, raw.Bounds(), 1, tt.opts, newDeduper(tt.opts))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(raw.Pix, before) {
+			t.Errorf("%s: processing changed the capture", tt.name)
+		}
+		if diffFraction(raw, img) == 0 {
+			t.Errorf("%s: processed image is the capture", tt.name)
+		}
+	}
+}
+
+// TestStampedDedupe checks that repeats are still found when every frame
+// gets a different stamp.
+func TestStampedDedupe(t *testing.T) {
+	for _, mode := range []string{"exact", "perceptual"} {
+		opts := options{dedupe: mode, stamp: "{index} {time}", stampPos: "top-left", stampSize: 12}
+		d := newDeduper(opts)
+		raw := noiseImage(64, 48)
+		for i, want := range []bool{false, true, true} {
+			img, dup, err := finishFrame(raw, raw.Bounds(), i+1, opts, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dup != want {
+				t.Errorf("%s: frame %d duplicate = %v, want %v", mode, i+1, dup, want)
+			}
+			if !dup && diffFraction(raw, img) == 0 {
+				t.Errorf("%s: frame %d saved without its stamp", mode, i+1)
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profileDir is where `profile add` keeps named profiles: config files in
+// clitoolbox/profiles in the user's config directory, one per profile.
+func profileDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "clitoolbox", "profiles"), nil
+}
+
+func profileFile(name string) (string, error) {
+	if !macroNameRe.MatchString(name) {
+		return "", fmt.Errorf("invalid profile name %q (use letters, digits, '.', '_' and '-')", name)
+	}
+	dir, err := profileDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".yaml"), nil
+}
+
+func profileNames() ([]string, error) {
+	dir, err := profileDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".yaml"); ok && !e.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func missingProfile(name string) error {
+	names, _ := profileNames()
+	if len(names) == 0 {
+		return fmt.Errorf("profile %q not found; save one with profile add", name)
+	}
+	return fmt.Errorf("profile %q not found (saved: %s)", name, strings.Join(names, ", "))
+}
+
+// profileCommand implements `profile add|list|delete`.
+func profileCommand(args []string) {
+	if err := runProfile(args); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runProfile(args []string) error {
+	usage := fmt.Errorf("usage: %s profile add NAME [flags] | list | delete NAME", progName())
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "add":
+		if len(args) < 2 {
+			return usage
+		}
+		return addProfile(args[1], args[2:])
+	case "list":
+		if len(args) != 1 {
+			return usage
+		}
+		return listProfiles()
+	case "delete":
+		if len(args) != 2 {
+			return usage
+		}
+		path, err := profileFile(args[1])
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); os.IsNotExist(err) {
+			return missingProfile(args[1])
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("Deleted profile %q\n", args[1])
+		return nil
+	}
+	return usage
+}
+
+// recordedValue keeps the values a flag is set to on the command line.
+type recordedValue struct {
+	flag.Value
+	values *[]string
+	repeat bool
+}
+
+func (r recordedValue) Set(s string) error {
+	if err := r.Value.Set(s); err != nil {
+		return err
+	}
+	if !r.repeat {
+		*r.values = nil
+	}
+	*r.values = append(*r.values, s)
+	return nil
+}
+
+func (r recordedValue) IsBoolFlag() bool {
+	return isBoolFlag(r.Value)
+}
+
+// addProfile saves the run flags in args as profile name, replacing one
+// of that name. Without flags it asks the init questions instead.
+func addProfile(name string, args []string) error {
+	path, err := profileFile(name)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return runWizard(path, progName()+" --profile "+name)
+	}
+
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineFlags(fs, &options{})
+	recorded := map[string]*[]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		recorded[f.Name] = new([]string)
+		f.Value = recordedValue{f.Value, recorded[f.Name], repeatableFlags[f.Name]}
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("profile add takes flags only, not %q", fs.Arg(0))
+	}
+	var keys []string
+	values := map[string][]string{}
+	fs.Visit(func(f *flag.Flag) {
+		keys = append(keys, f.Name)
+		values[f.Name] = *recorded[f.Name]
+	})
+	for _, key := range keys {
+		if key == "config" || key == "profile" {
+			return fmt.Errorf("a profile cannot set --%s", key)
+		}
+	}
+
+	// Check the values together, as run would see them.
+	check := flag.NewFlagSet("run", flag.ContinueOnError)
+	check.SetOutput(io.Discard)
+	if _, err := parseOptions(check, append([]string{"--config", os.DevNull}, args...)); err != nil {
+		return err
+	}
+	if err := writeConfig(path, "profile add", keys, values); err != nil {
+		return err
+	}
+	fmt.Printf("Saved profile %q to %s; use it with --profile %s\n", name, path, name)
+	return nil
+}
+
+// listProfiles prints each profile with the flags it sets.
+func listProfiles() error {
+	names, err := profileNames()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		fmt.Println("No saved profiles")
+	}
+	for _, name := range names {
+		path, _ := profileFile(name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var keys []string
+		if doc, err := parseYAML(string(data)); err == nil {
+			if m, ok := doc.(map[string]any); ok {
+				for key := range m {
+					keys = append(keys, key)
+				}
+			}
+		}
+		sort.Strings(keys)
+		fmt.Printf("%-16s %s\n", name, strings.Join(keys, ", "))
+	}
+	return nil
+}
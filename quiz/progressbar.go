@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	progressBarWidth   = 24
+	progressBarRefresh = time.Second
+)
+
+// progressView shows the session's progress on the terminal, for --progress
+// bar and tui. Log lines are written through it.
+type progressView interface {
+	io.Writer
+	event(e logEvent)
+}
+
+// progressBar is the --progress bar status line. It follows the session's
+// log events and stays on the terminal's last line: log lines written
+// through it are printed above it.
+type progressBar struct {
+	mu      sync.Mutex
+	w       io.Writer
+	total   int // planned iterations, 0 when open-ended
+	started time.Time
+	current int // iteration in progress
+	pages   int
+	errors  int
+	shown   bool // the bar is on the current line
+	ended   bool
+	stopped chan struct{}
+}
+
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+func newProgressBar(w io.Writer, total int) *progressBar {
+	return &progressBar{w: w, total: total}
+}
+
+// event updates the bar from a session log event.
+func (b *progressBar) event(e logEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch e.Type {
+	case "start":
+		b.started = e.Time
+		b.stopped = make(chan struct{})
+		go b.tick(b.stopped)
+	case "iteration":
+		b.current = e.Capture
+	case "capture":
+		b.pages++
+	case "error":
+		b.errors++
+	case "end":
+		b.draw(time.Now(), true)
+		fmt.Fprintln(b.w)
+		b.shown, b.ended = false, true
+		close(b.stopped)
+		return
+	}
+	if !b.started.IsZero() && !b.ended {
+		b.draw(time.Now(), false)
+	}
+}
+
+// tick redraws the bar so the elapsed time and ETA keep moving between
+// events.
+func (b *progressBar) tick(stopped <-chan struct{}) {
+	t := time.NewTicker(progressBarRefresh)
+	defer t.Stop()
+	for {
+		select {
+		case <-stopped:
+			return
+		case now := <-t.C:
+			b.mu.Lock()
+			b.draw(now, false)
+			b.mu.Unlock()
+		}
+	}
+}
+
+// Write prints log output above the bar.
+func (b *progressBar) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.shown {
+		io.WriteString(b.w, "\r\033[K")
+	}
+	n, err := b.w.Write(p)
+	if b.shown {
+		b.draw(time.Now(), false)
+	}
+	return n, err
+}
+
+func (b *progressBar) draw(now time.Time, final bool) {
+	io.WriteString(b.w, "\r\033[K"+b.render(now, final))
+	b.shown = true
+}
+
+// render formats the bar, e.g.
+// "[=========>              ] 42/300 14% | 3m12s elapsed | ETA 21m05s (14:32) | 13.1/min | 2 errors".
+func (b *progressBar) render(now time.Time, final bool) string {
+	elapsed := now.Sub(b.started)
+	done := b.current - 1 // iterations finished
+	if final || done < 0 {
+		done = max(b.current, 0)
+	}
+
+	var parts []string
+	if b.total > 0 {
+		filled := min(progressBarWidth, done*progressBarWidth/b.total)
+		bar := strings.Repeat("=", filled)
+		if filled < progressBarWidth {
+			bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+		}
+		parts = append(parts, fmt.Sprintf("[%s] %d/%d %d%%", bar, done, b.total, done*100/b.total))
+	} else {
+		parts = append(parts, fmt.Sprintf("[%d]", b.current))
+	}
+	parts = append(parts, elapsed.Round(time.Second).String()+" elapsed")
+	if b.total > 0 && done > 0 && !final {
+		left := time.Duration(float64(elapsed) / float64(done) * float64(b.total-done))
+		parts = append(parts, fmt.Sprintf("ETA %s (%s)", left.Round(time.Second), now.Add(left).Format("15:04")))
+	}
+	if elapsed >= time.Second {
+		parts = append(parts, fmt.Sprintf("%.1f/min", float64(b.pages)/elapsed.Minutes()))
+	}
+	if b.errors == 1 {
+		parts = append(parts, "1 error")
+	} else {
+		parts = append(parts, fmt.Sprintf("%d errors", b.errors))
+	}
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Keys used while recording: the mark key is where the capture goes,
+	// the stop key ends the recording.
+	recordMarkKey = "f9"
+	recordStopKey = "f10"
+
+	// recordMinWait is the shortest pause kept as a wait step.
+	recordMinWait = 200 * time.Millisecond
+	// recordDragPx is how far the pointer moves with the button held
+	// before a click counts as a drag.
+	recordDragPx = 5
+)
+
+// recordEvent is one input event seen while recording.
+type recordEvent struct {
+	at     time.Time
+	kind   string // key, mark, press or release
+	key    keyPress
+	text   string // the character typed, for a printable key without shortcut modifiers
+	button int    // X button: 1 left, 2 middle, 3 right, 4 and 5 wheel up and down
+	pos    image.Point
+}
+
+// recordedStep is a script step with the time span of the input behind it.
+type recordedStep struct {
+	spec       string
+	start, end time.Time
+}
+
+// recordScript records one iteration of the quiz and saves it to path as a
+// --script file, then loads it for replay.
+func recordScript(path string, opts options) ([]action, error) {
+	fmt.Printf("Recording: go through one question. Press %s where the capture should happen, %s when done.\n",
+		strings.ToUpper(recordMarkKey), strings.ToUpper(recordStopKey))
+	events, err := recordInput(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Recorded %s; replay with --script.\n", time.Now().Format("2006-01-02 15:04"))
+	steps := recordSteps(events)
+	for _, spec := range steps {
+		fmt.Fprintf(&b, "- %s\n", spec)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return nil, err
+	}
+	slog.Info(fmt.Sprintf("Recorded %d step(s)", len(steps)), "file", path)
+	return loadScript(path)
+}
+
+// recordSteps turns recorded events into script steps. Consecutive typed
+// characters become one type step, wheel turns one scroll step, and pauses
+// between steps become waits. Without a mark, the capture comes first.
+func recordSteps(events []recordEvent) []string {
+	var steps []recordedStep
+	var last *recordedStep
+	var text strings.Builder
+	var press *recordEvent
+	scroll := 0
+	marked := false
+
+	for i := range events {
+		e := &events[i]
+		extend := last != nil && e.at.Sub(last.end) < time.Second
+		switch {
+		case e.kind == "mark":
+			steps = append(steps, recordedStep{spec: "capture", start: e.at, end: e.at})
+			marked = true
+
+		case e.kind == "key" && e.text != "":
+			if extend && strings.HasPrefix(last.spec, "type:") {
+				text.WriteString(e.text)
+				last.spec, last.end = "type: "+strconv.Quote(text.String()), e.at
+				continue
+			}
+			text.Reset()
+			text.WriteString(e.text)
+			steps = append(steps, recordedStep{spec: "type: " + strconv.Quote(e.text), start: e.at, end: e.at})
+
+		case e.kind == "key":
+			steps = append(steps, recordedStep{spec: "key: " + e.key.String(), start: e.at, end: e.at})
+
+		case e.kind == "press" && (e.button == 4 || e.button == 5):
+			step := 1
+			if e.button == 5 {
+				step = -1
+			}
+			if extend && strings.HasPrefix(last.spec, "scroll:") && (scroll > 0) == (step > 0) {
+				scroll += step
+				last.spec, last.end = fmt.Sprintf("scroll: %d", scroll), e.at
+				continue
+			}
+			scroll = step
+			steps = append(steps, recordedStep{spec: fmt.Sprintf("scroll: %d", scroll), start: e.at, end: e.at})
+
+		case e.kind == "press" && e.button == 1:
+			press = e
+			continue
+
+		case e.kind == "release" && e.button == 1 && press != nil:
+			d := e.pos.Sub(press.pos)
+			spec := fmt.Sprintf("click: %d,%d", press.pos.X, press.pos.Y)
+			if d.X*d.X+d.Y*d.Y > recordDragPx*recordDragPx {
+				spec = fmt.Sprintf("drag: %d,%d->%d,%d", press.pos.X, press.pos.Y, e.pos.X, e.pos.Y)
+			}
+			steps = append(steps, recordedStep{spec: spec, start: press.at, end: e.at})
+			press = nil
+
+		case e.kind == "press" && (e.button == 2 || e.button == 3):
+			slog.Warn("click not recorded", "button", e.button, "x", e.pos.X, "y", e.pos.Y)
+			continue
+
+		default:
+			continue
+		}
+		last = &steps[len(steps)-1]
+	}
+
+	var specs []string
+	if !marked {
+		specs = append(specs, "capture")
+	}
+	for i, st := range steps {
+		if i > 0 {
+			if gap := st.start.Sub(steps[i-1].end); gap >= recordMinWait {
+				specs = append(specs, "wait: "+gap.Round(100*time.Millisecond).String())
+			}
+		}
+		specs = append(specs, st.spec)
+	}
+	return specs
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/robotn/xgb/xproto"
+	"github.com/robotn/xgbutil"
+	"github.com/robotn/xgbutil/keybind"
+)
+
+// xModifiers maps modifier keysyms to keyPress modifiers and X masks.
+var xModifiers = map[string]struct {
+	name string
+	mask uint16
+}{
+	"Shift_L":   {"shift", xproto.ModMaskShift},
+	"Shift_R":   {"shift", xproto.ModMaskShift},
+	"Control_L": {"ctrl", xproto.ModMaskControl},
+	"Control_R": {"ctrl", xproto.ModMaskControl},
+	"Alt_L":     {"alt", xproto.ModMask1},
+	"Alt_R":     {"alt", xproto.ModMask1},
+	"Meta_L":    {"alt", xproto.ModMask1},
+	"Super_L":   {"cmd", xproto.ModMask4},
+	"Super_R":   {"cmd", xproto.ModMask4},
+}
+
+// recordInput collects clicks and key presses from every X11 input device,
+// as reported by `xinput test-xi2 --root`, until the stop key is pressed.
+func recordInput(opts options) ([]recordEvent, error) {
+	path, err := exec.LookPath("xinput")
+	if err != nil {
+		return nil, fmt.Errorf("--record requires xinput")
+	}
+	xu, err := xgbutil.NewConn()
+	if err != nil {
+		return nil, fmt.Errorf("--record needs an X11 display: %w", err)
+	}
+	defer xu.Conn().Close()
+	keybind.Initialize(xu)
+
+	// X keysym names back to our key names.
+	keyNames := map[string]string{}
+	for name, sym := range xdotoolKeys {
+		keyNames[sym] = name
+	}
+
+	cmd := exec.Command(path, "test-xi2", "--root")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("xinput failed: %w", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	var events []recordEvent
+	var mods uint16
+	held := map[string]bool{}
+	// handle turns one raw event into a recordEvent. It returns false once
+	// the stop key is pressed.
+	handle := func(typ string, detail int) bool {
+		e := recordEvent{at: time.Now()}
+		switch typ {
+		case "RawButtonPress", "RawButtonRelease":
+			x, y, err := opts.input.location()
+			if err != nil {
+				return true
+			}
+			e.kind, e.button, e.pos = "press", detail, image.Pt(x, y)
+			if typ == "RawButtonRelease" {
+				e.kind = "release"
+			}
+
+		case "RawKeyPress", "RawKeyRelease":
+			sym := keybind.LookupString(xu, mods, xproto.Keycode(detail))
+			if m, ok := xModifiers[sym]; ok {
+				held[m.name] = typ == "RawKeyPress"
+				if held[m.name] {
+					mods |= m.mask
+				} else {
+					mods &^= m.mask
+				}
+				return true
+			}
+			if typ == "RawKeyRelease" || sym == "" {
+				return true
+			}
+
+			name := strings.ToLower(sym)
+			if n, ok := keyNames[sym]; ok {
+				name = n
+			}
+			switch name {
+			case recordStopKey:
+				return false
+			case recordMarkKey:
+				e.kind = "mark"
+				fmt.Println("Capture marked")
+				events = append(events, e)
+				return true
+			}
+
+			e.kind, e.key = "key", keyPress{key: name}
+			for _, m := range []string{"ctrl", "alt", "shift", "cmd"} {
+				if held[m] {
+					e.key.mods = append(e.key.mods, m)
+				}
+			}
+			shortcut := held["ctrl"] || held["alt"] || held["cmd"]
+			switch {
+			case sym == "space" && !shortcut:
+				e.text = " "
+			case utf8.RuneCountInString(sym) == 1 && !shortcut:
+				e.text = sym
+			}
+
+		default:
+			return true
+		}
+		events = append(events, e)
+		return true
+	}
+
+	// xinput prints an "EVENT type N (Name)" line, indented fields and a
+	// blank line. Raw events arrive from both the physical (slave) device
+	// and its master; only the master's copy, whose source differs, is
+	// kept.
+	sc := bufio.NewScanner(out)
+	typ, detail, master := "", 0, false
+	flush := func() bool {
+		ok := typ == "" || !master || handle(typ, detail)
+		typ, detail, master = "", 0, false
+		return ok
+	}
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+			if !flush() {
+				return events, nil
+			}
+		case strings.HasPrefix(line, "EVENT type"):
+			if !flush() {
+				return events, nil
+			}
+			if i, j := strings.Index(line, "("), strings.LastIndex(line, ")"); i >= 0 && j > i {
+				typ = line[i+1 : j]
+			}
+		case strings.HasPrefix(line, "device:"):
+			var dev, src int
+			fmt.Sscanf(line, "device: %d (%d)", &dev, &src)
+			master = dev != src
+		case strings.HasPrefix(line, "detail:"):
+			detail, _ = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "detail:")))
+		}
+	}
+	if !flush() {
+		return events, nil
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("xinput exited before %s was pressed", strings.ToUpper(recordStopKey))
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func recordInput(opts options) ([]recordEvent, error) {
+	return nil, errors.New("--record is only supported on X11")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"image"
+	"sync"
+)
+
+// outputRotation is the RandR rotation, in clockwise degrees, of the monitor
+// covering rect.
+type outputRotation struct {
+	rect    image.Rectangle
+	degrees int
+}
+
+var (
+	rotationsOnce sync.Once
+	rotations     []outputRotation
+)
+
+// detectRotation returns the rotation of the monitor containing the centre of
+// bounds, or 0 if it cannot be determined.
+func detectRotation(bounds image.Rectangle) int {
+	rotationsOnce.Do(func() {
+		rotations, _ = displayRotations()
+	})
+
+	center := bounds.Min.Add(bounds.Size().Div(2))
+	for _, r := range rotations {
+		if center.In(r.rect) {
+			return r.degrees
+		}
+	}
+	return 0
+}
+
+// rotateImage rotates img clockwise by a multiple of 90 degrees.
+func rotateImage(img image.Image, degrees int) image.Image {
+	degrees = ((degrees % 360) + 360) % 360
+	if degrees == 0 {
+		return img
+	}
+
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	var dst *image.RGBA
+	if degrees == 180 {
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch degrees {
+			case 90:
+				dx, dy = h-1-y, x
+			case 180:
+				dx, dy = w-1-x, h-1-y
+			case 270:
+				dx, dy = y, w-1-x
+			}
+			so := src.PixOffset(x, y)
+			do := dst.PixOffset(dx, dy)
+			copy(dst.Pix[do:do+4], src.Pix[so:so+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"image"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/randr"
+	"github.com/jezek/xgb/xproto"
+)
+
+func displayRotations() ([]outputRotation, error) {
+	c, err := xgb.NewConn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	if err := randr.Init(c); err != nil {
+		return nil, err
+	}
+	root := xproto.Setup(c).DefaultScreen(c).Root
+	res, err := randr.GetScreenResourcesCurrent(c, root).Reply()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []outputRotation
+	for _, crtc := range res.Crtcs {
+		info, err := randr.GetCrtcInfo(c, crtc, res.ConfigTimestamp).Reply()
+		if err != nil || info.Width == 0 || info.Height == 0 {
+			continue
+		}
+		degrees := 0
+		switch {
+		case info.Rotation&randr.RotationRotate90 != 0:
+			degrees = 90
+		case info.Rotation&randr.RotationRotate180 != 0:
+			degrees = 180
+		case info.Rotation&randr.RotationRotate270 != 0:
+			degrees = 270
+		}
+		x, y := int(info.X), int(info.Y)
+		out = append(out, outputRotation{
+			rect:    image.Rect(x, y, x+int(info.Width), y+int(info.Height)),
+			degrees: degrees,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func displayRotations() ([]outputRotation, error) {
+	return nil, errors.New("display rotation detection is only supported on X11")
+}
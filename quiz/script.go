@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// scriptLoopTimeout bounds a while-image loop that sets no timeout.
+const scriptLoopTimeout = 30 * time.Second
+
+// Keys allowed in each block step; the first is the step's own.
+var scriptBlocks = map[string][]string{
+	"if-image":       {"if-image", "then", "else", "timeout"},
+	"while-image":    {"while-image", "do", "timeout"},
+	"wait-for-image": {"wait-for-image", "timeout"},
+	"repeat":         {"repeat", "do"},
+}
+
+// loadScript reads a --script file: a YAML (or JSON) list of steps, or a
+// mapping with the list under "steps". A step is a parseAction string, a
+// single-key object such as {"key": "PageDown"}, or a block step
+// (if-image, while-image, wait-for-image, repeat). Image paths are
+// relative to the script.
+func loadScript(path string) ([]action, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if m, ok := doc.(map[string]any); ok {
+		doc = m["steps"]
+	}
+	list, ok := doc.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: want a list of steps", path)
+	}
+
+	steps, err := scriptSteps(list, filepath.Dir(path), "step")
+	if err != nil {
+		return nil, err
+	}
+	if !usesAction("capture", steps) {
+		return nil, fmt.Errorf("%s has no capture step", path)
+	}
+	return steps, nil
+}
+
+// scriptSteps converts decoded steps; where names them in errors.
+func scriptSteps(list []any, dir, where string) ([]action, error) {
+	var steps []action
+	for n, v := range list {
+		a, err := scriptStep(v, dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s %d: %w", where, n+1, err)
+		}
+		steps = append(steps, a)
+	}
+	return steps, nil
+}
+
+func scriptStep(v any, dir string) (action, error) {
+	switch v := v.(type) {
+	case string:
+		return parseAction(v)
+	case map[string]any:
+		for kind := range scriptBlocks {
+			if _, ok := v[kind]; ok {
+				return scriptBlock(kind, v, dir)
+			}
+		}
+		if len(v) != 1 {
+			return action{}, fmt.Errorf("want a single key, got %d", len(v))
+		}
+		for k, arg := range v {
+			if arg == nil || arg == "true" {
+				return parseAction(k)
+			}
+			text, ok := arg.(string)
+			if ok && (k == "type" || k == "click-text" || k == "click-selector" || k == "navigate") {
+				// The text is already unquoted: quote it again so spaces at
+				// its ends and a leading quote survive parseAction.
+				return parseAction(k + ":" + strconv.Quote(text))
+			}
+			return parseAction(fmt.Sprintf("%s:%v", k, arg))
+		}
+	}
+	return action{}, fmt.Errorf("want a string or object")
+}
+
+// scriptBlock parses a block step such as
+// {"if-image": "ok.png", "then": [...], "else": [...], "timeout": "2s"}.
+func scriptBlock(kind string, m map[string]any, dir string) (action, error) {
+	a := action{kind: kind}
+	for k := range m {
+		known := false
+		for _, key := range scriptBlocks[kind] {
+			known = known || k == key
+		}
+		if !known {
+			return a, fmt.Errorf("%s does not take %q", kind, k)
+		}
+	}
+
+	body := func(key string) ([]action, error) {
+		switch v := m[key].(type) {
+		case nil:
+			return nil, nil
+		case []any:
+			return scriptSteps(v, dir, kind+" "+key+" step")
+		}
+		return nil, fmt.Errorf("%s %s: want a list of steps", kind, key)
+	}
+	var err error
+	if timeout, ok := m["timeout"]; ok {
+		if a.wait, err = time.ParseDuration(fmt.Sprint(timeout)); err != nil || a.wait < 0 {
+			return a, fmt.Errorf("%s: invalid timeout %v", kind, timeout)
+		}
+	}
+
+	if kind == "repeat" {
+		if a.count, err = strconv.Atoi(fmt.Sprint(m[kind])); err != nil || a.count < 1 {
+			return a, fmt.Errorf("repeat: want a positive count, got %v", m[kind])
+		}
+	} else {
+		a.text = fmt.Sprint(m[kind])
+		path := a.text
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		img, err := decodeImageFile(path)
+		if err != nil {
+			return a, fmt.Errorf("%s: %w", kind, err)
+		}
+		a.image = toGray(img)
+	}
+
+	switch kind {
+	case "if-image":
+		if a.then, err = body("then"); err == nil {
+			a.els, err = body("else")
+		}
+		if err == nil && len(a.then)+len(a.els) == 0 {
+			err = fmt.Errorf("if-image needs then or else steps")
+		}
+	case "while-image", "repeat":
+		if a.then, err = body("do"); err == nil && len(a.then) == 0 {
+			err = fmt.Errorf("%s needs do steps", kind)
+		}
+	}
+	return a, err
+}
+
+// scriptRun is the state of one iteration of a script.
+type scriptRun struct {
+	i        int
+	captures int
+	frame    image.Image // the last capture, for wait-for-change
+}
+
+// runScript performs the --script steps for iteration i. The second and
+// later captures of an iteration get a _2, _3... suffix. It returns the
+// frame of the last capture.
+func (s *session) runScript(i int) image.Image {
+	r := &scriptRun{i: i}
+	s.runSteps(r, s.opts.script, nil)
+	return r.frame
+}
+
+// runSteps performs steps in order, reporting failed steps and carrying
+// on. found is the centre of the image matched by an enclosing if-image or
+// while-image: a click without a position clicks it.
+func (s *session) runSteps(r *scriptRun, steps []action, found *image.Point) {
+	for _, a := range steps {
+		if err := s.runStep(r, a, found); errors.Is(err, errSessionLimit) {
+			return
+		} else if err != nil {
+			slog.Error("in "+a.kind+" step", "err", err, "capture", r.i)
+			s.log.add(logEvent{Type: "error", Capture: r.i, Error: err.Error()})
+		}
+	}
+}
+
+func (s *session) runStep(r *scriptRun, a action, found *image.Point) error {
+	if s.halted != "" {
+		return errSessionLimit
+	}
+	switch a.kind {
+	case "capture":
+		r.captures++
+		suffix := ""
+		if r.captures > 1 {
+			suffix = fmt.Sprintf("_%d", r.captures)
+		}
+		if f, ok := s.shoot(r.i, suffix); ok {
+			r.frame = f
+		}
+		return nil
+
+	case "wait-for-change":
+		if r.frame == nil {
+			return nil
+		}
+		return s.awaitChange(r.frame)
+
+	case "if-image":
+		if p, ok := s.awaitImage(a.image, a.wait); ok {
+			s.runSteps(r, a.then, &p)
+		} else {
+			s.runSteps(r, a.els, found)
+		}
+		return nil
+
+	case "wait-for-image":
+		timeout := a.wait
+		if timeout == 0 {
+			timeout = s.opts.changeTimeout
+		}
+		if _, ok := s.awaitImage(a.image, timeout); !ok {
+			return fmt.Errorf("%s did not appear within %s", a.text, timeout)
+		}
+		return nil
+
+	case "while-image":
+		timeout := a.wait
+		if timeout == 0 {
+			timeout = scriptLoopTimeout
+		}
+		deadline := time.Now().Add(timeout)
+		for {
+			p, ok := s.awaitImage(a.image, 0)
+			if !ok {
+				return nil
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("%s still on screen after %s", a.text, timeout)
+			}
+			s.runSteps(r, a.then, &p)
+			if s.halted != "" {
+				return errSessionLimit
+			}
+		}
+
+	case "repeat":
+		for n := 0; n < a.count && s.halted == ""; n++ {
+			s.runSteps(r, a.then, found)
+		}
+		return nil
+
+	case "click":
+		if a.at == nil && found != nil {
+			a.at = found
+		}
+	}
+	return s.perform(r.i, a)
+}
+
+// awaitImage looks for tmpl on screen for up to timeout (once if zero) and
+// returns the centre of the match.
+func (s *session) awaitImage(tmpl *image.Gray, timeout time.Duration) (image.Point, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		p, score, err := searchScreen(tmpl, s.opts)
+		if err != nil {
+			slog.Warn("searching for the image", "err", err)
+			return image.Point{}, false
+		}
+		if score <= s.opts.clickThreshold {
+			return p, true
+		}
+		if !time.Now().Before(deadline) {
+			return image.Point{}, false
+		}
+		time.Sleep(changePollInterval)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pt(x, y int) *image.Point { return &image.Point{X: x, Y: y} }
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		spec string
+		want action
+	}{
+		{"click", action{kind: "click"}},
+		{"click:120,340", action{kind: "click", at: pt(120, 340)}},
+		{" click: 120, 340 ", action{kind: "click", at: pt(120, 340)}},
+		{"key:PageDown", action{kind: "key", keys: []keyPress{{key: "pagedown"}}}},
+		{"key:ctrl+shift+Tab", action{kind: "key", keys: []keyPress{{key: "tab", mods: []string{"ctrl", "shift"}}}}},
+		{"keys:tab,tab,Return", action{kind: "keys", keys: []keyPress{{key: "tab"}, {key: "tab"}, {key: "enter"}}}},
+		{"type", action{kind: "type"}},
+		{"type:a: b", action{kind: "type", text: "a: b"}},
+		{`type:"two  words "`, action{kind: "type", text: "two  words "}},
+		{"click-text:Next", action{kind: "click-text", text: "Next"}},
+		{"navigate:https://example.com/q?id=1", action{kind: "navigate", text: "https://example.com/q?id=1"}},
+		{"scroll:-3", action{kind: "scroll", scroll: -3}},
+		{"drag:1,2->30,40", action{kind: "drag", at: pt(1, 2), to: pt(30, 40)}},
+		{"wait:1.5s", action{kind: "wait", wait: 1500 * time.Millisecond}},
+		{"wait-for-change", action{kind: "wait-for-change"}},
+		{"capture", action{kind: "capture"}},
+	}
+	for _, tt := range tests {
+		got, err := parseAction(tt.spec)
+		if err != nil {
+			t.Errorf("parseAction(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseAction(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseActionErrors(t *testing.T) {
+	for _, spec := range []string{
+		"", "hover", "click:1", "click:a,b", "key:", "key:hyper+a", "keys:tab,,enter",
+		"click-text:", "click-text: ", `type:"open`, "scroll:0", "scroll:down",
+		"drag:1,2", "drag:1,2->3", "wait:soon", "wait:-1s", "capture:now",
+	} {
+		if a, err := parseAction(spec); err == nil {
+			t.Errorf("parseAction(%q) = %+v, want an error", spec, a)
+		}
+	}
+}
+
+// writeFile writes data to name in dir and returns its path.
+func writeFile(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writePNG(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dropImages clears the decoded block images, after checking each block
+// has one, so steps compare by their settings.
+func dropImages(t *testing.T, steps []action) []action {
+	t.Helper()
+	for i := range steps {
+		a := &steps[i]
+		if a.kind == "if-image" || a.kind == "while-image" || a.kind == "wait-for-image" {
+			if a.image == nil || a.image.Bounds().Dx() != 4 {
+				t.Errorf("%s %s: image not loaded", a.kind, a.text)
+			}
+			a.image = nil
+		}
+		a.then, a.els = dropImages(t, a.then), dropImages(t, a.els)
+	}
+	return steps
+}
+
+func TestLoadScript(t *testing.T) {
+	dir := t.TempDir()
+	writePNG(t, filepath.Join(dir, "next.png"))
+	want := []action{
+		{kind: "capture"},
+		{kind: "key", keys: []keyPress{{key: "pagedown"}}},
+		{kind: "wait", wait: 2 * time.Second},
+		{kind: "type", text: `say "hi" # twice `},
+		{kind: "click", at: pt(10, 20)},
+		{kind: "if-image", text: "next.png", wait: time.Second,
+			then: []action{{kind: "click"}},
+			els:  []action{{kind: "scroll", scroll: -2}}},
+		{kind: "while-image", text: "next.png", then: []action{{kind: "wait", wait: 100 * time.Millisecond}}},
+		{kind: "wait-for-image", text: "next.png", wait: 5 * time.Second},
+		{kind: "repeat", count: 3, then: []action{{kind: "keys", keys: []keyPress{{key: "tab"}}}}},
+	}
+
+	yaml := writeFile(t, dir, "script.yaml", `# every iteration
+- capture
+- key: PageDown
+- wait: 2s
+- type: "say \"hi\" # twice "
+- click:10,20
+- if-image: next.png
+  timeout: 1s
+  then:
+    - click
+  else:
+    - scroll: -2
+- while-image: next.png
+  do:
+    - wait: 100ms
+- wait-for-image: next.png
+  timeout: 5s
+- repeat: 3
+  do:
+    - keys: tab
+`)
+	json := writeFile(t, dir, "script.json", `{"steps": [
+  "capture",
+  {"key": "PageDown"},
+  {"wait": "2s"},
+  {"type": "say \"hi\" # twice "},
+  "click:10,20",
+  {"if-image": "next.png", "timeout": "1s", "then": ["click"], "else": [{"scroll": -2}]},
+  {"while-image": "next.png", "do": [{"wait": "100ms"}]},
+  {"wait-for-image": "next.png", "timeout": "5s"},
+  {"repeat": 3, "do": [{"keys": "tab"}]}
+]}`)
+	for _, path := range []string{yaml, json} {
+		steps, err := loadScript(path)
+		if err != nil {
+			t.Errorf("%s: %v", filepath.Base(path), err)
+			continue
+		}
+		if got := dropImages(t, steps); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", filepath.Base(path), got, want)
+		}
+	}
+}
+
+// TestLoadScriptYAML checks YAML beyond plain block lists: flow style,
+// quoted scalars over several lines, block scalars and anchors.
+func TestLoadScriptYAML(t *testing.T) {
+	dir := t.TempDir()
+	writePNG(t, filepath.Join(dir, "next.png"))
+	path := writeFile(t, dir, "flow.yaml", `steps:
+  - capture
+  - {key: PageDown, }
+  - type: "first line
+      continued"
+  - type: |
+      two
+      lines
+  - &next {if-image: next.png, then: [click, {wait: 1s}]}
+  - *next
+  - {capture: true}
+`)
+	next := action{kind: "if-image", text: "next.png", then: []action{{kind: "click"}, {kind: "wait", wait: time.Second}}}
+	want := []action{
+		{kind: "capture"},
+		{kind: "key", keys: []keyPress{{key: "pagedown"}}},
+		{kind: "type", text: "first line continued"},
+		{kind: "type", text: "two\nlines\n"},
+		next,
+		next,
+		{kind: "capture"},
+	}
+	steps, err := loadScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dropImages(t, steps); !reflect.DeepEqual(got, want) {
+		t.Errorf("\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestLoadScriptErrors(t *testing.T) {
+	dir := t.TempDir()
+	writePNG(t, filepath.Join(dir, "ok.png"))
+	tests := []struct {
+		name, script, want string
+	}{
+		{"mapping.yaml", "capture: yes\n", "want a list of steps"},
+		{"nocapture.yaml", "- click\n", "has no capture step"},
+		{"bad.yaml", "- capture\n- hover\n", "step 2: unsupported action"},
+		{"twokeys.yaml", "- capture\n- key: a\n  wait: 1s\n", "step 2: want a single key"},
+		{"missing.yaml", "- capture\n- if-image: gone.png\n  then: [click]\n", "if-image"},
+		{"emptyif.yaml", "- capture\n- if-image: ok.png\n", "needs then or else"},
+		{"unknown.yaml", "- capture\n- repeat: 2\n  then:\n    - click\n", `repeat does not take "then"`},
+		{"count.yaml", "- capture\n- repeat: 0\n  do:\n    - click\n", "want a positive count"},
+		{"timeout.yaml", "- capture\n- wait-for-image: ok.png\n  timeout: later\n", "invalid timeout"},
+		{"body.yaml", "- capture\n- repeat: 2\n  do:\n    - click\n    - hover\n", "repeat do step 2"},
+		{"bad.json", `["capture",`, "did not find expected node content"},
+	}
+	for _, tt := range tests {
+		_, err := loadScript(writeFile(t, dir, tt.name, tt.script))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: loadScript error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestRecordedScript checks that what --record writes loads back as the
+// recorded steps.
+func TestRecordedScript(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+	var events []recordEvent
+	for i, r := range `"quoted": yes # ` {
+		events = append(events, recordEvent{at: at(100 * i), kind: "key", text: string(r)})
+	}
+	events = append(events,
+		recordEvent{at: at(3000), kind: "mark"},
+		recordEvent{at: at(3100), kind: "key", key: keyPress{key: "tab", mods: []string{"shift"}}},
+		recordEvent{at: at(3200), kind: "press", button: 1, pos: image.Pt(5, 5)},
+		recordEvent{at: at(3300), kind: "release", button: 1, pos: image.Pt(6, 5)},
+		recordEvent{at: at(4500), kind: "press", button: 1, pos: image.Pt(10, 10)},
+		recordEvent{at: at(4700), kind: "release", button: 1, pos: image.Pt(200, 10)},
+		recordEvent{at: at(4800), kind: "press", button: 5},
+		recordEvent{at: at(4900), kind: "press", button: 5},
+	)
+
+	var b strings.Builder
+	for _, spec := range recordSteps(events) {
+		b.WriteString("- " + spec + "\n")
+	}
+	steps, err := loadScript(writeFile(t, t.TempDir(), "recorded.yaml", b.String()))
+	if err != nil {
+		t.Fatalf("%v\n%s", err, b.String())
+	}
+	want := []action{
+		{kind: "type", text: `"quoted": yes # `},
+		{kind: "wait", wait: 1500 * time.Millisecond},
+		{kind: "capture"},
+		{kind: "key", keys: []keyPress{{key: "tab", mods: []string{"shift"}}}},
+		{kind: "click", at: pt(5, 5)},
+		{kind: "wait", wait: 1200 * time.Millisecond},
+		{kind: "drag", at: pt(10, 10), to: pt(200, 10)},
+		{kind: "scroll", scroll: -2},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("loaded\n%s as\n %+v\nwant %+v", b.String(), steps, want)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"hash/fnv"
+	"image"
+	"image/draw"
+	"time"
+)
+
+const (
+	scrollSettleDelay = 300 * time.Millisecond
+	minOverlapMatch   = 0.9 // fraction of overlapping rows that must agree
+)
+
+func rowHashes(img *image.RGBA) []uint64 {
+	b := img.Bounds()
+	hashes := make([]uint64, b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		h := fnv.New64a()
+		o := img.PixOffset(b.Min.X, b.Min.Y+y)
+		h.Write(img.Pix[o : o+4*b.Dx()])
+		hashes[y] = h.Sum64()
+	}
+	return hashes
+}
+
+// scrollOffset finds how many rows the content moved up between prev and
+// next, returning 0 if the images are identical (nothing left to scroll) and
+// -1 if no convincing overlap exists.
+func scrollOffset(prev, next []uint64) int {
+	n := len(prev)
+	if n != len(next) {
+		return -1
+	}
+
+	same := true
+	for i := range prev {
+		if prev[i] != next[i] {
+			same = false
+			break
+		}
+	}
+	if same {
+		return 0
+	}
+
+	best, bestScore := -1, 0.0
+	for d := 1; d < n-n/10; d++ {
+		matches := 0
+		for y := 0; y < n-d; y++ {
+			if prev[y+d] == next[y] {
+				matches++
+			}
+		}
+		score := float64(matches) / float64(n-d)
+		if score > bestScore {
+			best, bestScore = d, score
+		}
+	}
+	if bestScore < minOverlapMatch {
+		return -1
+	}
+	return best
+}
+
+// captureScrolling scrolls through the capture area and stitches the
+// segments into one tall image, then scrolls back to where it started.
+func captureScrolling(opts options) (image.Image, image.Rectangle, error) {
+	img, bounds, err := captureImage(opts)
+	if err != nil {
+		return nil, bounds, err
+	}
+
+	first := toRGBA(img)
+	w, h := first.Bounds().Dx(), first.Bounds().Dy()
+	segments := []*image.RGBA{first}
+	offsets := []int{h}
+	prev := rowHashes(first)
+
+	scrolled := 0
+	for i := 1; i < opts.scrollMax; i++ {
+		if err := opts.input.scroll(-opts.scrollStep); err != nil {
+			return nil, bounds, err
+		}
+		scrolled++
+		time.Sleep(scrollSettleDelay)
+
+		img, _, err := captureImage(opts)
+		if err != nil {
+			break
+		}
+		seg := toRGBA(img)
+		if seg.Bounds().Dx() != w || seg.Bounds().Dy() != h {
+			break
+		}
+		next := rowHashes(seg)
+		d := scrollOffset(prev, next)
+		if d == 0 {
+			break
+		}
+		if d < 0 {
+			d = h
+		}
+		segments = append(segments, seg)
+		offsets = append(offsets, d)
+		prev = next
+	}
+
+	for ; scrolled > 0; scrolled-- {
+		opts.input.scroll(opts.scrollStep)
+	}
+
+	total := 0
+	for _, d := range offsets {
+		total += d
+	}
+	stitched := image.NewRGBA(image.Rect(0, 0, w, total))
+	y := 0
+	for i, seg := range segments {
+		// Only the newly revealed bottom rows of each later segment are added.
+		src := image.Pt(0, h-offsets[i])
+		draw.Draw(stitched, image.Rect(0, y, w, y+offsets[i]), seg, src, draw.Src)
+		y += offsets[i]
+	}
+	return stitched, bounds, nil
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// session runs the capture loop and collects the saved screenshot paths.
+type session struct {
+	opts   options
+	dir    string
+	prefix string // capture file names, unique to the session
+	files  []string
+	failed []int
+	dedupe *deduper
+	// windowDedupe tracks duplicates per window in --all-windows mode.
+	windowDedupe []*deduper
+	trigger      <-chan struct{}
+	// stop receives why the session should end: the stop hotkey or Ctrl-C.
+	stop      <-chan string
+	interrupt chan os.Signal
+	pause     <-chan struct{}
+	// paused is the total time spent paused, which shifts --interval
+	// captures.
+	paused time.Duration
+	// stream receives each capture as it is saved in --stream mode.
+	stream *streamPDF
+	log    *sessionLog
+	// lua runs the --lua flow.
+	lua *luaFlow
+
+	// settled compares consecutive frames for --stop-unchanged; repeats
+	// holds the files saved since the screen last changed.
+	settled   *deduper
+	repeats   []string
+	unchanged int
+
+	// started, actions and halted enforce --max-duration and --max-actions;
+	// cornered is set by the --failsafe watcher, which stops once finished
+	// is closed.
+	started  time.Time
+	actions  int
+	halted   string
+	cornered atomic.Bool
+	finished chan struct{}
+}
+
+// errSessionLimit is returned by actions refused once a hard limit is hit.
+var errSessionLimit = errors.New("session limit reached")
+
+func newSession(opts options, dir string) (*session, error) {
+	s := &session{opts: opts, dir: dir, dedupe: newDeduper(opts), log: newSessionLog(opts), started: time.Now(), finished: make(chan struct{})}
+	s.prefix = sessionPrefix(dir, s.started)
+	if opts.stopUnchanged > 0 {
+		s.settled = newDeduper(opts)
+		if s.settled.mode == "off" {
+			s.settled.mode = "exact"
+		}
+	}
+
+	var keys []string
+	if opts.triggerKey != "" {
+		keys = append(keys, opts.triggerKey)
+	}
+	if opts.stopKey != "" {
+		keys = append(keys, opts.stopKey)
+	}
+	if opts.pauseKey != "" {
+		keys = append(keys, opts.pauseKey)
+	}
+	if len(keys) == 0 {
+		s.watchStop(nil)
+		return s, nil
+	}
+
+	chans, err := bindHotkeys(keys...)
+	if err != nil {
+		if opts.triggerKey != "" {
+			return nil, err
+		}
+		// Without the stop hotkey, Ctrl-C still ends an open-ended session
+		// and builds the PDF; a session with a count runs fine without the
+		// pause hotkey.
+		if opts.stopKey != "" {
+			slog.Warn("stop hotkey unavailable, press Ctrl-C to stop instead", "err", err)
+		} else {
+			slog.Warn("pause hotkey unavailable", "err", err)
+		}
+		s.opts.stopKey, s.opts.pauseKey = "", ""
+		s.watchStop(nil)
+		return s, nil
+	}
+	if opts.triggerKey != "" {
+		s.trigger, chans = chans[0], chans[1:]
+	}
+	var stopKey <-chan struct{}
+	if opts.stopKey != "" {
+		stopKey, chans = chans[0], chans[1:]
+	}
+	if opts.pauseKey != "" {
+		s.pause = chans[0]
+	}
+	s.watchStop(stopKey)
+	return s, nil
+}
+
+// watchStop feeds the stop hotkey, Ctrl-C and the dashboard's q key into
+// s.stop, so all end the loop and still build the PDF. The first Ctrl-C
+// restores the default handler: a second one quits at once. The dashboard's
+// p key joins the pause hotkey.
+func (s *session) watchStop(hotkey <-chan struct{}) {
+	stop := make(chan string, 1)
+	s.stop = stop
+	s.interrupt = make(chan os.Signal, 1)
+	signal.Notify(s.interrupt, os.Interrupt)
+	var deadline <-chan time.Time
+	if s.opts.maxDuration > 0 {
+		deadline = time.After(s.opts.maxDuration)
+	}
+	corner := s.watchCorner()
+	var quit <-chan struct{}
+	if d, ok := s.opts.view.(*dashboard); ok {
+		quit = d.stop
+		s.pause = mergeSignals(s.pause, d.pause)
+	}
+	go func() {
+		for {
+			var reason string
+			select {
+			case <-hotkey:
+				reason = s.opts.stopKey + " pressed"
+			case <-s.interrupt:
+				signal.Stop(s.interrupt)
+				reason = "Interrupted"
+			case <-deadline:
+				reason = fmt.Sprintf("Reached --max-duration of %s", s.opts.maxDuration)
+			case <-corner:
+				corner = nil
+				reason = failsafeReason
+			case <-quit:
+				reason = "Stopped from the dashboard"
+			}
+			select {
+			case stop <- reason:
+			default:
+			}
+		}
+	}()
+}
+
+// mergeSignals returns a channel that receives a value whenever a or b
+// does.
+func mergeSignals(a, b <-chan struct{}) <-chan struct{} {
+	if a == nil {
+		return b
+	}
+	out := make(chan struct{}, 1)
+	forward := func(c <-chan struct{}) {
+		for range c {
+			select {
+			case out <- struct{}{}:
+			default:
+			}
+		}
+	}
+	go forward(a)
+	go forward(b)
+	return out
+}
+
+// limit is the number of iterations to run: the requested count, or the
+// safety cap for open-ended sessions.
+func (s *session) limit() int {
+	switch {
+	case s.opts.repetitions > 0:
+		return s.opts.repetitions
+	case s.opts.duration > 0:
+		return int(s.opts.duration/s.opts.interval) + 1
+	}
+	return s.opts.maxPages
+}
+
+// limitReached reports whether --max-duration, --max-actions or the
+// --failsafe corner has been reached, announcing it the first time.
+func (s *session) limitReached() bool {
+	if s.halted != "" {
+		return true
+	}
+	switch {
+	case s.cornered.Load():
+		s.halted = failsafeReason
+	case s.opts.maxDuration > 0 && time.Since(s.started) >= s.opts.maxDuration:
+		s.halted = fmt.Sprintf("Reached --max-duration of %s", s.opts.maxDuration)
+	case s.opts.maxActions > 0 && s.actions >= s.opts.maxActions:
+		s.halted = fmt.Sprintf("Reached --max-actions limit of %d", s.opts.maxActions)
+	default:
+		return false
+	}
+	slog.Info(s.halted + ", stopping")
+	return true
+}
+
+func (s *session) progress(i int) string {
+	if s.opts.repetitions == 0 {
+		return fmt.Sprintf("[%d]", i)
+	}
+	return fmt.Sprintf("[%d/%d]", i, s.opts.repetitions)
+}
+
+func (s *session) stopRequested() bool {
+	select {
+	case reason := <-s.stop:
+		slog.Info(reason + ", stopping")
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *session) waitTrigger(i int) bool {
+	slog.Info(fmt.Sprintf("Press %s to capture %s", s.opts.triggerKey, s.progress(i)))
+	select {
+	case <-s.trigger:
+		return true
+	case reason := <-s.stop:
+		slog.Info(reason + ", stopping")
+		return false
+	}
+}
+
+// checkPause pauses the session if the pause hotkey was pressed since the
+// last iteration. It returns false if the session is stopped while paused.
+func (s *session) checkPause() bool {
+	select {
+	case <-s.pause:
+		return s.waitResume()
+	default:
+		return true
+	}
+}
+
+// waitResume blocks until the pause hotkey is pressed again. It returns
+// false if the stop hotkey is pressed instead.
+func (s *session) waitResume() bool {
+	slog.Info(fmt.Sprintf("Paused; press %s to resume", s.opts.pauseKey), "pages", len(s.files))
+	s.log.add(logEvent{Type: "pause", Capture: len(s.files)})
+	since := time.Now()
+	select {
+	case <-s.pause:
+		s.paused += time.Since(since)
+		slog.Info("Resumed")
+		s.log.add(logEvent{Type: "resume", Capture: len(s.files)})
+		return true
+	case reason := <-s.stop:
+		slog.Info(reason + ", stopping")
+		return false
+	}
+}
+
+// waitInterval sleeps until the i-th time-lapse capture is due. It returns
+// false if the stop hotkey is pressed meanwhile.
+func (s *session) waitInterval(start time.Time, i int) bool {
+	for {
+		due := start.Add(time.Duration(i-1)*s.opts.interval + s.paused)
+		select {
+		case <-time.After(time.Until(due)):
+			return true
+		case reason := <-s.stop:
+			slog.Info(reason + ", stopping")
+			return false
+		case <-s.pause:
+			if !s.waitResume() {
+				return false
+			}
+		}
+	}
+}
+
+// capture takes and saves screenshot i (one per window with --all-windows).
+// It returns the raw frame for change detection.
+func (s *session) capture(i int, suffix string) (image.Image, error) {
+	if !s.opts.allWindows {
+		return s.captureOne(i, s.opts, suffix, s.dedupe)
+	}
+
+	var rects []image.Rectangle
+	var err error
+	withStderrSilenced(func() {
+		rects, err = processWindows(s.opts.targetPid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(rects) == 0 {
+		return nil, fmt.Errorf("no visible windows for pid %d", s.opts.targetPid)
+	}
+
+	var first image.Image
+	for w, r := range rects {
+		for len(s.windowDedupe) <= w {
+			s.windowDedupe = append(s.windowDedupe, newDeduper(s.opts))
+		}
+		opts := s.opts
+		opts.region = r
+		frame, err := s.captureOne(i, opts, fmt.Sprintf("%s_w%d", suffix, w+1), s.windowDedupe[w])
+		if err != nil {
+			return nil, fmt.Errorf("window %d: %w", w+1, err)
+		}
+		if first == nil {
+			first = frame
+		}
+	}
+	return first, nil
+}
+
+// sessionPrefix names the captures of a session started at t after the
+// start time, so a later session in dir never overwrites kept images.
+func sessionPrefix(dir string, t time.Time) string {
+	base := screenshotPrefix + "_" + t.Format("20060102-150405")
+	entries, _ := os.ReadDir(dir)
+	prefix := base
+	for n := 2; ; n++ {
+		used := false
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), prefix+"_") {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return prefix
+		}
+		prefix = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+func (s *session) capturePath(i int, suffix string, opts options) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s_%d%s%s", s.prefix, i, suffix, opts.imageExt()))
+}
+
+// captureOne takes and saves a single screenshot, retrying failures with
+// exponential backoff.
+func (s *session) captureOne(i int, opts options, suffix string, dedupe *deduper) (image.Image, error) {
+	filePath := s.capturePath(i, suffix, opts)
+
+	backoff := opts.retryBackoff
+	for attempt := 0; ; attempt++ {
+		started := time.Now()
+		frame, img, dup, err := captureFrame(i, opts, dedupe)
+		if err == nil {
+			if dup {
+				slog.Info("Duplicate of previous capture, skipped", "capture", i)
+				s.log.add(logEvent{Type: "duplicate", Capture: i})
+				return frame, nil
+			}
+			if opts.dryRun {
+				slog.Info("Would save screenshot", "file", filePath, "size", fmt.Sprintf("%dx%d", img.Bounds().Dx(), img.Bounds().Dy()))
+				s.files = append(s.files, filePath)
+				return frame, nil
+			}
+			err = saveImage(filePath, img, opts)
+		}
+		if err == nil {
+			slog.Info("Screenshot saved", "file", filePath)
+			slog.Debug("Capture timing", "capture", i, "attempt", attempt+1, "took", time.Since(started))
+			s.files = append(s.files, filePath)
+			s.log.add(logEvent{Type: "capture", Capture: i, File: filePath, Attempt: attempt + 1})
+			if s.stream != nil {
+				if err := s.stream.addPage(filePath); err != nil {
+					slog.Error("adding page to PDF", "err", err, "file", filePath)
+				}
+			}
+			return frame, nil
+		}
+
+		s.log.add(logEvent{Type: "error", Capture: i, Attempt: attempt + 1, Error: err.Error()})
+		if attempt >= opts.retries {
+			return nil, err
+		}
+		slog.Warn("capture failed, retrying", "err", err, "capture", i, "in", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// summary reports captures that failed after all retries.
+func (s *session) summary() {
+	if len(s.failed) == 0 {
+		return
+	}
+	pages := make([]string, len(s.failed))
+	for i, n := range s.failed {
+		pages[i] = strconv.Itoa(n)
+	}
+	slog.Warn(fmt.Sprintf("%d capture(s) failed permanently", len(s.failed)), "captures", strings.Join(pages, ","))
+}
+
+// shoot waits --capture-delay and takes capture i, recording a failure.
+func (s *session) shoot(i int, suffix string) (image.Image, bool) {
+	s.sleep(s.opts.captureDelay)
+	frame, err := s.capture(i, suffix)
+	if err != nil {
+		slog.Error("taking screenshot", "err", err, "capture", i)
+		s.failed = append(s.failed, i)
+		s.log.add(logEvent{Type: "failed", Capture: i, Error: err.Error()})
+		return nil, false
+	}
+	return frame, true
+}
+
+func (s *session) run() {
+	defer signal.Stop(s.interrupt)
+	defer close(s.finished)
+	if s.opts.stopKey != "" {
+		slog.Info(fmt.Sprintf("Press %s or Ctrl-C to stop and build the PDF", s.opts.stopKey))
+	}
+	if s.pause != nil && s.opts.pauseKey != "" {
+		slog.Info(fmt.Sprintf("Press %s to pause and resume", s.opts.pauseKey))
+	}
+
+	// For --progress json: the planned count (0 when open-ended), then how
+	// many pages were captured.
+	s.log.emit(logEvent{Type: "start", Amount: s.opts.repetitions})
+	defer func() { s.log.emit(logEvent{Type: "end", Amount: len(s.files)}) }()
+
+	start := time.Now()
+	for i := 1; i <= s.limit(); i++ {
+		if !s.checkPause() || s.limitReached() {
+			return
+		}
+		if s.opts.interval > 0 {
+			if !s.waitInterval(start, i) {
+				return
+			}
+		} else if s.trigger != nil {
+			if !s.waitTrigger(i) {
+				return
+			}
+		} else if s.stopRequested() {
+			return
+		}
+		if s.opts.progress == "lines" {
+			slog.Info(s.progress(i))
+		}
+		s.log.emit(logEvent{Type: "iteration", Capture: i})
+
+		before := len(s.files)
+		if s.lua != nil {
+			frame, done := s.runLua(i)
+			if done || s.screenSettled(frame, before) || s.stopImageFound() {
+				return
+			}
+			continue
+		}
+		if len(s.opts.script) > 0 {
+			if s.screenSettled(s.runScript(i), before) || s.stopImageFound() {
+				return
+			}
+			continue
+		}
+
+		frame, ok := s.shoot(i, "")
+		if !ok {
+			continue
+		}
+		if s.screenSettled(frame, before) || s.stopImageFound() {
+			return
+		}
+
+		if s.opts.interval > 0 {
+			continue
+		}
+
+		s.sleep(s.opts.preClickDelay)
+		if err := s.advance(i); errors.Is(err, errSessionLimit) {
+			return
+		} else if err != nil {
+			slog.Error("advancing", "err", err, "capture", i)
+			s.log.add(logEvent{Type: "error", Capture: i, Error: err.Error()})
+		}
+		s.sleep(s.opts.postClickDelay)
+
+		if s.opts.waitChange && i < s.limit() {
+			if err := s.awaitChange(frame); err != nil {
+				slog.Warn("waiting for a change", "err", err)
+			}
+		}
+	}
+
+	if s.opts.repetitions == 0 && s.opts.duration == 0 {
+		slog.Info(fmt.Sprintf("Reached --max-pages limit of %d", s.opts.maxPages))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestSessionNames checks that a second session in the same folder, even
+// one started in the same second, does not reuse the first one's names.
+func TestSessionNames(t *testing.T) {
+	dir := t.TempDir()
+	opts := options{format: "png"}
+	var paths []string
+	for run := 0; run < 2; run++ {
+		s, err := newSession(opts, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i <= 2; i++ {
+			path := s.capturePath(i, "", opts)
+			if _, err := os.Stat(path); err == nil {
+				t.Fatalf("session %d capture %d: %s already exists", run+1, i, path)
+			}
+			if err := os.WriteFile(path, []byte{byte(run)}, 0644); err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, path)
+		}
+	}
+	for n, path := range paths {
+		if data, err := os.ReadFile(path); err != nil || data[0] != byte(n/2) {
+			t.Errorf("%s: overwritten by another session", path)
+		}
+	}
+}
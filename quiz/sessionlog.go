@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+const sessionLogName = "session-log.json"
+
+// logEvent is one entry of the session log: a saved capture, a skipped
+// duplicate, a failed attempt, or an action (click, key press, scroll, drag).
+// --progress json also prints start, iteration, end and done events.
+type logEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Capture int       `json:"capture"`
+	File    string    `json:"file,omitempty"`
+	Attempt int       `json:"attempt,omitempty"`
+	Button  string    `json:"button,omitempty"`
+	Key     string    `json:"key,omitempty"`
+	Amount  int       `json:"amount,omitempty"`
+	X       *int      `json:"x,omitempty"`
+	Y       *int      `json:"y,omitempty"`
+	ToX     *int      `json:"to_x,omitempty"`
+	ToY     *int      `json:"to_y,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Outputs []string  `json:"outputs,omitempty"`
+}
+
+// sessionLog records what happened during a session, for --attach-log.
+type sessionLog struct {
+	Started  time.Time  `json:"started"`
+	Finished time.Time  `json:"finished"`
+	Host     string     `json:"host"`
+	Platform string     `json:"platform"`
+	Settings []string   `json:"settings"`
+	Events   []logEvent `json:"events"`
+
+	progress io.Writer // --progress json stream, one event per line
+	view     progressView
+}
+
+func newSessionLog(opts options) *sessionLog {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	l := &sessionLog{
+		Started:  time.Now(),
+		Host:     host,
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+		Settings: append([]string{}, opts.settings...),
+		Events:   []logEvent{},
+	}
+	if opts.progress == "json" {
+		l.progress = os.Stdout
+	}
+	l.view = opts.view
+	return l
+}
+
+func (l *sessionLog) add(e logEvent) {
+	e.Time = time.Now()
+	l.emit(e)
+	if e.File != "" {
+		e.File = filepath.Base(e.File)
+	}
+	l.Events = append(l.Events, e)
+}
+
+// emit passes e to the --progress bar or dashboard, or prints it to the
+// --progress json stream with the full file path.
+func (l *sessionLog) emit(e logEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if l.view != nil {
+		l.view.event(e)
+	}
+	if l.progress == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err == nil {
+		l.progress.Write(append(data, '\n'))
+	}
+}
+
+func (l *sessionLog) click(capture, x, y int, button string) {
+	l.add(logEvent{Type: "click", Capture: capture, Button: button, X: &x, Y: &y})
+}
+
+// encode finishes the log and returns it as indented JSON.
+func (l *sessionLog) encode() ([]byte, error) {
+	l.Finished = time.Now()
+	return json.MarshalIndent(l, "", "  ")
+}
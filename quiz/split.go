@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// writePDFs writes the captures to pdfPath, or to numbered files next to it
+// when --split-every or --max-pdf-size break the session into parts.
+func writePDFs(pdfPath string, files []string, opts options) ([]string, error) {
+	if opts.splitEvery <= 0 && opts.maxPDFSize <= 0 {
+		return []string{pdfPath}, exportPDF(pdfPath, files, opts)
+	}
+
+	if opts.ocr {
+		// A part may be written more than once to fit --max-pdf-size;
+		// recognise each capture only once.
+		opts.ocrWords = map[string][]ocrWord{}
+	}
+	base := strings.TrimSuffix(pdfPath, ".pdf")
+	var paths []string
+	next := func() string {
+		return fmt.Sprintf("%s_%d.pdf", base, len(paths)+1)
+	}
+
+	for start := 0; start < len(files) || start == 0; {
+		end := len(files)
+		if opts.splitEvery > 0 {
+			end = min(end, start+opts.splitEvery)
+		}
+		n, err := writeBounded(next(), files[start:end], start, opts)
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, next())
+		start += n
+		if n == 0 {
+			break
+		}
+	}
+
+	if len(paths) == 1 {
+		if err := os.Rename(paths[0], pdfPath); err != nil {
+			return paths, err
+		}
+		paths[0] = pdfPath
+	}
+	return paths, nil
+}
+
+// writeBounded writes the longest prefix of files that stays within
+// --max-pdf-size, returning how many files it used. A single capture larger
+// than the limit is still written on its own.
+func writeBounded(path string, files []string, first int, opts options) (int, error) {
+	opts.firstPage = first
+	n := len(files)
+	var sizes []int64
+	for {
+		if err := exportPDF(path, files[:n], opts); err != nil {
+			return 0, err
+		}
+		if opts.maxPDFSize <= 0 || n <= 1 {
+			break
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		if info.Size() <= opts.maxPDFSize {
+			break
+		}
+		if sizes == nil {
+			sizes = captureSizes(files)
+		}
+		n = fitPages(sizes[:n], info.Size(), opts.maxPDFSize)
+	}
+	if n == 1 && opts.maxPDFSize > 0 {
+		if info, err := os.Stat(path); err == nil && info.Size() > opts.maxPDFSize {
+			slog.Warn("page exceeds --max-pdf-size on its own", "file", files[0])
+		}
+	}
+	return n, nil
+}
+
+// captureSizes returns the size of each capture file, 0 if it is unreadable.
+func captureSizes(files []string) []int64 {
+	sizes := make([]int64, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			sizes[i] = info.Size()
+		}
+	}
+	return sizes
+}
+
+// fitPages returns how many of the captures, which made a PDF of total
+// bytes, should fit within limit, sharing the PDF size out in proportion
+// to the capture sizes. It keeps at least one capture and drops at least
+// one, so repeated calls always make progress.
+func fitPages(sizes []int64, total, limit int64) int {
+	var sum int64
+	for _, s := range sizes {
+		sum += s
+	}
+	if sum == 0 {
+		return max(1, min(len(sizes)-1, int(float64(len(sizes))*float64(limit)/float64(total))))
+	}
+	scale := float64(total) / float64(sum)
+	n, used := 0, 0.0
+	for n < len(sizes) && used+float64(sizes[n])*scale <= float64(limit) {
+		used += float64(sizes[n]) * scale
+		n++
+	}
+	return max(1, min(len(sizes)-1, n))
+}
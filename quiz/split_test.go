@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFitPages(t *testing.T) {
+	tests := []struct {
+		name         string
+		sizes        []int64
+		total, limit int64
+		want         int
+	}{
+		{"equal pages", []int64{10, 10, 10, 10}, 400, 200, 2},
+		{"large page last", []int64{10, 10, 10, 70}, 1000, 400, 3},
+		{"large page first", []int64{70, 10, 10, 10}, 1000, 900, 3},
+		{"overhead rounds down", []int64{10, 10, 10, 10}, 440, 219, 1},
+		{"drops at least one", []int64{10, 10}, 201, 200, 1},
+		{"keeps at least one", []int64{100, 1}, 1000, 10, 1},
+		{"unreadable captures", []int64{0, 0, 0, 0}, 400, 200, 2},
+	}
+	for _, tt := range tests {
+		if got := fitPages(tt.sizes, tt.total, tt.limit); got != tt.want {
+			t.Errorf("%s: fitPages = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestWritePDFsMaxSize splits captures of different sizes and checks every
+// part keeps to --max-pdf-size and together they hold every capture.
+func TestWritePDFsMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewPCG(1, 2))
+	var files []string
+	for i, side := range []int{40, 120, 40, 40, 160, 40, 80} {
+		img := image.NewGray(image.Rect(0, 0, side, side))
+		for p := range img.Pix {
+			img.Pix[p] = uint8(rng.IntN(256)) // noise does not compress
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%03d.png", i+1))
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		files = append(files, path)
+	}
+
+	for _, backend := range []string{"gofpdf", "pdfcpu"} {
+		opts := pdfOptions()
+		opts.pdfBackend = backend
+		opts.bookmarks = false
+		opts.maxPDFSize = 40000
+		paths, err := writePDFs(filepath.Join(dir, backend+".pdf"), files, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		pages := 0
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := readPDFCPU(t, path, nil).PageCount
+			if info.Size() > opts.maxPDFSize && n > 1 {
+				t.Errorf("%s: %s has %d pages in %d bytes", backend, filepath.Base(path), n, info.Size())
+			}
+			pages += n
+		}
+		if pages != len(files) || len(paths) < 2 {
+			t.Errorf("%s: %d pages in %d parts, want %d pages split up", backend, pages, len(paths), len(files))
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// streamPDF writes pages to disk as captures complete. In --stream mode each
+// page is followed by an incremental update (new page tree, catalog,
+// cross-reference section and trailer), so the file is a valid PDF after
+// every capture and memory use does not grow with the session. Otherwise
+// the update is written once, on Close.
+type streamPDF struct {
+	f        *os.File
+	w        *bufio.Writer
+	offset   int64
+	next     int           // next free object number
+	written  map[int]int64 // objects since the last cross-reference section
+	pages    []int
+	lastXref int64
+	profile  int // ICC profile object for RGB images, or 0
+	opts     options
+}
+
+const (
+	streamCatalog = 1
+	streamPages   = 2
+	streamInfo    = 3
+)
+
+func newStreamPDF(path string, opts options) (*streamPDF, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &streamPDF{f: f, w: bufio.NewWriter(f), next: 4, written: map[int]int64{}, lastXref: -1, opts: opts}
+	s.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	info := []string{"/Creator (quiz)", "/Producer (quiz)", "/CreationDate " + pdfString("D:"+time.Now().Format("20060102150405"))}
+	for _, f := range []struct{ key, value string }{
+		{"Title", opts.pdfTitle}, {"Author", opts.pdfAuthor}, {"Subject", opts.pdfSubject}, {"Keywords", opts.pdfKeywords},
+	} {
+		if f.value != "" {
+			info = append(info, "/"+f.key+" "+pdfString(pdfText(f.value)))
+		}
+	}
+	s.object(streamInfo, "<< "+strings.Join(info, " ")+" >>", nil)
+	if profile := colorTag(opts); profile != nil {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(profile)
+		zw.Close()
+		s.profile = s.alloc()
+		s.object(s.profile, fmt.Sprintf("<< /N 3 /Alternate /DeviceRGB /Filter /FlateDecode /Length %d >>", buf.Len()), buf.Bytes())
+	}
+	if !opts.stream {
+		return s, nil
+	}
+	if err := s.commit(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// pdfString escapes s as a PDF literal string.
+func pdfString(s string) string {
+	return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`).Replace(s) + ")"
+}
+
+func (s *streamPDF) printf(format string, args ...any) {
+	n, _ := fmt.Fprintf(s.w, format, args...)
+	s.offset += int64(n)
+}
+
+func (s *streamPDF) object(num int, dict string, stream []byte) {
+	s.written[num] = s.offset
+	s.printf("%d 0 obj\n%s\n", num, dict)
+	if stream != nil {
+		s.printf("stream\n")
+		n, _ := s.w.Write(stream)
+		s.offset += int64(n)
+		s.printf("\nendstream\n")
+	}
+	s.printf("endobj\n")
+}
+
+func (s *streamPDF) alloc() int {
+	s.next++
+	return s.next - 1
+}
+
+// addPage embeds an image file as a new page.
+func (s *streamPDF) addPage(file string) error {
+	img, err := decodeImageFile(file)
+	if err != nil {
+		return err
+	}
+	px := img.Bounds().Size()
+	l := layoutPage(float64(px.X)/s.opts.pageScale, float64(px.Y)/s.opts.pageScale, s.opts)
+	resized := false
+	if size := embedSize(px, l.w, s.opts); size != px {
+		img, px, resized = resizeImage(img, size), size, true
+	}
+
+	var data []byte
+	filter := "/FlateDecode"
+	_, gray := img.(*image.Gray)
+	colorSpace := "/DeviceRGB"
+	if gray {
+		colorSpace = "/DeviceGray"
+	} else if s.profile != 0 {
+		colorSpace = fmt.Sprintf("[/ICCBased %d 0 R]", s.profile)
+	}
+	isJPEG := strings.EqualFold(filepath.Ext(file), ".jpg")
+	switch {
+	case s.opts.embedFormat == "auto" && isJPEG && !resized:
+		// Baseline JPEG captures embed as-is.
+		filter = "/DCTDecode"
+		data, err = os.ReadFile(file)
+	case s.opts.embedFormat == "jpeg" || (s.opts.embedFormat == "auto" && isJPEG):
+		var buf bytes.Buffer
+		filter = "/DCTDecode"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: s.opts.embedQuality})
+		data = buf.Bytes()
+	default:
+		data, err = deflateSamples(img, gray)
+	}
+	if err != nil {
+		return err
+	}
+
+	pw, ph := l.size.Wd, l.size.Ht
+	if l.orientation == "L" {
+		pw, ph = ph, pw
+	}
+	imageObj, contentObj, pageObj := s.alloc(), s.alloc(), s.alloc()
+	s.object(imageObj, fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter %s /Length %d >>",
+		px.X, px.Y, colorSpace, filter, len(data)), data)
+	content := fmt.Sprintf("q %.2f 0 0 %.2f %.2f %.2f cm /Im0 Do Q", l.w, l.h, l.x, ph-l.y-l.h)
+	s.object(contentObj, fmt.Sprintf("<< /Length %d >>", len(content)), []byte(content))
+	s.object(pageObj, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+		streamPages, pw, ph, imageObj, contentObj), nil)
+	s.pages = append(s.pages, pageObj)
+	if !s.opts.stream {
+		return nil
+	}
+	return s.commit()
+}
+
+// deflateSamples returns img as zlib-compressed 8-bit RGB, or gray, samples.
+func deflateSamples(img image.Image, gray bool) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if gray {
+		g := img.(*image.Gray)
+		for y := 0; y < g.Bounds().Dy(); y++ {
+			if _, err := zw.Write(g.Pix[y*g.Stride : y*g.Stride+g.Bounds().Dx()]); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), zw.Close()
+	}
+
+	rgba := toRGBA(img)
+	row := make([]byte, 3*rgba.Bounds().Dx())
+	for y := 0; y < rgba.Bounds().Dy(); y++ {
+		src := rgba.Pix[y*rgba.Stride:]
+		for x := 0; x < len(row)/3; x++ {
+			copy(row[3*x:3*x+3], src[4*x:4*x+3])
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// commit appends the page tree and catalog followed by a cross-reference
+// section and trailer covering everything written since the previous one.
+func (s *streamPDF) commit() error {
+	kids := make([]string, len(s.pages))
+	for i, p := range s.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", p)
+	}
+	s.object(streamPages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(s.pages)), nil)
+	s.object(streamCatalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", streamPages), nil)
+
+	xref := s.offset
+	s.printf("xref\n")
+	if s.lastXref < 0 {
+		s.printf("0 1\n0000000000 65535 f \n")
+	}
+	nums := make([]int, 0, len(s.written))
+	for num := range s.written {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	// One subsection per run of consecutive object numbers.
+	for start := 0; start < len(nums); {
+		end := start + 1
+		for end < len(nums) && nums[end] == nums[end-1]+1 {
+			end++
+		}
+		s.printf("%d %d\n", nums[start], end-start)
+		for _, num := range nums[start:end] {
+			s.printf("%010d 00000 n \n", s.written[num])
+		}
+		start = end
+	}
+	s.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R", s.next, streamCatalog, streamInfo)
+	if s.lastXref >= 0 {
+		s.printf(" /Prev %d", s.lastXref)
+	}
+	s.printf(" >>\nstartxref\n%d\n%%%%EOF\n", xref)
+	s.lastXref = xref
+	s.written = map[int]int64{}
+
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *streamPDF) Close() error {
+	if len(s.written) > 0 {
+		if err := s.commit(); err != nil {
+			s.f.Close()
+			return err
+		}
+	}
+	return s.f.Close()
+}
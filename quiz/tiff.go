@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"os"
+)
+
+// TIFF compression schemes written by --export tiff.
+var tiffCompressions = map[string]uint16{"none": 1, "lzw": 5, "deflate": 8}
+
+// TIFF field types.
+const (
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+type tiffField struct {
+	tag, typ uint16
+	values   []uint32 // rationals are stored as numerator, denominator pairs
+}
+
+// writeTIFF writes the captures as one multi-page TIFF, one 8-bit RGB or
+// grayscale page per capture.
+func writeTIFF(path string, files []string, opts options) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	var offset uint32
+	write := func(b []byte) {
+		w.Write(b)
+		offset += uint32(len(b))
+	}
+	// Each IFD ends with the offset of the next one; the previous pointer
+	// is patched in once the next IFD's position is known.
+	next := uint32(4)
+	write([]byte{'I', 'I', 42, 0, 0, 0, 0, 0})
+
+	compression := tiffCompressions[opts.tiffCompression]
+	dpi := uint32(math.Round(72 * opts.pageScale))
+	if dpi == 0 {
+		dpi = 72
+	}
+
+	for i, file := range files {
+		img, err := decodeImageFile(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		pix, spp, bounds := tiffSamples(img)
+		if compression != 1 {
+			tiffPredict(pix, bounds.Dx(), spp)
+		}
+		data, err := tiffCompress(pix, compression)
+		if err != nil {
+			return err
+		}
+
+		dataOffset := offset
+		write(data)
+		if offset%2 == 1 {
+			write([]byte{0})
+		}
+
+		photometric, bps := uint32(2), []uint32{8, 8, 8}
+		if spp == 1 {
+			photometric, bps = 1, []uint32{8}
+		}
+		fields := []tiffField{
+			{254, tiffLong, []uint32{2}}, // page of a multi-page document
+			{256, tiffLong, []uint32{uint32(bounds.Dx())}},
+			{257, tiffLong, []uint32{uint32(bounds.Dy())}},
+			{258, tiffShort, bps},
+			{259, tiffShort, []uint32{uint32(compression)}},
+			{262, tiffShort, []uint32{photometric}},
+			{273, tiffLong, []uint32{dataOffset}},
+			{277, tiffShort, []uint32{uint32(spp)}},
+			{278, tiffLong, []uint32{uint32(bounds.Dy())}},
+			{279, tiffLong, []uint32{uint32(len(data))}},
+			{282, tiffRational, []uint32{dpi, 1}},
+			{283, tiffRational, []uint32{dpi, 1}},
+			{284, tiffShort, []uint32{1}},
+			{296, tiffShort, []uint32{2}}, // inches
+			{297, tiffShort, []uint32{uint32(i), uint32(len(files))}},
+		}
+		if compression != 1 {
+			fields = append(fields, tiffField{317, tiffShort, []uint32{2}}) // horizontal differencing
+		}
+
+		ifd, extra := tiffIFD(fields, offset)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if _, err := out.WriteAt(binary.LittleEndian.AppendUint32(nil, offset), int64(next)); err != nil {
+			return err
+		}
+		next = offset + uint32(len(ifd)) - 4
+		write(ifd)
+		write(extra)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// tiffIFD encodes fields (sorted by tag) as an IFD placed at offset, with a
+// zero next-IFD pointer. Values that do not fit in an entry are returned in
+// extra, which must be written directly after the IFD.
+func tiffIFD(fields []tiffField, offset uint32) (ifd, extra []byte) {
+	le := binary.LittleEndian
+	ifd = le.AppendUint16(nil, uint16(len(fields)))
+	extraOffset := offset + 2 + 12*uint32(len(fields)) + 4
+	for _, f := range fields {
+		var value []byte
+		count := uint32(len(f.values))
+		for _, v := range f.values {
+			if f.typ == tiffShort {
+				value = le.AppendUint16(value, uint16(v))
+			} else {
+				value = le.AppendUint32(value, v)
+			}
+		}
+		if f.typ == tiffRational {
+			count /= 2
+		}
+
+		ifd = le.AppendUint16(ifd, f.tag)
+		ifd = le.AppendUint16(ifd, f.typ)
+		ifd = le.AppendUint32(ifd, count)
+		if len(value) <= 4 {
+			ifd = append(ifd, value...)
+			ifd = append(ifd, make([]byte, 4-len(value))...)
+			continue
+		}
+		ifd = le.AppendUint32(ifd, extraOffset+uint32(len(extra)))
+		extra = append(extra, value...)
+	}
+	return le.AppendUint32(ifd, 0), extra
+}
+
+// tiffSamples returns the image's pixels as 8-bit samples: one per pixel
+// for grayscale images, otherwise RGB with alpha dropped.
+func tiffSamples(img image.Image) ([]byte, int, image.Rectangle) {
+	if gray, ok := img.(*image.Gray); ok {
+		b := gray.Bounds()
+		pix := make([]byte, 0, b.Dx()*b.Dy())
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			i := gray.PixOffset(b.Min.X, y)
+			pix = append(pix, gray.Pix[i:i+b.Dx()]...)
+		}
+		return pix, 1, b
+	}
+
+	rgba := toRGBA(img)
+	pix := make([]byte, 0, len(rgba.Pix)/4*3)
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		pix = append(pix, rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2])
+	}
+	return pix, 3, rgba.Bounds()
+}
+
+// tiffPredict applies TIFF predictor 2: each sample is replaced by its
+// difference from the same sample of the pixel to its left.
+func tiffPredict(pix []byte, width, spp int) {
+	stride := width * spp
+	for row := 0; row+stride <= len(pix); row += stride {
+		for i := stride - 1; i >= spp; i-- {
+			pix[row+i] -= pix[row+i-spp]
+		}
+	}
+}
+
+func tiffCompress(pix []byte, compression uint16) ([]byte, error) {
+	switch compression {
+	case 5:
+		return tiffLZW(pix), nil
+	case 8:
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(pix); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return pix, nil
+}
+
+// tiffLZW compresses data with the TIFF flavour of LZW: MSB-first codes of
+// 9 to 12 bits that widen one code early. compress/lzw cannot write it.
+func tiffLZW(data []byte) []byte {
+	const (
+		clearCode = 256
+		eoiCode   = 257
+		maxCode   = 4094
+		maxWidth  = 12
+	)
+	var out bytes.Buffer
+	var bits uint32
+	var nbits, width uint
+	emit := func(code int) {
+		bits = bits<<width | uint32(code)
+		nbits += width
+		for nbits >= 8 {
+			nbits -= 8
+			out.WriteByte(byte(bits >> nbits))
+		}
+	}
+
+	// table[prefix][byte] holds the code for prefix+byte, 0 if unassigned.
+	table := make([][256]uint16, maxCode+1)
+	next := eoiCode + 1
+	reset := func() {
+		clear(table)
+		next, width = eoiCode+1, 9
+	}
+	// grow accounts for the code just emitted, widening codes as the
+	// decoder will.
+	grow := func() {
+		next++
+		if next >= 1<<width && width < maxWidth {
+			width++
+		}
+	}
+
+	width = 9
+	emit(clearCode)
+	reset()
+	if len(data) == 0 {
+		emit(eoiCode)
+	} else {
+		w := int(data[0])
+		for _, k := range data[1:] {
+			if code := table[w][k]; code != 0 {
+				w = int(code)
+				continue
+			}
+			emit(w)
+			table[w][k] = uint16(next)
+			grow()
+			if next >= maxCode {
+				emit(clearCode)
+				reset()
+			}
+			w = int(k)
+		}
+		emit(w)
+		grow()
+		emit(eoiCode)
+	}
+	if nbits > 0 {
+		out.WriteByte(byte(bits << (8 - nbits)))
+	}
+	return out.Bytes()
+}
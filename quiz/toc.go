@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	tocFontSize   = 12.0
+	tocLineHeight = 18.0
+	tocMargin     = 54.0
+)
+
+type tocEntry struct {
+	label string
+	page  int
+	link  int
+}
+
+// tocPageSize is the page used for the contents: --page-size, or A4.
+func tocPageSize(opts options) gofpdf.SizeType {
+	if size, ok := pageSizes[opts.pageSize]; ok {
+		return size
+	}
+	return pageSizes["a4"]
+}
+
+// tocLinesPerPage is how many entries fit below the heading on one page.
+func tocLinesPerPage(opts options) int {
+	size := tocPageSize(opts)
+	return max(1, int((size.Ht-2*tocMargin-3*tocLineHeight)/tocLineHeight))
+}
+
+// tocPages returns the number of pages needed to list n entries.
+func tocPages(n int, opts options) int {
+	per := tocLinesPerPage(opts)
+	return max(1, (n+per-1)/per)
+}
+
+// addTOC writes the contents pages, one dotted line per entry linking to its
+// page. Links are resolved later with SetLink as the pages are added.
+func addTOC(pdf *gofpdf.Fpdf, entries []tocEntry, opts options) {
+	tr := textEncoder(pdf, opts)
+	size := tocPageSize(opts)
+	per := tocLinesPerPage(opts)
+	width := size.Wd - 2*tocMargin
+
+	for start := 0; start < len(entries) || start == 0; start += per {
+		pdf.AddPageFormat("P", size)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.SetFont(fontFamily(opts), "B", tocFontSize*1.5)
+		pdf.SetXY(tocMargin, tocMargin)
+		pdf.CellFormat(width, 2*tocLineHeight, "Contents", "", 2, "L", false, 0, "")
+		pdf.Ln(tocLineHeight)
+
+		pdf.SetFont(fontFamily(opts), "", tocFontSize)
+		for _, e := range entries[start:min(start+per, len(entries))] {
+			label := tr(e.label)
+			num := strconv.Itoa(e.page)
+			numWidth := pdf.GetStringWidth(num) + 2*pdf.GetCellMargin()
+			labelWidth := width - numWidth
+			free := labelWidth - 2*pdf.GetCellMargin() - pdf.GetStringWidth(label)
+			dots := strings.Repeat(" .", max(0, int(free/pdf.GetStringWidth(" ."))))
+
+			pdf.SetX(tocMargin)
+			pdf.CellFormat(labelWidth, tocLineHeight, label+dots, "", 0, "L", false, e.link, "")
+			pdf.CellFormat(numWidth, tocLineHeight, num, "", 1, "R", false, e.link, "")
+		}
+		if len(entries) == 0 {
+			break
+		}
+	}
+}
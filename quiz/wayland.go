@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// useGrim reports whether captures should go through grim (wlr-screencopy).
+func (o options) useGrim() bool {
+	switch o.backend {
+	case "grim":
+		return true
+	case "auto":
+		return o.displayEnv == "" && os.Getenv("WAYLAND_DISPLAY") != ""
+	}
+	return false
+}
+
+// captureGrim captures an area of the logical layout with grim -g.
+func captureGrim(r image.Rectangle) (image.Image, error) {
+	return runGrim("-g", fmt.Sprintf("%d,%d %dx%d", r.Min.X, r.Min.Y, r.Dx(), r.Dy()))
+}
+
+// waylandOutput is a compositor output and its logical layout area, the
+// coordinates grim -g takes.
+type waylandOutput struct {
+	name   string
+	bounds image.Rectangle
+}
+
+// outputTools list the outputs on the common wlroots compositors, tried in
+// order until one works.
+var outputTools = []struct {
+	args  []string
+	parse func([]byte) ([]waylandOutput, error)
+}{
+	{[]string{"swaymsg", "-r", "-t", "get_outputs"}, parseSwayOutputs},
+	{[]string{"hyprctl", "-j", "monitors"}, parseHyprMonitors},
+	{[]string{"wlr-randr", "--json"}, parseWlrRandr},
+}
+
+// waylandOutputs returns the active outputs, listed once per run.
+var waylandOutputs = sync.OnceValues(func() ([]waylandOutput, error) {
+	var errs []string
+	for _, tool := range outputTools {
+		if _, err := exec.LookPath(tool.args[0]); err != nil {
+			continue
+		}
+		out, err := exec.Command(tool.args[0], tool.args[1:]...).Output()
+		if err == nil {
+			var outputs []waylandOutput
+			if outputs, err = tool.parse(out); err == nil && len(outputs) > 0 {
+				return outputs, nil
+			}
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", tool.args[0], err))
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("listing Wayland outputs needs swaymsg, hyprctl or wlr-randr")
+	}
+	return nil, fmt.Errorf("listing Wayland outputs: %s", strings.Join(errs, "; "))
+})
+
+func parseSwayOutputs(data []byte) ([]waylandOutput, error) {
+	var list []struct {
+		Name   string `json:"name"`
+		Active bool   `json:"active"`
+		Rect   struct {
+			X, Y, Width, Height int
+		} `json:"rect"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	var outputs []waylandOutput
+	for _, o := range list {
+		if o.Active {
+			outputs = append(outputs, waylandOutput{o.Name, image.Rect(o.Rect.X, o.Rect.Y, o.Rect.X+o.Rect.Width, o.Rect.Y+o.Rect.Height)})
+		}
+	}
+	return outputs, nil
+}
+
+func parseHyprMonitors(data []byte) ([]waylandOutput, error) {
+	var list []struct {
+		Name      string  `json:"name"`
+		X         int     `json:"x"`
+		Y         int     `json:"y"`
+		Width     int     `json:"width"`
+		Height    int     `json:"height"`
+		Scale     float64 `json:"scale"`
+		Transform int     `json:"transform"`
+		Disabled  bool    `json:"disabled"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	var outputs []waylandOutput
+	for _, m := range list {
+		if !m.Disabled {
+			// Odd transforms turn the output by 90 or 270 degrees.
+			outputs = append(outputs, waylandOutput{m.Name, logicalBounds(m.X, m.Y, m.Width, m.Height, m.Scale, m.Transform%2 == 1)})
+		}
+	}
+	return outputs, nil
+}
+
+func parseWlrRandr(data []byte) ([]waylandOutput, error) {
+	var list []struct {
+		Name     string `json:"name"`
+		Enabled  bool   `json:"enabled"`
+		Position struct {
+			X, Y int
+		} `json:"position"`
+		Modes []struct {
+			Width   int  `json:"width"`
+			Height  int  `json:"height"`
+			Current bool `json:"current"`
+		} `json:"modes"`
+		Transform string  `json:"transform"`
+		Scale     float64 `json:"scale"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	var outputs []waylandOutput
+	for _, o := range list {
+		if !o.Enabled {
+			continue
+		}
+		for _, mode := range o.Modes {
+			if mode.Current {
+				turned := strings.HasSuffix(o.Transform, "90") || strings.HasSuffix(o.Transform, "270")
+				outputs = append(outputs, waylandOutput{o.Name, logicalBounds(o.Position.X, o.Position.Y, mode.Width, mode.Height, o.Scale, turned)})
+				break
+			}
+		}
+	}
+	return outputs, nil
+}
+
+// logicalBounds converts an output's mode size in pixels to its area in
+// the compositor's logical layout.
+func logicalBounds(x, y, w, h int, scale float64, turned bool) image.Rectangle {
+	if turned {
+		w, h = h, w
+	}
+	if scale > 0 {
+		w, h = int(math.Round(float64(w)/scale)), int(math.Round(float64(h)/scale))
+	}
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// runGrim runs grim with args and decodes the PNG it writes to stdout.
+func runGrim(args ...string) (image.Image, error) {
+	if _, err := exec.LookPath("grim"); err != nil {
+		return nil, fmt.Errorf("grim is not installed")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("grim", append(append([]string{"-t", "png"}, args...), "-")...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("grim failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return png.Decode(&stdout)
+}
+
+// captureGrimDisplays captures one output with grim -o, or several as the
+// area they span, which grim stitches at a common scale.
+func captureGrimDisplays(displays []int) (image.Image, image.Rectangle, error) {
+	outputs, err := waylandOutputs()
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	var union image.Rectangle
+	for _, d := range displays {
+		if d < 0 || d >= len(outputs) {
+			return nil, union, fmt.Errorf("display %d not found", d)
+		}
+		union = union.Union(outputs[d].bounds)
+	}
+	if len(displays) == 1 {
+		img, err := runGrim("-o", outputs[displays[0]].name)
+		return img, union, err
+	}
+	img, err := captureGrim(union)
+	return img, union, err
+}
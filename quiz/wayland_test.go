@@ -0,0 +1,60 @@
+package main
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestWaylandOutputs(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func([]byte) ([]waylandOutput, error)
+		data  string
+		want  []waylandOutput
+	}{
+		{"swaymsg", parseSwayOutputs, `[
+  {"name": "eDP-1", "active": true, "scale": 2.0, "rect": {"x": 0, "y": 0, "width": 1280, "height": 800}},
+  {"name": "HDMI-A-1", "active": false, "rect": {"x": 0, "y": 0, "width": 0, "height": 0}},
+  {"name": "DP-2", "active": true, "rect": {"x": 1280, "y": -200, "width": 1920, "height": 1080}}
+]`, []waylandOutput{
+			{"eDP-1", image.Rect(0, 0, 1280, 800)},
+			{"DP-2", image.Rect(1280, -200, 3200, 880)},
+		}},
+		{"hyprctl", parseHyprMonitors, `[
+  {"name": "eDP-1", "x": 0, "y": 0, "width": 2560, "height": 1600, "scale": 2.00, "transform": 0, "disabled": false},
+  {"name": "DP-2", "x": 1280, "y": 0, "width": 1920, "height": 1080, "scale": 1.00, "transform": 1, "disabled": false},
+  {"name": "DP-3", "x": 0, "y": 0, "width": 1920, "height": 1080, "scale": 1.00, "transform": 0, "disabled": true}
+]`, []waylandOutput{
+			{"eDP-1", image.Rect(0, 0, 1280, 800)},
+			{"DP-2", image.Rect(1280, 0, 2360, 1920)},
+		}},
+		{"wlr-randr", parseWlrRandr, `[
+  {"name": "eDP-1", "enabled": true, "modes": [
+    {"width": 1920, "height": 1200, "refresh": 60.0, "preferred": true, "current": false},
+    {"width": 2560, "height": 1600, "refresh": 60.0, "preferred": false, "current": true}
+  ], "position": {"x": 0, "y": 0}, "transform": "normal", "scale": 1.5},
+  {"name": "DP-1", "enabled": true, "modes": [{"width": 1920, "height": 1080, "current": true}],
+   "position": {"x": 1707, "y": 0}, "transform": "flipped-270", "scale": 1.0},
+  {"name": "DP-2", "enabled": false, "modes": [], "position": {"x": 0, "y": 0}, "transform": "normal", "scale": 1.0}
+]`, []waylandOutput{
+			{"eDP-1", image.Rect(0, 0, 1707, 1067)},
+			{"DP-1", image.Rect(1707, 0, 2787, 1920)},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := tt.parse([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: outputs = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	for _, tt := range tests {
+		if _, err := tt.parse([]byte(`{"name": "eDP-1"}`)); err == nil {
+			t.Errorf("%s: parsed an object as an output list", tt.name)
+		}
+	}
+}
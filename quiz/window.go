@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"time"
+
+	"github.com/go-vgo/robotgo"
+)
+
+const activateSettleDelay = 150 * time.Millisecond
+
+func hasWindow(pid int) bool {
+	_, _, w, h := robotgo.GetClient(pid)
+	return w > 0 && h > 0
+}
+
+func findWindowPid(name string) (int, error) {
+	var found int
+	withStderrSilenced(func() {
+		pids, err := robotgo.FindIds(name)
+		if err == nil {
+			for _, pid := range pids {
+				if hasWindow(pid) {
+					found = pid
+					return
+				}
+			}
+		}
+
+		all, err := robotgo.Pids()
+		if err != nil {
+			return
+		}
+		needle := strings.ToLower(name)
+		for _, pid := range all {
+			if strings.Contains(strings.ToLower(robotgo.GetTitle(pid)), needle) && hasWindow(pid) {
+				found = pid
+				return
+			}
+		}
+	})
+
+	if found == 0 {
+		return 0, fmt.Errorf("no window matching %q", name)
+	}
+	return found, nil
+}
+
+func resolveTargetPid(opts options) (int, error) {
+	if opts.pid > 0 {
+		if exists, err := robotgo.PidExists(opts.pid); err != nil || !exists {
+			return 0, fmt.Errorf("process %d not found", opts.pid)
+		}
+		if !hasWindow(opts.pid) {
+			return 0, fmt.Errorf("process %d has no visible window", opts.pid)
+		}
+		return opts.pid, nil
+	}
+	return findWindowPid(opts.windowName)
+}
+
+func windowClientBounds(pid int) (image.Rectangle, error) {
+	if err := robotgo.ActivePid(pid); err != nil {
+		return image.Rectangle{}, fmt.Errorf("failed to activate window (pid %d): %w", pid, err)
+	}
+	time.Sleep(activateSettleDelay)
+
+	x, y, w, h := robotgo.GetClient(pid)
+	if w <= 0 || h <= 0 {
+		return image.Rectangle{}, fmt.Errorf("could not get bounds of window (pid %d)", pid)
+	}
+	return image.Rect(x, y, x+w, y+h), nil
+}
+
+// focusWindow activates the window of pid unless it already has focus, and
+// reports whether it had to.
+func focusWindow(pid int) (bool, error) {
+	if robotgo.GetPid() == pid {
+		return false, nil
+	}
+	if err := robotgo.ActivePid(pid); err != nil {
+		return false, fmt.Errorf("failed to activate window (pid %d): %w", pid, err)
+	}
+	time.Sleep(activateSettleDelay)
+	return true, nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// wizard asks the questions of `init` and collects the answers as flag
+// values for the config file, in order.
+type wizard struct {
+	in     *bufio.Reader
+	keys   []string
+	values map[string]string
+}
+
+// ask prints question with its default and returns the answer, or def for
+// an empty line.
+func (w *wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// choose asks for one of the numbered choices and returns its index.
+func (w *wizard) choose(question string, choices ...string) (int, error) {
+	fmt.Println(question)
+	for i, c := range choices {
+		fmt.Printf("  %d) %s\n", i+1, c)
+	}
+	for {
+		answer, err := w.ask("Choice", "1")
+		if err != nil {
+			return 0, err
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(choices) {
+			return n - 1, nil
+		}
+		fmt.Printf("Enter a number from 1 to %d\n", len(choices))
+	}
+}
+
+// set asks for the value of flag name until run accepts it. An empty
+// answer without a default leaves the flag out.
+func (w *wizard) set(name, question, def string) error {
+	for {
+		value, err := w.ask(question, def)
+		if err != nil || value == "" {
+			return err
+		}
+		err = w.keep(name, value)
+		if err == nil {
+			return nil
+		}
+		fmt.Printf("  %v\n", err)
+	}
+}
+
+// keep records value for flag name once run accepts it along with the
+// earlier answers.
+func (w *wizard) keep(name, value string) error {
+	args := []string{"--config", os.DevNull}
+	for _, key := range w.keys {
+		if key != name {
+			args = append(args, "--"+key+"="+w.values[key])
+		}
+	}
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := parseOptions(fs, append(args, "--"+name+"="+value)); err != nil {
+		return err
+	}
+	if _, ok := w.values[name]; !ok {
+		w.keys = append(w.keys, name)
+	}
+	w.values[name] = value
+	return nil
+}
+
+// initCommand implements `init`: it walks through the capture area, the
+// click target, delays and output settings and writes them as a config
+// file, by default the one run reads.
+func initCommand(args []string) {
+	fs := newFlagSet("init")
+	fs.Parse(args)
+	err := fmt.Errorf("usage: %s init [CONFIG_FILE]", progName())
+	switch fs.NArg() {
+	case 0:
+		var path string
+		if path, err = defaultConfigFile(); err == nil {
+			err = runWizard(path, progName())
+		}
+	case 1:
+		err = runWizard(fs.Arg(0), progName()+" --config "+fs.Arg(0))
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runWizard asks the questions and writes the answers to path; run is the
+// command line that uses them.
+func runWizard(path, run string) error {
+	w := &wizard{in: bufio.NewReader(os.Stdin), values: map[string]string{}}
+	if _, err := os.Stat(path); err == nil {
+		answer, err := w.ask(fmt.Sprintf("%s exists. Overwrite it? (y/n)", path), "n")
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(strings.ToLower(answer), "y") {
+			return nil
+		}
+	}
+
+	fmt.Println("This writes the settings you use every run; flags on the command line still override them.")
+	fmt.Println()
+	area, err := w.choose("What should be captured?", "a whole display", "a region of the screen", "one application window")
+	if err != nil {
+		return err
+	}
+	switch area {
+	case 0:
+		auto := options{backend: "auto"}
+		if active, _ := auto.activeDisplays(); len(active) > 1 {
+			printDisplays(auto)
+			err = w.set("display", "Display number", "0")
+		}
+	case 1:
+		var r image.Rectangle
+		if r, err = pickRegion(w.in); err == nil {
+			err = w.keep("region", fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Dx(), r.Dy()))
+		}
+	case 2:
+		if err = w.set("window", "Part of the window's title or program name", ""); err == nil {
+			var focus string
+			if focus, err = w.ask("Bring the window back to the front before each click? (y/n)", "y"); err == nil && strings.HasPrefix(strings.ToLower(focus), "y") {
+				err = w.keep("focus", "true")
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	advance, err := w.choose("How do you move to the next question?", "click a button (Next, Submit...)", "press a key")
+	if err != nil {
+		return err
+	}
+	if advance == 0 {
+		fmt.Print("Move the mouse over the button and press Enter...")
+		if _, err := w.in.ReadString('\n'); err != nil {
+			return err
+		}
+		x, y := robotgo.Location()
+		fmt.Printf(" (%d,%d)\n", x, y)
+		err = w.keep("click-at", fmt.Sprintf("%d,%d", x, y))
+	} else {
+		var key string
+		if key, err = w.ask("Key", "PageDown"); err == nil {
+			err = w.keep("action", "key:"+key)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	for _, q := range []struct{ name, question string }{
+		{"pre-click-delay", "Wait between a capture and the click"},
+		{"post-click-delay", "Wait after the click for the next question to load"},
+	} {
+		if err := w.set(q.name, q.question, (500 * time.Millisecond).String()); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println()
+	for _, q := range []struct{ name, question, def string }{
+		{"out-dir", "Folder for screenshots and the PDF", "~/Pictures"},
+		{"out", "PDF file name; {date}, {time}, {title}, {count} and {host} are filled in", "Qz_{time}.pdf"},
+		{"page-size", "Page size: A3, A4, A5, Letter or Legal (empty keeps each image's size)", ""},
+	} {
+		if err := w.set(q.name, q.question, q.def); err != nil {
+			return err
+		}
+	}
+
+	if err := w.write(path); err != nil {
+		return err
+	}
+	fmt.Printf("\nSaved %s. Run `%s 20` to capture 20 questions with these settings.\n", path, run)
+	return nil
+}
+
+// write saves the answers as a config file.
+func (w *wizard) write(path string) error {
+	values := map[string][]string{}
+	for _, key := range w.keys {
+		values[key] = []string{w.values[key]}
+	}
+	return writeConfig(path, "init", w.keys, values)
+}
+
+// writeConfig writes flag values as a config file, in the order of keys;
+// by names the command that wrote it. Several values become a list.
+func writeConfig(path, by string, keys []string, values map[string][]string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Written by %s %s on %s.\n", progName(), by, time.Now().Format("2006-01-02 15:04"))
+	for _, key := range keys {
+		if v := values[key]; len(v) == 1 {
+			fmt.Fprintf(&b, "%s: %s\n", key, yamlQuote(v[0]))
+			continue
+		}
+		fmt.Fprintf(&b, "%s:\n", key)
+		for _, v := range values[key] {
+			fmt.Fprintf(&b, "  - %s\n", yamlQuote(v))
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// yamlQuote quotes s when parseYAML would not read it back as is.
+func yamlQuote(s string) string {
+	if doc, err := parseYAML("v: " + s); err == nil {
+		if m, ok := doc.(map[string]any); ok && m["v"] == s {
+			return s
+		}
+	}
+	return strconv.Quote(s)
+}
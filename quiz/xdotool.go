@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// xdotoolKeys maps robotgo key names to X keysyms where they differ.
+var xdotoolKeys = map[string]string{
+	"pagedown":  "Page_Down",
+	"pageup":    "Page_Up",
+	"enter":     "Return",
+	"escape":    "Escape",
+	"tab":       "Tab",
+	"space":     "space",
+	"backspace": "BackSpace",
+	"delete":    "Delete",
+	"insert":    "Insert",
+	"home":      "Home",
+	"end":       "End",
+	"right":     "Right",
+	"left":      "Left",
+	"up":        "Up",
+	"down":      "Down",
+	"cmd":       "super",
+}
+
+var xdotoolButtons = map[string]string{"left": "1", "middle": "2", "right": "3"}
+
+// xdotoolInput drives input through the xdotool CLI (X11), for builds or
+// setups where robotgo's input does not work.
+type xdotoolInput struct{}
+
+func xdotool(args ...string) ([]byte, error) {
+	path, err := exec.LookPath("xdotool")
+	if err != nil {
+		return nil, fmt.Errorf("--input xdotool requires xdotool")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("xdotool %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (xdotoolInput) move(x, y int) error {
+	_, err := xdotool("mousemove", strconv.Itoa(x), strconv.Itoa(y))
+	return err
+}
+
+func (xdotoolInput) location() (int, int, error) {
+	out, err := xdotool("getmouselocation", "--shell")
+	if err != nil {
+		return 0, 0, err
+	}
+	var x, y int
+	for _, line := range strings.Split(string(out), "\n") {
+		if v, ok := strings.CutPrefix(line, "X="); ok {
+			x, _ = strconv.Atoi(v)
+		} else if v, ok := strings.CutPrefix(line, "Y="); ok {
+			y, _ = strconv.Atoi(v)
+		}
+	}
+	return x, y, nil
+}
+
+func (xdotoolInput) click(button string, double bool) error {
+	args := []string{"click"}
+	if double {
+		args = append(args, "--repeat", "2")
+	}
+	_, err := xdotool(append(args, xdotoolButtons[button])...)
+	return err
+}
+
+func (xdotoolInput) toggle(button string, down bool) error {
+	cmd := "mouseup"
+	if down {
+		cmd = "mousedown"
+	}
+	_, err := xdotool(cmd, xdotoolButtons[button])
+	return err
+}
+
+func (xdotoolInput) keyTap(k keyPress) error {
+	names := append(append([]string{}, k.mods...), k.key)
+	for i, name := range names {
+		if sym, ok := xdotoolKeys[name]; ok {
+			names[i] = sym
+		} else if n, ok := strings.CutPrefix(name, "f"); ok && n != "" && strings.Trim(n, "0123456789") == "" {
+			names[i] = strings.ToUpper(name) // F1...F24
+		}
+	}
+	_, err := xdotool("key", strings.Join(names, "+"))
+	return err
+}
+
+func (xdotoolInput) typeText(text string) error {
+	_, err := xdotool("type", "--delay", "0", "--", text)
+	return err
+}
+
+func (xdotoolInput) scroll(n int) error {
+	button := "4"
+	if n < 0 {
+		button, n = "5", -n
+	}
+	_, err := xdotool("click", "--repeat", strconv.Itoa(n), button)
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// parseYAML parses a YAML document, such as a config file, a profile or a
+// --script, into mappings (map[string]any), lists ([]any) and scalars.
+// Scalars are returned as strings, whatever their YAML type, and null as
+// nil, so values read like the command-line flags they stand for. JSON is
+// YAML too. An empty document is nil.
+func parseYAML(text string) (any, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return yamlValue(doc.Content[0])
+}
+
+func yamlValue(n *yaml.Node) (any, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+	case yaml.ScalarNode:
+		if n.ShortTag() == "!!null" {
+			return nil, nil
+		}
+		return n.Value, nil
+	case yaml.SequenceNode:
+		items := make([]any, len(n.Content))
+		for i, c := range n.Content {
+			v, err := yamlValue(c)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return items, nil
+	case yaml.MappingNode:
+		m := map[string]any{}
+		var merges []*yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: want a plain key", key.Line)
+			}
+			if key.ShortTag() == "!!merge" {
+				merges = append(merges, value)
+				continue
+			}
+			if _, dup := m[key.Value]; dup {
+				return nil, fmt.Errorf("line %d: duplicate key %q", key.Line, key.Value)
+			}
+			v, err := yamlValue(value)
+			if err != nil {
+				return nil, err
+			}
+			m[key.Value] = v
+		}
+		// Keys of the mapping itself win over merged (<<) ones.
+		for _, merge := range merges {
+			v, err := yamlValue(merge)
+			if err != nil {
+				return nil, err
+			}
+			sources, ok := v.([]any)
+			if !ok {
+				sources = []any{v}
+			}
+			for _, src := range sources {
+				sm, ok := src.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("line %d: << wants a mapping", merge.Line)
+				}
+				for k, v := range sm {
+					if _, set := m[k]; !set {
+						m[k] = v
+					}
+				}
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("line %d: unsupported YAML node", n.Line)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want any
+	}{
+		{"empty", "", nil},
+		{"only comments", "# nothing\n\n  # here\n", nil},
+		{"scalar item", "- click\n", []any{"click"}},
+		{"mapping", "out: Qz.pdf\npage-size: A4\n", map[string]any{"out": "Qz.pdf", "page-size": "A4"}},
+		{"empty value", "title:\n", map[string]any{"title": nil}},
+		{"double quoted", `text: "a: b # c\t\"d\""`, map[string]any{"text": "a: b # c\t\"d\""}},
+		{"single quoted", `text: 'it''s # here'`, map[string]any{"text": "it's # here"}},
+		{"typed scalars", "display: 1\nkeep-images: true\nscale: 1.5\n", map[string]any{"display": "1", "keep-images": "true", "scale": "1.5"}},
+		{"null", "a: ~\nb: null\n", map[string]any{"a": nil, "b": nil}},
+		{"flow list", "mask: [0,0,10,10, \"5,5,1,1\"]\n", map[string]any{"mask": []any{"0", "0", "10", "10", "5,5,1,1"}}},
+		{"flow mapping", "- {key: PageDown}\n- capture\n", []any{map[string]any{"key": "PageDown"}, "capture"}},
+		{"block scalar", "footer: |\n  line one\n  line two\n", map[string]any{"footer": "line one\nline two\n"}},
+		{"folded scalar", "title: >-\n  Week 3\n  quiz\n", map[string]any{"title": "Week 3 quiz"}},
+		{
+			"anchors and merge",
+			"base: &base\n  delay: 2s\n  out: a.pdf\nsite:\n  <<: *base\n  out: b.pdf\ncopy: *base\n",
+			map[string]any{
+				"base": map[string]any{"delay": "2s", "out": "a.pdf"},
+				"site": map[string]any{"delay": "2s", "out": "b.pdf"},
+				"copy": map[string]any{"delay": "2s", "out": "a.pdf"},
+			},
+		},
+		{"json", `{"steps": ["capture", {"scroll": -2}, {"wait": "1s"}]}`, map[string]any{"steps": []any{"capture", map[string]any{"scroll": "-2"}, map[string]any{"wait": "1s"}}}},
+		{"colon in value", "click-at: 10,20\naction: key:PageDown\n", map[string]any{"click-at": "10,20", "action": "key:PageDown"}},
+		{"url", "- navigate:https://example.com/a#b\n", []any{"navigate:https://example.com/a#b"}},
+		{"comment after value", "out: Qz.pdf # the name\n", map[string]any{"out": "Qz.pdf"}},
+		{"hash inside word", "out: Qz#1.pdf\n", map[string]any{"out": "Qz#1.pdf"}},
+		{"trailing spaces and CRLF", "out: Qz.pdf  \r\ndisplay: 1\r\n", map[string]any{"out": "Qz.pdf", "display": "1"}},
+		{
+			"list under key, indented",
+			"mask:\n  - 0,0,10,10\n  - 5,5,1,1\n",
+			map[string]any{"mask": []any{"0,0,10,10", "5,5,1,1"}},
+		},
+		{
+			"list under key, same column",
+			"mask:\n- 0,0,10,10\nout: a.pdf\n",
+			map[string]any{"mask": []any{"0,0,10,10"}, "out": "a.pdf"},
+		},
+		{
+			"mapping items",
+			"- key: PageDown\n- wait: 2s\n- capture\n",
+			[]any{map[string]any{"key": "PageDown"}, map[string]any{"wait": "2s"}, "capture"},
+		},
+		{
+			"multi-key item",
+			"- if-image: ok.png\n  timeout: 2s\n  then:\n    - click\n  else:\n    - key: Escape\n",
+			[]any{map[string]any{
+				"if-image": "ok.png",
+				"timeout":  "2s",
+				"then":     []any{"click"},
+				"else":     []any{map[string]any{"key": "Escape"}},
+			}},
+		},
+		{
+			"item on its own line",
+			"-\n  repeat: 2\n  do:\n    - click\n",
+			[]any{map[string]any{"repeat": "2", "do": []any{"click"}}},
+		},
+		{"empty item", "-\n- click\n", []any{nil, "click"}},
+		{"nested lists", "- - a\n  - b\n- c\n", []any{[]any{"a", "b"}, "c"}},
+		{
+			"nested mappings",
+			"a:\n  b:\n    c: d\n  e: f\n",
+			map[string]any{"a": map[string]any{"b": map[string]any{"c": "d"}, "e": "f"}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseYAML(tt.text)
+		if err != nil {
+			t.Errorf("%s: parseYAML: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseYAML = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"tab indent", "a:\n\t- b\n", "line 2"},
+		{"duplicate key", "out: a\n\nout: b\n", "line 3: duplicate key \"out\""},
+		{"list after mapping", "a: b\n- c\n", "did not find expected key"},
+		{"bad escape", `text: "\q"`, "unknown escape"},
+		{"unclosed flow list", "mask: [1,2\n", "line 1"},
+		{"merge of a list", "a:\n  <<: [x]\n", "<< wants a mapping"},
+	}
+	for _, tt := range tests {
+		_, err := parseYAML(tt.text)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: parseYAML error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestYAMLQuoteRoundTrip(t *testing.T) {
+	for _, s := range []string{"", "plain", " padded ", "a: b", "# not a comment", "say \"hi\"", "it's", `back\slash`, "Qz_{time}.pdf", "key:PageDown", "~", "null", "[a]", "{b}", "*x", "&y", "!z", "|", "> 3", "- item", "@at", "`tick`", "%p", "two\nlines", "tab\there"} {
+		got, err := parseYAML("v: " + yamlQuote(s) + "\n")
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		if v := got.(map[string]any)["v"]; v != s {
+			t.Errorf("yamlQuote(%q) read back as %#v", s, v)
+		}
+	}
+}